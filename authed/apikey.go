@@ -0,0 +1,224 @@
+package authed
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorpher/gone/cache"
+	"github.com/gorpher/gone/osutil"
+)
+
+const (
+	APIKeyHeader       = "X-API-Key"
+	APIKeyAuthScheme   = "ApiKey "
+	apiKeyIDLength     = 20 // osutil.XID
+	apiKeySecretLength = 32
+)
+
+var ErrorInvalidAPIKey = errors.New("invalid api key")
+var ErrorAPIKeyExpired = errors.New("api key expired")
+var ErrorAPIKeyRevoked = errors.New("api key revoked")
+
+// APIKey 机器客户端使用的长期密钥，明文格式为 <prefix>_<id>_<secret>，只持久化secret的摘要
+type APIKey struct {
+	ID         string   `json:"id" gorm:"primaryKey;size:32"`
+	Hash       string   `json:"hash" gorm:"size:64"`
+	Name       string   `json:"name" gorm:"size:128"`
+	Uid        string   `json:"uid" gorm:"index;size:64"`
+	Username   string   `json:"username" gorm:"size:128"`
+	Roles      []string `json:"roles,omitempty" gorm:"serializer:json"`
+	Scopes     []string `json:"scopes,omitempty" gorm:"serializer:json"`
+	ExpiredAt  int64    `json:"expired_at"` // 单位秒，0表示永不过期
+	LastUsedAt int64    `json:"last_used_at"`
+	CreatedAt  int64    `json:"created_at"`
+	RevokedAt  int64    `json:"revoked_at"`
+}
+
+func (k *APIKey) TableName() string {
+	return "authed_api_keys"
+}
+
+// APIKeyStore API Key持久化
+type APIKeyStore interface {
+	SaveAPIKey(key *APIKey) error
+	GetAPIKey(id string) (*APIKey, error)
+	// TouchAPIKey 只更新最后使用时间，不能覆盖撤销等其他字段
+	TouchAPIKey(id string, lastUsedAt int64) error
+}
+
+// CacheAPIKeyStore 基于cache.Cache保存API Key
+type CacheAPIKeyStore struct {
+	store     cache.Cache
+	namespace string
+}
+
+func NewCacheAPIKeyStore(c cache.Cache, namespace string) *CacheAPIKeyStore {
+	return &CacheAPIKeyStore{store: c, namespace: namespace}
+}
+
+func (c *CacheAPIKeyStore) FormatAPIKeyStoreKey(id string) string {
+	return fmt.Sprintf("%s/authed/apikey/%s", c.namespace, id)
+}
+
+// FormatLastUsedStoreKey 最后使用时间单独保存，更新时不会覆盖并发的撤销
+func (c *CacheAPIKeyStore) FormatLastUsedStoreKey(id string) string {
+	return fmt.Sprintf("%s/authed/apikey/%s/last_used", c.namespace, id)
+}
+
+func (c *CacheAPIKeyStore) SaveAPIKey(key *APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return c.store.Set(c.FormatAPIKeyStoreKey(key.ID), string(data))
+}
+
+func (c *CacheAPIKeyStore) GetAPIKey(id string) (*APIKey, error) {
+	data, err := c.store.Get(c.FormatAPIKeyStoreKey(id))
+	if err != nil || len(data) == 0 {
+		return nil, ErrorInvalidAPIKey
+	}
+	var key APIKey
+	if err = json.Unmarshal(data, &key); err != nil {
+		return nil, err
+	}
+	if data, err = c.store.Get(c.FormatLastUsedStoreKey(id)); err == nil && len(data) > 0 {
+		if lastUsedAt, e := strconv.ParseInt(string(data), 10, 64); e == nil && lastUsedAt > key.LastUsedAt {
+			key.LastUsedAt = lastUsedAt
+		}
+	}
+	return &key, nil
+}
+
+// TouchAPIKey 只写入最后使用时间，不重写整条记录
+func (c *CacheAPIKeyStore) TouchAPIKey(id string, lastUsedAt int64) error {
+	return c.store.Set(c.FormatLastUsedStoreKey(id), strconv.FormatInt(lastUsedAt, 10))
+}
+
+func WithAPIKeyStore(store APIKeyStore) OptFunc {
+	return func(s *Authed) *Authed {
+		s.apiKeys = store
+		return s
+	}
+}
+
+// WithAPIKeyPrefix 设置API Key明文前缀，前缀中不能包含下划线
+func WithAPIKeyPrefix(prefix string) OptFunc {
+	return func(s *Authed) *Authed {
+		s.APIKeyPrefix = prefix
+		return s
+	}
+}
+
+// IssueAPIKey 颁发API Key，key中的Name、Uid、Roles、Scopes由调用方填写，ttl为0表示永不过期，
+// 返回的明文只在此时可见
+func (s *Authed) IssueAPIKey(key *APIKey, ttl time.Duration) (plaintext string, err error) {
+	if key == nil {
+		err = ErrorInvalidAPIKey
+		return
+	}
+	secret := randomToken(apiKeySecretLength)
+	now := time.Now()
+	key.ID = osutil.XID()
+	key.Hash = hashAPIKeySecret(secret)
+	key.CreatedAt = now.Unix()
+	key.LastUsedAt = 0
+	key.RevokedAt = 0
+	key.ExpiredAt = 0
+	if ttl > 0 {
+		key.ExpiredAt = now.Add(ttl).Unix()
+	}
+	if err = s.apiKeys.SaveAPIKey(key); err != nil {
+		return
+	}
+	plaintext = s.APIKeyPrefix + "_" + key.ID + "_" + secret
+	return
+}
+
+// VerifyAPIKey 校验API Key明文，成功时更新最后使用时间
+func (s *Authed) VerifyAPIKey(plaintext string) (*APIKey, error) {
+	id, secret, ok := s.parseAPIKey(plaintext)
+	if !ok {
+		return nil, ErrorInvalidAPIKey
+	}
+	key, err := s.apiKeys.GetAPIKey(id)
+	if err != nil {
+		return nil, ErrorInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashAPIKeySecret(secret))) != 1 {
+		return nil, ErrorInvalidAPIKey
+	}
+	if key.RevokedAt != 0 {
+		return nil, ErrorAPIKeyRevoked
+	}
+	now := time.Now().Unix()
+	if key.ExpiredAt != 0 && now >= key.ExpiredAt {
+		return nil, ErrorAPIKeyExpired
+	}
+	key.LastUsedAt = now
+	if err = s.apiKeys.TouchAPIKey(id, now); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// RevokeAPIKey 撤销API Key
+func (s *Authed) RevokeAPIKey(id string) error {
+	key, err := s.apiKeys.GetAPIKey(id)
+	if err != nil {
+		return err
+	}
+	key.RevokedAt = time.Now().Unix()
+	return s.apiKeys.SaveAPIKey(key)
+}
+
+// GetAPIKey 根据ID查询API Key，用于展示最后使用时间等信息
+func (s *Authed) GetAPIKey(id string) (*APIKey, error) {
+	return s.apiKeys.GetAPIKey(id)
+}
+
+// APIKeySession 将API Key转换为用户会话，会话ID即API Key的ID
+func (s *Authed) APIKeySession(key *APIKey) *UserSession {
+	return &UserSession{
+		ID:         key.ID,
+		Uid:        key.Uid,
+		Username:   key.Username,
+		ClientName: key.Name,
+		ExpiredAt:  key.ExpiredAt,
+		Roles:      key.Roles,
+		Scopes:     key.Scopes,
+		Extends:    map[string]any{"auth": "apikey"},
+	}
+}
+
+func (s *Authed) parseAPIKey(plaintext string) (id, secret string, ok bool) {
+	rest := strings.TrimPrefix(plaintext, s.APIKeyPrefix+"_")
+	if len(rest) == len(plaintext) || len(rest) < apiKeyIDLength+2 || rest[apiKeyIDLength] != '_' {
+		return "", "", false
+	}
+	return rest[:apiKeyIDLength], rest[apiKeyIDLength+1:], true
+}
+
+// getAPIKeyFromRequest 从 X-API-Key 或 Authorization: ApiKey 中读取API Key
+func getAPIKeyFromRequest(req *http.Request) string {
+	if key := req.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, APIKeyAuthScheme) {
+		return strings.TrimSpace(strings.TrimPrefix(auth, APIKeyAuthScheme))
+	}
+	return ""
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
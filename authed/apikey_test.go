@@ -0,0 +1,78 @@
+package authed
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAPIKey(t *testing.T) {
+	a := NewAuthed()
+	key := &APIKey{Name: "ci", Uid: "1001", Username: "tom", Scopes: []string{"read"}}
+	plaintext, err := a.IssueAPIKey(key, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(APIKeyHeader, plaintext)
+	se := a.GetHTTPSession(req)
+	if se == nil || se.Uid != "1001" || se.ID != key.ID || se.Extends["auth"] != "apikey" {
+		t.Fatalf("unexpected session %+v", se)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", APIKeyAuthScheme+plaintext)
+	if se = a.GetHTTPSession(req); se == nil || se.Username != "tom" {
+		t.Fatalf("unexpected session %+v", se)
+	}
+	stored, err := a.GetAPIKey(key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LastUsedAt == 0 {
+		t.Fatal("last used not recorded")
+	}
+
+	if _, err = a.VerifyAPIKey(plaintext + "x"); !errors.Is(err, ErrorInvalidAPIKey) {
+		t.Fatalf("expect invalid api key, got %v", err)
+	}
+	if err = a.RevokeAPIKey(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.VerifyAPIKey(plaintext); !errors.Is(err, ErrorAPIKeyRevoked) {
+		t.Fatalf("expect revoked, got %v", err)
+	}
+	// 校验过程中发生撤销，之后写入的最后使用时间不能恢复API Key
+	usedAt := time.Now().Unix() + 60
+	if err = a.apiKeys.TouchAPIKey(key.ID, usedAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.VerifyAPIKey(plaintext); !errors.Is(err, ErrorAPIKeyRevoked) {
+		t.Fatalf("touch after revoke restored key: %v", err)
+	}
+	if stored, _ = a.GetAPIKey(key.ID); stored.LastUsedAt != usedAt { // nolint
+		t.Fatalf("last used not merged: %d", stored.LastUsedAt)
+	}
+}
+
+func TestAPIKeyExpired(t *testing.T) {
+	a := NewAuthed(WithAPIKeyPrefix("test"))
+	key := &APIKey{Uid: "1001"}
+	plaintext, err := a.IssueAPIKey(key, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := a.GetAPIKey(key.ID) // nolint
+	stored.ExpiredAt = time.Now().Add(-time.Second).Unix()
+	if err = a.apiKeys.SaveAPIKey(stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.VerifyAPIKey(plaintext); !errors.Is(err, ErrorAPIKeyExpired) {
+		t.Fatalf("expect expired, got %v", err)
+	}
+	if _, err = NewAuthed().VerifyAPIKey(plaintext); !errors.Is(err, ErrorInvalidAPIKey) {
+		t.Fatal("prefix not checked")
+	}
+}
@@ -0,0 +1,189 @@
+package authed
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorpher/gone/httputil"
+	"github.com/gorpher/gone/logger"
+	"github.com/gorpher/gone/osutil"
+)
+
+type AuditEventType string
+
+const (
+	AuditLogin          AuditEventType = "login"
+	AuditLogout         AuditEventType = "logout"
+	AuditTokenIssued    AuditEventType = "token_issued"
+	AuditTokenRefreshed AuditEventType = "token_refreshed"
+	AuditTokenRevoked   AuditEventType = "token_revoked"
+	AuditVerifyFailed   AuditEventType = "verify_failed"
+	AuditImpersonate    AuditEventType = "impersonate"
+)
+
+// AuditEvent 认证审计事件，ClientIP、UserAgent只有在能拿到请求时才会填写
+type AuditEvent struct {
+	ID        string         `json:"id" gorm:"primaryKey;size:32"`
+	Type      AuditEventType `json:"type" gorm:"index;size:32"`
+	SessionID string         `json:"session_id" gorm:"index;size:64"`
+	Uid       string         `json:"uid" gorm:"index;size:64"`
+	Username  string         `json:"username" gorm:"size:128"`
+	ActorUid  string         `json:"actor_uid,omitempty" gorm:"index;size:64"` // 代理登录时的管理员
+	ClientIP  string         `json:"client_ip" gorm:"size:64"`
+	UserAgent string         `json:"user_agent" gorm:"size:512"`
+	Reason    string         `json:"reason,omitempty" gorm:"size:256"`
+	CreatedAt int64          `json:"created_at" gorm:"index"`
+}
+
+func (e *AuditEvent) TableName() string {
+	return "authed_audit_events"
+}
+
+// AuditSink 审计事件输出
+type AuditSink interface {
+	WriteAudit(e *AuditEvent) error
+}
+
+func WithAuditSink(sinks ...AuditSink) OptFunc {
+	return func(s *Authed) *Authed {
+		s.auditSinks = append(s.auditSinks, sinks...)
+		return s
+	}
+}
+
+// Audit 记录审计事件，req和se可以为nil，sink写入失败只记录日志不影响认证流程
+func (s *Authed) Audit(req *http.Request, typ AuditEventType, se *UserSession, reason error) {
+	if len(s.auditSinks) == 0 {
+		return
+	}
+	e := &AuditEvent{ID: osutil.XID(), Type: typ, CreatedAt: time.Now().Unix()}
+	if se != nil {
+		e.SessionID = se.ID
+		e.Uid = se.Uid
+		e.Username = se.Username
+		if se.Act != nil {
+			e.ActorUid = se.Act.Subject
+		}
+	}
+	if req != nil {
+		e.ClientIP = httputil.GetClientIP(req)
+		e.UserAgent = httputil.GetUserAgent(req).String
+	}
+	if reason != nil {
+		e.Reason = reason.Error()
+	}
+	for _, sink := range s.auditSinks {
+		if err := sink.WriteAudit(e); err != nil {
+			logger.Warn("authed.audit", "write audit event %s failed: %v", e.ID, err)
+		}
+	}
+}
+
+// Login 登录成功后颁发令牌并写入cookie，服务端会话模式下创建会话，refresh为空
+func (s *Authed) Login(w http.ResponseWriter, req *http.Request, se *UserSession) (token, refresh string, err error) {
+	if s.serverSession {
+		token, err = s.CreateSession(w, req, se)
+	} else {
+		token, refresh, err = s.issueToken(req, se)
+		if err == nil {
+			// 令牌写不进cookie时登录失败，撤销已颁发的令牌
+			if err = s.SetCookieToken(w, token, int(s.TokenDuration/time.Second)); err != nil {
+				_ = s.deleteToken(req, se.ID) // nolint
+				token, refresh = "", ""
+			}
+		}
+	}
+	if err != nil {
+		return
+	}
+	s.Audit(req, AuditLogin, se, nil)
+	return
+}
+
+// Logout 退出登录，删除当前令牌或服务端会话以及cookie
+func (s *Authed) Logout(w http.ResponseWriter, req *http.Request) error {
+	se, err := s.getHTTPSession(req)
+	if err != nil {
+		return err
+	}
+	if s.serverSession {
+		err = s.DestroySession(w, req)
+	} else {
+		err = s.deleteToken(req, se.ID)
+		s.DeleteCookieToken(w, req)
+	}
+	if err != nil {
+		return err
+	}
+	s.Audit(req, AuditLogout, se, nil)
+	return nil
+}
+
+// auditRejected 认证失败时记录原因，请求未携带凭证不算失败
+func (s *Authed) auditRejected(req *http.Request, reason error) {
+	if errors.Is(reason, ErrorTokenNotFound) {
+		return
+	}
+	s.Audit(req, AuditVerifyFailed, nil, reason)
+}
+
+// MemoryAuditSink 保存在内存中的审计事件，用于测试
+type MemoryAuditSink struct {
+	mu     sync.Mutex
+	events []AuditEvent
+}
+
+func NewMemoryAuditSink() *MemoryAuditSink {
+	return &MemoryAuditSink{}
+}
+
+func (m *MemoryAuditSink) WriteAudit(e *AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, *e)
+	return nil
+}
+
+// Events 返回已记录事件的副本
+func (m *MemoryAuditSink) Events() []AuditEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]AuditEvent(nil), m.events...)
+}
+
+func (m *MemoryAuditSink) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = nil
+}
+
+// LoggerAuditSink 通过logger输出结构化审计日志
+type LoggerAuditSink struct {
+	Sender string
+}
+
+func NewLoggerAuditSink() *LoggerAuditSink {
+	return &LoggerAuditSink{Sender: "authed.audit"}
+}
+
+func (l *LoggerAuditSink) WriteAudit(e *AuditEvent) error {
+	level := logger.LevelInfo
+	if e.Type == AuditVerifyFailed {
+		level = logger.LevelWarn
+	}
+	logger.Event(level, l.Sender).
+		Str("event_id", e.ID).
+		Str("type", string(e.Type)).
+		Str("session_id", e.SessionID).
+		Str("uid", e.Uid).
+		Str("username", e.Username).
+		Str("actor_uid", e.ActorUid).
+		Str("client_ip", e.ClientIP).
+		Str("user_agent", e.UserAgent).
+		Str("reason", e.Reason).
+		Int64("created_at", e.CreatedAt).
+		Msg("audit")
+	return nil
+}
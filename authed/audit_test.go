@@ -0,0 +1,80 @@
+package authed
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorpher/gone/cookie"
+)
+
+func TestAudit(t *testing.T) {
+	sink := NewMemoryAuditSink()
+	a := NewAuthed(WithAuditSink(sink, NewLoggerAuditSink()))
+
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0")
+	req.RemoteAddr = "10.0.0.8:4321"
+	w := httptest.NewRecorder()
+	token, refresh, err := a.Login(w, req, &UserSession{Uid: "1001", Username: "tom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = a.RefreshHTTPToken(req, refresh); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := httptest.NewRequest("GET", "/", nil)
+	bad.Header.Set("Authorization", "Bearer "+token+"x")
+	if se := a.GetHTTPSession(bad); se != nil {
+		t.Fatal("tampered token accepted")
+	}
+	if se := a.GetHTTPSession(httptest.NewRequest("GET", "/", nil)); se != nil {
+		t.Fatal("anonymous request authenticated")
+	}
+
+	logout := httptest.NewRequest("POST", "/logout", nil)
+	for _, c := range w.Result().Cookies() {
+		logout.AddCookie(c)
+	}
+	if err = a.Logout(httptest.NewRecorder(), logout); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []AuditEventType{AuditTokenIssued, AuditLogin, AuditTokenRefreshed, AuditVerifyFailed, AuditTokenRevoked, AuditLogout}
+	events := sink.Events()
+	if len(events) != len(want) {
+		t.Fatalf("want %d events, got %+v", len(want), events)
+	}
+	for i, e := range events {
+		if e.Type != want[i] {
+			t.Fatalf("event %d: want %s got %s", i, want[i], e.Type)
+		}
+	}
+	if events[1].ClientIP != "10.0.0.8" || events[1].Uid != "1001" || events[1].UserAgent == "" {
+		t.Fatalf("unexpected login event %+v", events[1])
+	}
+	if events[2].ClientIP != "10.0.0.8" || events[2].Uid != "1001" {
+		t.Fatalf("unexpected refresh event %+v", events[2])
+	}
+	if events[4].Uid != "1001" || events[4].Username != "tom" || events[4].ClientIP == "" {
+		t.Fatalf("unexpected revoke event %+v", events[4])
+	}
+	if events[3].Reason == "" {
+		t.Fatal("verify failure without reason")
+	}
+}
+
+func TestLoginCookieTooLarge(t *testing.T) {
+	a := NewAuthed()
+	se := &UserSession{Uid: "1001", Extends: map[string]any{"blob": strings.Repeat("x", cookie.ChunkSize*cookie.MaxChunks)}}
+	w := httptest.NewRecorder()
+	token, _, err := a.Login(w, httptest.NewRequest("POST", "/login", nil), se)
+	if !errors.Is(err, cookie.ErrValueTooLong) || token != "" {
+		t.Fatalf("oversized token cookie accepted: %v", err)
+	}
+	if v, _ := a.store.Get(a.FormatTokenStoreKey(se.ID)); len(v) > 0 { // nolint
+		t.Fatal("token kept after failed login")
+	}
+}
@@ -1,16 +1,18 @@
 package authed
 
 import (
+	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"github.com/gorpher/gone/cache"
 	"github.com/gorpher/gone/codec"
 	"github.com/gorpher/gone/cookie"
 	"github.com/gorpher/gone/core"
+	"github.com/gorpher/gone/cryptoutil"
 	"github.com/gorpher/gone/osutil"
 	"net/http"
-	"net/url"
-	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,22 +22,51 @@ type Authed struct {
 	TokenDuration        time.Duration
 	RefreshTokenDuration time.Duration
 	MultiSession         bool
+	MFADuration          time.Duration // 等待第二因子的有效期
+	MFAMaxAttempts       int           // 第二因子最大尝试次数
+	APIKeyPrefix         string        // API Key明文前缀
+	// 免密登录链接和验证码的有效期、验证码最大尝试次数
+	PasswordlessDuration    time.Duration
+	PasswordlessMaxAttempts int
+	// 代理登录令牌的有效期
+	ImpersonationDuration time.Duration
+	// 服务端会话模式的空闲超时和绝对超时
+	SessionIdleTimeout     time.Duration
+	SessionAbsoluteTimeout time.Duration
 	// ===============================
-	cookieName  string // example: appname
-	cryptoKey   []byte
-	cryptoCodec codec.CryptoCodec
-	objectCodec codec.ObjectCodec
-	store       cache.Cache
+	cookieName    string // example: appname
+	cookieOptions *cookie.Optionals
+	serverSession bool // 服务端会话模式
+	cryptoKey     []byte
+	cryptoCodec   codec.CryptoCodec
+	objectCodec   codec.ObjectCodec
+	store         cache.Cache
+	apiKeys       APIKeyStore
+	// 自定义认证器
+	authenticators []Authenticator
+	// 令牌读取和认证结果回调
+	extractor       TokenExtractor
+	onTokenVerified func(req *http.Request, se *UserSession)
+	onTokenRejected func(req *http.Request, reason error)
+	auditSinks      []AuditSink
+	// 进程内串行化同一key的读改写
+	locks keyLocker
 }
 
 type OptFunc func(session *Authed) *Authed
 
-func WithCookieCode(hashKey, key []byte) OptFunc {
+// WithCookieCode 使用cookie编码，opts可以选择codec.WithCookieSM4等分组密码
+func WithCookieCode(hashKey, key []byte, opts ...codec.CookieCodecOptFunc) OptFunc {
 	return func(s *Authed) *Authed {
-		s.cryptoCodec = codec.NewCookieCodec(hashKey, key)
+		// 令牌cookie会分块保存，放宽编码长度限制
+		opts = append([]codec.CookieCodecOptFunc{codec.WithCookieMaxLength(cookie.ChunkSize * cookie.MaxChunks)}, opts...)
+		s.cryptoCodec = codec.NewCookieCodec(hashKey, key, opts...)
 		return s
 	}
 }
+
+// WithJwtCode 使用jwt编码，支持HS256、HS384、HS512、HMAC-SM3和SM2SM3，
+// SM2SM3使用WithCryptoKey设置的PKCS8编码的SM2私钥
 func WithJwtCode(alg string) OptFunc {
 	return func(s *Authed) *Authed {
 		s.cryptoCodec = codec.NewJwtCodec(alg)
@@ -43,6 +74,15 @@ func WithJwtCode(alg string) OptFunc {
 	}
 }
 
+// WithJweCode 使用JWE加密令牌，客户端无法读取角色、扩展字段等声明，
+// dir、A256KW使用WithCryptoKey设置的32字节密钥，RSA-OAEP-256、ECDH-ES通过opts设置公私钥
+func WithJweCode(alg, enc string, opts ...codec.JweCodecOptFunc) OptFunc {
+	return func(s *Authed) *Authed {
+		s.cryptoCodec = codec.NewJweCodec(alg, enc, opts...)
+		return s
+	}
+}
+
 // WithCryptoKey 初始化加密jwt的hs512的密钥key
 func WithCryptoKey(key []byte) OptFunc {
 	return func(s *Authed) *Authed {
@@ -51,12 +91,30 @@ func WithCryptoKey(key []byte) OptFunc {
 	}
 }
 
+// WithWrappedCryptoKey 使用KEK解包WithCryptoKey的密钥，配置中只保存cryptoutil.GenerateDataKey返回的kid和包装后的密钥
+func WithWrappedCryptoKey(ctx context.Context, kek cryptoutil.KeyEncryptionKey, keyID string, wrapped []byte) (OptFunc, error) {
+	key, err := kek.UnwrapKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return WithCryptoKey(key), nil
+}
+
 func WithCookieName(cookieName string) OptFunc {
 	return func(s *Authed) *Authed {
 		s.cookieName = cookieName
 		return s
 	}
 }
+
+// WithCookieOptions 设置令牌cookie的属性，例如Domain、Secure、SameSite、__Host-前缀
+func WithCookieOptions(o cookie.Optionals) OptFunc {
+	return func(s *Authed) *Authed {
+		s.cookieOptions = &o
+		return s
+	}
+}
+
 func WithCache(c cache.Cache) OptFunc {
 	return func(s *Authed) *Authed {
 		s.store = c
@@ -83,19 +141,31 @@ var ErrorInvalidToken = errors.New("invalid token")
 
 func NewAuthed(opts ...OptFunc) *Authed {
 	s := &Authed{
-		Issuer:               "gone.authed",
-		Audience:             []string{"app"},
-		TokenDuration:        time.Hour * 2,
-		RefreshTokenDuration: time.Hour * 24 * 7,
-		cryptoKey:            cryptoKey,
-		cookieName:           "authed",
-		cryptoCodec:          codec.NewJwtCodec("HS256"),
-		objectCodec:          codec.JSONEncoder{},
-		store:                cache.NewMemoryCache(),
+		Issuer:                  "gone.authed",
+		Audience:                []string{"app"},
+		TokenDuration:           time.Hour * 2,
+		RefreshTokenDuration:    time.Hour * 24 * 7,
+		MFADuration:             time.Minute * 5,
+		MFAMaxAttempts:          5,
+		PasswordlessDuration:    time.Minute * 15,
+		PasswordlessMaxAttempts: 5,
+		ImpersonationDuration:   time.Minute * 15,
+		APIKeyPrefix:            "gone",
+		SessionIdleTimeout:      time.Minute * 30,
+		SessionAbsoluteTimeout:  time.Hour * 24,
+		cryptoKey:               cryptoKey,
+		cookieName:              "authed",
+		cookieOptions:           cookie.DefaultOptionals(),
+		cryptoCodec:             codec.NewJwtCodec("HS256"),
+		objectCodec:             codec.JSONEncoder{},
+		store:                   cache.NewMemoryCache(),
 	}
 	for _, opt := range opts {
 		opt(s)
 	}
+	if s.apiKeys == nil {
+		s.apiKeys = NewCacheAPIKeyStore(s.store, s.cookieName)
+	}
 	return s
 }
 
@@ -135,38 +205,65 @@ func (s *Authed) NewClaims(subject string, se *UserSession, duration time.Durati
 		UserSession: se,
 	}
 }
+
+// GetHTTPSession 依次尝试自定义认证器、API Key、服务端会话或令牌，失败时返回nil，
+// 失败原因通过WithOnTokenRejected回调获取
 func (s *Authed) GetHTTPSession(req *http.Request) (se *UserSession) {
-	var (
-		payload    = Payload{}
-		err        error
-		headerAuth = req.Header.Get("Authorization")
-	)
-	const basicPrefix = "Basic "
-	const BearerPrefix = "Bearer "
-	cookieAuth := cookie.GetValue(req, s.cookieName)
-	if (cookieAuth == "" && headerAuth == "") || strings.HasPrefix(headerAuth, basicPrefix) {
+	se, err := s.getHTTPSession(req)
+	if err != nil {
+		s.auditRejected(req, err)
+		if s.onTokenRejected != nil {
+			s.onTokenRejected(req, err)
+		}
 		return nil
 	}
-	authToken := strings.TrimPrefix(headerAuth, BearerPrefix)
+	if s.onTokenVerified != nil {
+		s.onTokenVerified(req, se)
+	}
+	return se
+}
+
+func (s *Authed) getHTTPSession(req *http.Request) (*UserSession, error) {
+	if se, err := s.authenticate(req); !errors.Is(err, ErrorNoCredentials) {
+		return se, err
+	}
+	if apiKey := getAPIKeyFromRequest(req); apiKey != "" {
+		key, err := s.VerifyAPIKey(apiKey)
+		if err != nil {
+			return nil, err
+		}
+		return s.APIKeySession(key), nil
+	}
+	if s.serverSession {
+		return s.getServerSession(req)
+	}
+	authToken := s.extractToken(req)
 	if authToken == "" {
-		authToken = cookieAuth
+		return nil, ErrorTokenNotFound
 	}
-	payload, err = s.verifyToken(authToken)
+	payload, err := s.verifyToken(authToken)
 	if err != nil {
-		return
+		return nil, err
 	}
 	if payload.UserSession == nil {
-		return
+		return nil, ErrorInvalidPayload
 	}
-	se = payload.UserSession
-	return
+	return payload.UserSession, nil
 }
 func (s *Authed) CreateToken(se *UserSession) (token, refresh string, err error) {
+	return s.issueToken(nil, se)
+}
+
+func (s *Authed) issueToken(req *http.Request, se *UserSession) (token, refresh string, err error) {
 	if se == nil {
 		err = ErrorInvalidSession
 		return
 	}
 	token, refresh, err = s.createToken(s.NewClaims(SubjectTypeAuthToken, se, s.TokenDuration))
+	if err != nil {
+		return
+	}
+	s.Audit(req, AuditTokenIssued, se, nil)
 	return
 }
 func (s *Authed) createToken(payload *Payload) (token, refresh string, err error) {
@@ -200,19 +297,34 @@ func (s *Authed) createToken(payload *Payload) (token, refresh string, err error
 }
 
 func (s *Authed) DeleteToken(id string) (err error) {
+	return s.deleteToken(nil, id)
+}
+
+func (s *Authed) deleteToken(req *http.Request, id string) (err error) {
+	// 删除前读取会话，审计事件需要用户信息
+	se := &UserSession{ID: id}
+	if tokenBytes, e := s.store.Get(s.FormatTokenStoreKey(id)); e == nil && len(tokenBytes) > 0 {
+		if payload, e := s.decodePayload(tokenBytes); e == nil && payload.UserSession != nil {
+			se = payload.UserSession
+		}
+	}
 	var freshTokenByte []byte
 	freshTokenByte, err = s.store.Get(s.FormatLinkTokenStoreKey(id))
-	if err != nil {
-		return
-	}
-	err = s.store.Del(string(freshTokenByte))
-	if err != nil {
-		return
+	if err == nil && len(freshTokenByte) > 0 {
+		err = s.store.Del(s.FormatRefreshTokenStoreKey(string(freshTokenByte)))
+		if err != nil {
+			return
+		}
+		err = s.store.Del(s.FormatLinkTokenStoreKey(id))
+		if err != nil {
+			return
+		}
 	}
 	err = s.store.Del(s.FormatTokenStoreKey(id))
 	if err != nil {
 		return
 	}
+	s.Audit(req, AuditTokenRevoked, se, nil)
 	return
 }
 
@@ -222,6 +334,15 @@ func (s *Authed) DeleteTokenOnly(id string) (err error) {
 }
 
 func (s *Authed) RefreshToken(refreshToken string) (token, refresh string, err error) {
+	return s.refreshToken(nil, refreshToken)
+}
+
+// RefreshHTTPToken 同RefreshToken，审计事件记录请求的客户端信息
+func (s *Authed) RefreshHTTPToken(req *http.Request, refreshToken string) (token, refresh string, err error) {
+	return s.refreshToken(req, refreshToken)
+}
+
+func (s *Authed) refreshToken(req *http.Request, refreshToken string) (token, refresh string, err error) {
 	if refreshToken == "" {
 		err = ErrorInvalidRefreshToken
 		return
@@ -231,18 +352,38 @@ func (s *Authed) RefreshToken(refreshToken string) (token, refresh string, err e
 	if err != nil {
 		return
 	}
-	var plainByte []byte
-	plainByte, err = s.cryptoCodec.Decode(s.cryptoKey, tokenBytes)
+	var payload Payload
+	payload, err = s.decodePayload(tokenBytes)
 	if err != nil {
 		return
 	}
-	var payload Payload
-	err = s.objectCodec.Decode(plainByte, &payload)
+	duration := s.TokenDuration
+	if payload.UserSession != nil && payload.IsImpersonated() {
+		if s.ImpersonationDuration <= 0 {
+			err = ErrorImpersonationDenied
+			return
+		}
+		if s.ImpersonationDuration < duration {
+			duration = s.ImpersonationDuration
+		}
+	}
+	payload.SetExpired(core.Now().Add(duration))
+	token, refresh, err = s.createToken(&payload)
 	if err != nil {
 		return
 	}
-	payload.SetExpired(core.Now().Add(s.TokenDuration))
-	token, refresh, err = s.createToken(&payload)
+	s.Audit(req, AuditTokenRefreshed, payload.UserSession, nil)
+	return
+}
+
+// decodePayload 解密存储中保存的令牌
+func (s *Authed) decodePayload(token []byte) (payload Payload, err error) {
+	var plainByte []byte
+	plainByte, err = s.cryptoCodec.Decode(s.cryptoKey, token)
+	if err != nil {
+		return
+	}
+	err = s.objectCodec.Decode(plainByte, &payload)
 	return
 }
 func (s *Authed) VerifyToken(token string) (payload Payload, err error) {
@@ -280,19 +421,62 @@ func (s *Authed) verifyToken(token string) (payload Payload, err error) {
 	}
 	return
 }
-func (s *Authed) SetCookieToken(w http.ResponseWriter, value string, maxAge int) {
-	s.SetCookie(w, s.cookieName, value, maxAge)
-}
-func (s *Authed) SetCookie(w http.ResponseWriter, key, value string, maxAge int) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     key,
-		Value:    url.QueryEscape(value),
-		Path:     "/",
-		Domain:   "",
-		Expires:  time.Now().Add(time.Duration(maxAge)).UTC(),
-		MaxAge:   maxAge,
-		Secure:   false,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	})
+func (s *Authed) SetCookieToken(w http.ResponseWriter, value string, maxAge int) error {
+	return s.SetCookie(w, s.cookieName, value, maxAge)
+}
+
+// SetCookie 按WithCookieOptions的属性写入cookie，maxAge单位为秒，超过4KB的值会分块保存，
+// 超过分块上限时返回cookie.ErrValueTooLong
+func (s *Authed) SetCookie(w http.ResponseWriter, key, value string, maxAge int) error {
+	return cookie.SetWith(w, key, value, maxAge, s.cookieOptions)
+}
+
+func (s *Authed) cookieValue(req *http.Request) string {
+	return cookie.GetValueWith(req, s.cookieName, s.cookieOptions)
+}
+
+// DeleteCookieToken 删除令牌cookie及其分块
+func (s *Authed) DeleteCookieToken(w http.ResponseWriter, req *http.Request) {
+	cookie.DeleteWith(w, req, s.cookieName, s.cookieOptions)
+}
+
+// randomToken 生成n字节安全随机数的base64url编码，用于不可猜测的凭证
+func randomToken(n int) string {
+	return base64.RawURLEncoding.EncodeToString(osutil.RandBytes(n))
+}
+
+// keyLocker 按key加锁，用于缓存上"读取-修改-写入"的操作。
+// cache.Cache没有原子操作，多实例部署时仍然存在并发窗口
+type keyLocker struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// Lock 锁定key，返回解锁函数
+func (l *keyLocker) Lock(key string) (unlock func()) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*keyLock{}
+	}
+	k, ok := l.locks[key]
+	if !ok {
+		k = &keyLock{}
+		l.locks[key] = k
+	}
+	k.refs++
+	l.mu.Unlock()
+	k.Lock()
+	return func() {
+		k.Unlock()
+		l.mu.Lock()
+		if k.refs--; k.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
 }
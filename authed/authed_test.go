@@ -1,6 +1,21 @@
 package authed
 
-import "testing"
+import (
+	"context"
+	"crypto/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorpher/gone/cache"
+	"github.com/gorpher/gone/codec"
+	"github.com/gorpher/gone/cryptoutil"
+	"github.com/gorpher/gone/osutil"
+	"github.com/tjfoc/gmsm/sm2"
+	x509sm "github.com/tjfoc/gmsm/x509"
+)
 
 func TestCreateToken(t *testing.T) {
 	authed := NewAuthed()
@@ -18,3 +33,114 @@ func TestCreateToken(t *testing.T) {
 	}
 	t.Log(payload.GetToken())
 }
+
+func TestWrappedCryptoKey(t *testing.T) {
+	ctx := context.Background()
+	ring, err := cryptoutil.NewLocalKeyRing("app", osutil.RandBytes(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey, keyID, wrapped, err := cryptoutil.GenerateDataKey(ctx, ring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt, err := WithWrappedCryptoKey(ctx, ring, keyID, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := NewAuthed(opt, WithMultiSession()).CreateToken(&UserSession{Uid: "1001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 使用解包后的明文密钥可以验证令牌
+	if _, err = NewAuthed(WithCryptoKey(dataKey), WithMultiSession()).VerifyToken(token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewAuthed(WithMultiSession()).VerifyToken(token); err == nil {
+		t.Fatal("token verified with default key")
+	}
+	if _, err = WithWrappedCryptoKey(ctx, ring, keyID, wrapped[1:]); err == nil {
+		t.Fatal("corrupted wrapped key accepted")
+	}
+}
+
+func TestCreateTokenJwe(t *testing.T) {
+	signKey := []byte("0123456789abcdef0123456789abcdef")
+	authed := NewAuthed(WithJweCode("dir", "A256GCM", codec.WithJweNested(codec.NewJwtCodec("HS256"), signKey)))
+	token, _, err := authed.CreateToken(&UserSession{
+		Uid:     "u1",
+		Extends: map[string]any{"role": "admin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(token, ".") != 4 {
+		t.Fatalf("not a compact jwe: %s", token)
+	}
+	payload, err := authed.VerifyToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.UserSession == nil || payload.Uid != "u1" || payload.Extends["role"] != "admin" {
+		t.Fatalf("unexpected payload %+v", payload)
+	}
+}
+
+func TestCreateTokenSM(t *testing.T) {
+	priv, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPEM, err := x509sm.WritePrivateKeyToPem(priv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range [][]OptFunc{
+		{WithJwtCode("SM2SM3"), WithCryptoKey(privPEM)},
+		{WithJwtCode("HMAC-SM3")},
+		{WithCookieCode([]byte("0123456789abcdef0123456789abcdef"), []byte("0123456789abcdef"), codec.WithCookieSM4())},
+	} {
+		authed := NewAuthed(opts...)
+		token, _, err := authed.CreateToken(&UserSession{Uid: "u1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload, err := authed.VerifyToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payload.UserSession == nil || payload.Uid != "u1" {
+			t.Fatalf("unexpected payload %+v", payload)
+		}
+	}
+}
+
+// slowCache 读取时增加延迟，用于暴露先读后删的并发问题
+type slowCache struct {
+	cache.Cache
+}
+
+func (c slowCache) Get(key string) ([]byte, error) {
+	b, err := c.Cache.Get(key)
+	time.Sleep(2 * time.Millisecond)
+	return b, err
+}
+
+// parallel 并发执行n次fn，返回成功的次数
+func parallel(n int, fn func() error) int {
+	var (
+		wg sync.WaitGroup
+		ok int32
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if fn() == nil {
+				atomic.AddInt32(&ok, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	return int(ok)
+}
@@ -0,0 +1,101 @@
+package authed
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// ErrorNoCredentials 请求中没有该认证方式的凭证，GetHTTPSession会继续尝试下一个认证器
+var ErrorNoCredentials = errors.New("no credentials")
+var ErrorInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator 可插拔的请求认证器
+type Authenticator interface {
+	Authenticate(req *http.Request) (*UserSession, error)
+}
+
+type AuthenticatorFunc func(req *http.Request) (*UserSession, error)
+
+func (f AuthenticatorFunc) Authenticate(req *http.Request) (*UserSession, error) {
+	return f(req)
+}
+
+// WithAuthenticator 注册认证器，GetHTTPSession按注册顺序优先于令牌认证尝试
+func WithAuthenticator(authenticators ...Authenticator) OptFunc {
+	return func(s *Authed) *Authed {
+		s.authenticators = append(s.authenticators, authenticators...)
+		return s
+	}
+}
+
+// BasicVerifyFunc 校验用户名密码，成功时返回用户会话
+type BasicVerifyFunc func(username, password string) (*UserSession, error)
+
+// BasicAuthenticator HTTP Basic认证, 参考 RFC 7617
+type BasicAuthenticator struct {
+	Realm  string
+	verify BasicVerifyFunc
+}
+
+func NewBasicAuthenticator(realm string, verify BasicVerifyFunc) *BasicAuthenticator {
+	return &BasicAuthenticator{Realm: realm, verify: verify}
+}
+
+func (b *BasicAuthenticator) Authenticate(req *http.Request) (*UserSession, error) {
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return nil, ErrorNoCredentials
+	}
+	se, err := b.verify(username, password)
+	if err != nil {
+		return nil, err
+	}
+	if se == nil {
+		return nil, ErrorInvalidCredentials
+	}
+	if se.Extends == nil {
+		se.Extends = map[string]any{}
+	}
+	se.Extends["auth"] = "basic"
+	return se, nil
+}
+
+// Challenge 写入 WWW-Authenticate 响应头和401状态码
+func (b *BasicAuthenticator) Challenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm=`+strconv.Quote(b.Realm)+`, charset="UTF-8"`)
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+// StaticBasicVerify 校验固定的用户名密码，适合内部服务之间调用
+func StaticBasicVerify(username, password string, se *UserSession) BasicVerifyFunc {
+	return func(u, p string) (*UserSession, error) {
+		userOk := subtle.ConstantTimeCompare([]byte(u), []byte(username))
+		passOk := subtle.ConstantTimeCompare([]byte(p), []byte(password))
+		if userOk&passOk != 1 {
+			return nil, ErrorInvalidCredentials
+		}
+		copied := *se
+		copied.Extends = make(map[string]any, len(se.Extends))
+		for k, v := range se.Extends {
+			copied.Extends[k] = v
+		}
+		return &copied, nil
+	}
+}
+
+// authenticate 依次尝试自定义认证器，都没有对应凭证时返回ErrorNoCredentials
+func (s *Authed) authenticate(req *http.Request) (*UserSession, error) {
+	for _, authenticator := range s.authenticators {
+		se, err := authenticator.Authenticate(req)
+		if errors.Is(err, ErrorNoCredentials) {
+			continue
+		}
+		if err == nil && se == nil {
+			err = ErrorInvalidCredentials
+		}
+		return se, err
+	}
+	return nil, ErrorNoCredentials
+}
@@ -0,0 +1,104 @@
+package authed
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorpher/gone/cache"
+)
+
+func TestBasicAuthenticator(t *testing.T) {
+	basic := NewBasicAuthenticator("internal", StaticBasicVerify("svc", "secret", &UserSession{Uid: "svc"}))
+	a := NewAuthed(WithAuthenticator(basic))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("svc", "secret")
+	se := a.GetHTTPSession(req)
+	if se == nil || se.Uid != "svc" || se.Extends["auth"] != "basic" {
+		t.Fatalf("unexpected session %+v", se)
+	}
+	req.SetBasicAuth("svc", "wrong")
+	if se = a.GetHTTPSession(req); se != nil {
+		t.Fatal("wrong password accepted")
+	}
+
+	w := httptest.NewRecorder()
+	basic.Challenge(w)
+	if w.Code != http.StatusUnauthorized || !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), `Basic realm="internal"`) {
+		t.Fatalf("unexpected challenge %d %s", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestSignatureAuthenticator(t *testing.T) {
+	secret := []byte("shared-secret")
+	signer := NewSignatureAuthenticator(cache.NewMemoryCache(), func(keyID string) ([]byte, *UserSession, error) {
+		if keyID != "order-service" {
+			return nil, nil, ErrorInvalidCredentials
+		}
+		return secret, &UserSession{Uid: keyID}, nil
+	})
+	a := NewAuthed(WithAuthenticator(signer))
+
+	var replay *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		se := a.GetHTTPSession(r)
+		if se == nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body) // nolint
+		if string(body) != `{"id":1}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		replay = r.Clone(r.Context())
+		_, _ = w.Write([]byte(se.Uid))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &SignatureTransport{KeyID: "order-service", Secret: secret, SignedHeaders: []string{"Content-Type"}}}
+	resp, err := client.Post(srv.URL+"/orders?b=2&a=1&a=0", "application/json", strings.NewReader(`{"id":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body) // nolint
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "order-service" {
+		t.Fatalf("unexpected response %d %s", resp.StatusCode, body)
+	}
+
+	replay.Body = io.NopCloser(strings.NewReader(`{"id":1}`))
+	if _, err = signer.Authenticate(replay); !errors.Is(err, ErrorSignatureReplay) {
+		t.Fatalf("expect replay error, got %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/orders", strings.NewReader(`{"id":1}`))
+	if err = SignRequest(req, "order-service", secret); err != nil {
+		t.Fatal(err)
+	}
+	req.Body = io.NopCloser(strings.NewReader(`{"id":2}`))
+	if _, err = signer.Authenticate(req); !errors.Is(err, ErrorInvalidSignature) {
+		t.Fatalf("tampered body accepted: %v", err)
+	}
+
+	req = httptest.NewRequest("GET", "/orders?a=1", nil)
+	if err = SignRequest(req, "order-service", secret); err != nil {
+		t.Fatal(err)
+	}
+	req.URL.RawQuery = "a=2"
+	if _, err = signer.Authenticate(req); !errors.Is(err, ErrorInvalidSignature) {
+		t.Fatalf("tampered query accepted: %v", err)
+	}
+	signer.MaxBodySize = 8
+	req = httptest.NewRequest("POST", "/orders", strings.NewReader(`{"id":100}`))
+	if err = SignRequest(req, "order-service", secret); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = signer.Authenticate(req); !errors.Is(err, ErrorSignatureBodyTooLarge) {
+		t.Fatalf("oversized body accepted: %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package authed
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorpher/gone/codec"
+	"github.com/gorpher/gone/cookie"
+	"github.com/gorpher/gone/httputil"
+	"github.com/gorpher/gone/osutil"
+)
+
+/*
+CSRF防护:
+1. 密钥随机生成后加密保存在HttpOnly cookie中，加密密钥默认每个实例随机生成，多实例部署使用WithCSRFCookieCodec设置相同的密钥，
+   只从cookie读取，不接受同名请求头
+2. 下发给页面的令牌为 随机掩码+掩码异或密钥, 每次下发都不同, 避免BREACH类压缩侧信道
+3. 非安全方法必须在 X-CSRF-Token 请求头或表单字段中携带令牌, 并校验 Origin/Referer 与当前站点一致
+*/
+
+const csrfSecretLength = 32
+
+var ErrorCSRFTokenMissing = errors.New("csrf token missing")
+var ErrorCSRFTokenInvalid = errors.New("csrf token invalid")
+var ErrorCSRFOrigin = errors.New("csrf origin not allowed")
+
+type csrfContextKey struct{}
+
+type CSRF struct {
+	CookieName     string
+	HeaderName     string
+	FieldName      string
+	MaxAge         int // cookie有效期，单位秒
+	TrustedOrigins []string
+	exempt         []string
+	errorHandler   func(w http.ResponseWriter, req *http.Request, err error)
+	cookieOptions  *cookie.Optionals
+	cryptoCodec    codec.CryptoCodec
+}
+
+type CSRFOptFunc func(c *CSRF) *CSRF
+
+// WithCSRFExempt 豁免的路径，以*结尾时按前缀匹配
+func WithCSRFExempt(paths ...string) CSRFOptFunc {
+	return func(c *CSRF) *CSRF {
+		c.exempt = append(c.exempt, paths...)
+		return c
+	}
+}
+
+// WithCSRFTrustedOrigins 额外信任的来源，例如 https://admin.example.com
+func WithCSRFTrustedOrigins(origins ...string) CSRFOptFunc {
+	return func(c *CSRF) *CSRF {
+		c.TrustedOrigins = append(c.TrustedOrigins, origins...)
+		return c
+	}
+}
+
+func WithCSRFCookieName(name string) CSRFOptFunc {
+	return func(c *CSRF) *CSRF {
+		c.CookieName = name
+		return c
+	}
+}
+
+// WithCSRFCookieOptions 设置密钥cookie的属性，Secure且没有设置前缀时使用__Host-前缀，
+// 避免同一站点的其他子域写入密钥cookie
+func WithCSRFCookieOptions(o cookie.Optionals) CSRFOptFunc {
+	return func(c *CSRF) *CSRF {
+		c.cookieOptions = &o
+		return c
+	}
+}
+
+// WithCSRFCookieCodec 设置加密密钥cookie的密钥，opts可以选择codec.WithCookieSM4等分组密码
+func WithCSRFCookieCodec(hashKey, blockKey []byte, opts ...codec.CookieCodecOptFunc) CSRFOptFunc {
+	return func(c *CSRF) *CSRF {
+		c.cryptoCodec = codec.NewCookieCodec(hashKey, blockKey, opts...)
+		return c
+	}
+}
+
+func WithCSRFErrorHandler(h func(w http.ResponseWriter, req *http.Request, err error)) CSRFOptFunc {
+	return func(c *CSRF) *CSRF {
+		c.errorHandler = h
+		return c
+	}
+}
+
+func NewCSRF(opts ...CSRFOptFunc) *CSRF {
+	c := &CSRF{
+		CookieName: "_csrf",
+		HeaderName: "X-CSRF-Token",
+		FieldName:  "csrf_token",
+		MaxAge:     12 * 3600,
+		errorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		},
+		cookieOptions: cookie.DefaultOptionals(),
+		cryptoCodec:   codec.NewCookieCodec(osutil.RandBytes(32), osutil.RandBytes(32)),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.cookieOptions.Secure && c.cookieOptions.Prefix == cookie.PrefixNone {
+		c.cookieOptions.Prefix = cookie.PrefixHost
+	}
+	return c
+}
+
+// Handler net/http中间件，校验通过后可以使用 CSRFToken(req) 获取下发给页面的令牌
+func (c *CSRF) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, err := c.Check(w, req)
+		if err != nil {
+			c.errorHandler(w, req, err)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), csrfContextKey{}, token)))
+	})
+}
+
+// Check 校验请求并返回新的掩码令牌，cookie中没有密钥时会生成并写入响应
+func (c *CSRF) Check(w http.ResponseWriter, req *http.Request) (token string, err error) {
+	secret := c.readSecret(req)
+	if len(secret) != csrfSecretLength {
+		secret = osutil.RandBytes(csrfSecretLength)
+		if err = c.writeSecret(w, secret); err != nil {
+			return
+		}
+	}
+	token = maskCSRFToken(secret)
+	w.Header().Add("Vary", "Cookie")
+	w.Header().Set(c.HeaderName, token)
+	if isSafeMethod(req.Method) || c.isExempt(req.URL.Path) {
+		return
+	}
+	if err = c.checkOrigin(req); err != nil {
+		return
+	}
+	sent := req.Header.Get(c.HeaderName)
+	if sent == "" {
+		sent = req.PostFormValue(c.FieldName)
+	}
+	if sent == "" {
+		err = ErrorCSRFTokenMissing
+		return
+	}
+	if subtle.ConstantTimeCompare(unmaskCSRFToken(sent), secret) != 1 {
+		err = ErrorCSRFTokenInvalid
+	}
+	return
+}
+
+// readSecret 只从cookie读取密钥
+func (c *CSRF) readSecret(req *http.Request) []byte {
+	value := cookie.GetValueWith(req, c.CookieName, c.cookieOptions)
+	if value == "" {
+		return nil
+	}
+	secret, err := c.cryptoCodec.Decode([]byte(c.CookieName), []byte(value))
+	if err != nil {
+		return nil
+	}
+	return secret
+}
+
+func (c *CSRF) writeSecret(w http.ResponseWriter, secret []byte) error {
+	value, err := c.cryptoCodec.Encode([]byte(c.CookieName), secret)
+	if err != nil {
+		return err
+	}
+	return cookie.SetWith(w, c.CookieName, string(value), c.MaxAge, c.cookieOptions)
+}
+
+// CSRFToken 返回中间件写入请求上下文的令牌，用于渲染表单隐藏字段
+func CSRFToken(req *http.Request) string {
+	token, _ := req.Context().Value(csrfContextKey{}).(string) // nolint
+	return token
+}
+
+func (c *CSRF) isExempt(path string) bool {
+	for _, p := range c.exempt {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CSRF) checkOrigin(req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		referer := req.Header.Get("Referer")
+		if referer == "" {
+			// 非浏览器客户端不会携带来源，由令牌校验兜底
+			return nil
+		}
+		u, err := url.Parse(referer)
+		if err != nil || u.Host == "" {
+			return ErrorCSRFOrigin
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+	if strings.EqualFold(origin, httputil.GetOrigin(req)) {
+		return nil
+	}
+	for _, trusted := range c.TrustedOrigins {
+		if strings.EqualFold(origin, trusted) {
+			return nil
+		}
+	}
+	return ErrorCSRFOrigin
+}
+
+func maskCSRFToken(secret []byte) string {
+	mask := osutil.RandBytes(len(secret))
+	token := make([]byte, 2*len(secret))
+	copy(token, mask)
+	for i := range secret {
+		token[len(secret)+i] = mask[i] ^ secret[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+func unmaskCSRFToken(token string) []byte {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) != 2*csrfSecretLength {
+		return nil
+	}
+	secret := make([]byte, csrfSecretLength)
+	for i := range secret {
+		secret[i] = data[i] ^ data[csrfSecretLength+i]
+	}
+	return secret
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package authed
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorpher/gone/cookie"
+)
+
+func TestCSRF(t *testing.T) {
+	c := NewCSRF(WithCSRFExempt("/webhook/*"))
+	h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte(CSRFToken(req)))
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/form", nil))
+	if w.Code != http.StatusOK || w.Body.String() == "" {
+		t.Fatalf("unexpected response %d", w.Code)
+	}
+	cookies := w.Result().Cookies()
+	token := w.Body.String()
+
+	post := func(header string, form url.Values, origin string) int {
+		req := httptest.NewRequest("POST", "http://example.com/form", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, ck := range cookies {
+			req.AddCookie(ck)
+		}
+		if header != "" {
+			req.Header.Set("X-CSRF-Token", header)
+		}
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := post(token, nil, "http://example.com"); code != http.StatusOK {
+		t.Fatalf("header token rejected: %d", code)
+	}
+	if code := post("", url.Values{"csrf_token": {token}}, ""); code != http.StatusOK {
+		t.Fatalf("form token rejected: %d", code)
+	}
+	if code := post("", nil, ""); code != http.StatusForbidden {
+		t.Fatalf("missing token accepted: %d", code)
+	}
+	if code := post(maskCSRFToken(make([]byte, csrfSecretLength)), nil, ""); code != http.StatusForbidden {
+		t.Fatalf("forged token accepted: %d", code)
+	}
+	if code := post(token, nil, "http://evil.com"); code != http.StatusForbidden {
+		t.Fatalf("cross origin accepted: %d", code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "http://example.com/webhook/github", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("exempt route rejected: %d", w.Code)
+	}
+}
+
+func TestCSRFOrigin(t *testing.T) {
+	c := NewCSRF(WithCSRFTrustedOrigins("https://admin.example.com"))
+	req := httptest.NewRequest("POST", "http://example.com/", nil)
+	req.Header.Set("Referer", "https://admin.example.com/users")
+	if err := c.checkOrigin(req); err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Referer", "https://example.com.evil.com/")
+	if err := c.checkOrigin(req); !errors.Is(err, ErrorCSRFOrigin) {
+		t.Fatalf("expect origin error, got %v", err)
+	}
+	// 服务自己终止TLS
+	req = httptest.NewRequest("POST", "https://example.com/", nil)
+	req.Header.Set("Origin", "https://example.com")
+	if err := c.checkOrigin(req); err != nil {
+		t.Fatalf("same-origin https request rejected: %v", err)
+	}
+	req.Header.Set("Origin", "http://example.com")
+	if err := c.checkOrigin(req); !errors.Is(err, ErrorCSRFOrigin) {
+		t.Fatalf("scheme downgrade accepted: %v", err)
+	}
+}
+
+func TestCSRFSecretCookie(t *testing.T) {
+	c := NewCSRF(WithCSRFCookieOptions(cookie.Optionals{Path: "/", HTTPOnly: true, Secure: true, SameSite: http.SameSiteLaxMode}))
+	w := httptest.NewRecorder()
+	if _, err := c.Check(w, httptest.NewRequest("GET", "https://example.com/", nil)); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "__Host-_csrf" || !cookies[0].Secure || cookies[0].Path != "/" {
+		t.Fatalf("unexpected secret cookie %+v", cookies)
+	}
+
+	secret := make([]byte, csrfSecretLength)
+	check := func(req *http.Request) error {
+		req.Header.Set("X-CSRF-Token", maskCSRFToken(secret))
+		_, err := c.Check(httptest.NewRecorder(), req)
+		return err
+	}
+	// 使用cookie包公开的默认密钥加密的密钥不被接受
+	w = httptest.NewRecorder()
+	if err := cookie.SetCryptoCookie(w, "__Host-_csrf", string(secret), 0); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "https://example.com/", nil)
+	req.AddCookie(w.Result().Cookies()[0])
+	if err := check(req); !errors.Is(err, ErrorCSRFTokenInvalid) {
+		t.Fatalf("secret encrypted with the default cookie key accepted: %v", err)
+	}
+	// 请求头不能提供密钥
+	value, err := c.cryptoCodec.Encode([]byte(c.CookieName), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest("POST", "https://example.com/", nil)
+	req.Header.Set(c.CookieName, string(value))
+	if err = check(req); !errors.Is(err, ErrorCSRFTokenInvalid) {
+		t.Fatalf("secret from request header accepted: %v", err)
+	}
+	// 同一实例写入的cookie可以通过
+	req = httptest.NewRequest("POST", "https://example.com/", nil)
+	req.AddCookie(&http.Cookie{Name: "__Host-_csrf", Value: string(value)})
+	if err = check(req); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,139 @@
+package authed
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorpher/gone/cookie"
+)
+
+// ErrorTokenNotFound 请求中没有携带令牌
+var ErrorTokenNotFound = errors.New("token not found")
+
+// TokenExtractor 从请求中读取令牌，没有时返回空字符串
+type TokenExtractor interface {
+	ExtractToken(req *http.Request) string
+}
+
+type TokenExtractorFunc func(req *http.Request) string
+
+func (f TokenExtractorFunc) ExtractToken(req *http.Request) string {
+	return f(req)
+}
+
+// ChainExtractor 按顺序尝试，返回第一个非空令牌
+func ChainExtractor(extractors ...TokenExtractor) TokenExtractor {
+	return TokenExtractorFunc(func(req *http.Request) string {
+		for _, e := range extractors {
+			if token := e.ExtractToken(req); token != "" {
+				return token
+			}
+		}
+		return ""
+	})
+}
+
+// BearerExtractor 读取 Authorization: Bearer <token>，不带认证方案的值按令牌原样返回
+func BearerExtractor() TokenExtractor {
+	return TokenExtractorFunc(func(req *http.Request) string {
+		auth := req.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") {
+			return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		}
+		if strings.Contains(auth, " ") {
+			// Basic、ApiKey等其他认证方案
+			return ""
+		}
+		return auth
+	})
+}
+
+// HeaderExtractor 读取自定义请求头，prefix不为空时必须以prefix开头
+func HeaderExtractor(name, prefix string) TokenExtractor {
+	return TokenExtractorFunc(func(req *http.Request) string {
+		value := req.Header.Get(name)
+		if prefix != "" && !strings.HasPrefix(value, prefix) {
+			return ""
+		}
+		return strings.TrimSpace(strings.TrimPrefix(value, prefix))
+	})
+}
+
+// QueryExtractor 读取查询参数，用于无法设置请求头的WebSocket、SSE连接
+func QueryExtractor(param string) TokenExtractor {
+	return TokenExtractorFunc(func(req *http.Request) string {
+		return req.URL.Query().Get(param)
+	})
+}
+
+// CookieExtractor 按顺序读取多个cookie，o为nil时使用cookie包的默认选项
+func CookieExtractor(o *cookie.Optionals, names ...string) TokenExtractor {
+	return TokenExtractorFunc(func(req *http.Request) string {
+		for _, name := range names {
+			if v := cookie.GetValueWith(req, name, o); v != "" {
+				return v
+			}
+		}
+		return ""
+	})
+}
+
+// WebSocketProtocolExtractor 从 Sec-WebSocket-Protocol 读取令牌，支持两种约定:
+// 1. 子协议列表中marker之后的一项，例如 "access_token, <token>"
+// 2. 以 marker+"." 开头的子协议，例如 "access_token.<token>"
+func WebSocketProtocolExtractor(marker string) TokenExtractor {
+	return TokenExtractorFunc(func(req *http.Request) string {
+		var protocols []string
+		for _, v := range req.Header.Values("Sec-WebSocket-Protocol") {
+			for _, p := range strings.Split(v, ",") {
+				protocols = append(protocols, strings.TrimSpace(p))
+			}
+		}
+		for i, p := range protocols {
+			if p == marker && i+1 < len(protocols) {
+				return protocols[i+1]
+			}
+			if strings.HasPrefix(p, marker+".") {
+				return strings.TrimPrefix(p, marker+".")
+			}
+		}
+		return ""
+	})
+}
+
+// WithTokenExtractors 替换默认的令牌读取顺序(Bearer请求头、cookie)
+func WithTokenExtractors(extractors ...TokenExtractor) OptFunc {
+	return func(s *Authed) *Authed {
+		s.extractor = ChainExtractor(extractors...)
+		return s
+	}
+}
+
+// WithOnTokenVerified 认证成功时回调
+func WithOnTokenVerified(fn func(req *http.Request, se *UserSession)) OptFunc {
+	return func(s *Authed) *Authed {
+		s.onTokenVerified = fn
+		return s
+	}
+}
+
+// WithOnTokenRejected 认证失败时回调，reason为失败原因，请求未携带凭证时为ErrorTokenNotFound
+func WithOnTokenRejected(fn func(req *http.Request, reason error)) OptFunc {
+	return func(s *Authed) *Authed {
+		s.onTokenRejected = fn
+		return s
+	}
+}
+
+// CookieTokenExtractor 读取令牌cookie，使用WithCookieOptions设置的属性
+func (s *Authed) CookieTokenExtractor() TokenExtractor {
+	return TokenExtractorFunc(s.cookieValue)
+}
+
+func (s *Authed) extractToken(req *http.Request) string {
+	if s.extractor == nil {
+		return ChainExtractor(BearerExtractor(), s.CookieTokenExtractor()).ExtractToken(req)
+	}
+	return s.extractor.ExtractToken(req)
+}
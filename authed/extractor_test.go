@@ -0,0 +1,70 @@
+package authed
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorpher/gone/cookie"
+)
+
+func TestTokenExtractors(t *testing.T) {
+	testCases := []struct {
+		name      string
+		extractor TokenExtractor
+		setup     func(req *http.Request)
+		want      string
+	}{
+		{"bearer", BearerExtractor(), func(r *http.Request) { r.Header.Set("Authorization", "Bearer abc") }, "abc"},
+		{"raw", BearerExtractor(), func(r *http.Request) { r.Header.Set("Authorization", "abc") }, "abc"},
+		{"basic", BearerExtractor(), func(r *http.Request) { r.SetBasicAuth("u", "p") }, ""},
+		{"header", HeaderExtractor("X-Token", "Token "), func(r *http.Request) { r.Header.Set("X-Token", "Token abc") }, "abc"},
+		{"query", QueryExtractor("access_token"), func(r *http.Request) { r.URL.RawQuery = "access_token=abc" }, "abc"},
+		{"cookies", CookieExtractor(nil, "a", "b"), func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "b", Value: "abc"}) }, "abc"},
+		{"ws list", WebSocketProtocolExtractor("access_token"), func(r *http.Request) {
+			r.Header.Set("Sec-WebSocket-Protocol", "chat, access_token, abc")
+		}, "abc"},
+		{"ws dotted", WebSocketProtocolExtractor("access_token"), func(r *http.Request) {
+			r.Header.Set("Sec-WebSocket-Protocol", "access_token.abc, chat")
+		}, "abc"},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", "/", nil)
+		tc.setup(req)
+		if got := tc.extractor.ExtractToken(req); got != tc.want {
+			t.Errorf("%s: want %q got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestTokenHooks(t *testing.T) {
+	var verified *UserSession
+	var reason error
+	a := NewAuthed(
+		WithTokenExtractors(QueryExtractor("token"), CookieExtractor(&cookie.Optionals{Prefix: cookie.PrefixHost}, "authed")),
+		WithOnTokenVerified(func(req *http.Request, se *UserSession) { verified = se }),
+		WithOnTokenRejected(func(req *http.Request, err error) { reason = err }),
+	)
+	token, _, err := a.CreateToken(&UserSession{Uid: "1001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/ws?token="+token, nil)
+	if se := a.GetHTTPSession(req); se == nil || verified == nil || verified.Uid != "1001" {
+		t.Fatalf("query token not accepted: %+v", se)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if se := a.GetHTTPSession(req); se != nil || !errors.Is(reason, ErrorTokenNotFound) {
+		t.Fatalf("bearer should not be used, reason %v", reason)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "__Host-authed", Value: token + "x"})
+	if se := a.GetHTTPSession(req); se != nil || reason == nil || errors.Is(reason, ErrorTokenNotFound) {
+		t.Fatalf("expect verification failure reason, got %v", reason)
+	}
+}
@@ -0,0 +1,45 @@
+package authed
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var ErrorImpersonationDenied = errors.New("impersonation denied")
+
+// Impersonate 管理员以目标用户身份登录，令牌携带act声明标识管理员，有效期为ImpersonationDuration，
+// 代理会话不能再次发起代理，刷新后有效期也不会超过ImpersonationDuration，ImpersonationDuration不大于0时不允许代理
+func (s *Authed) Impersonate(admin *UserSession, target *UserSession) (token, refresh string, err error) {
+	return s.impersonate(nil, admin, target)
+}
+
+// ImpersonateHTTP 同Impersonate，审计事件记录请求的客户端信息
+func (s *Authed) ImpersonateHTTP(req *http.Request, admin *UserSession, target *UserSession) (token, refresh string, err error) {
+	return s.impersonate(req, admin, target)
+}
+
+func (s *Authed) impersonate(req *http.Request, admin *UserSession, target *UserSession) (token, refresh string, err error) {
+	if admin == nil || target == nil {
+		err = ErrorInvalidSession
+		return
+	}
+	if admin.IsImpersonated() || admin.Uid == "" || admin.Uid == target.Uid || s.ImpersonationDuration <= 0 {
+		err = ErrorImpersonationDenied
+		return
+	}
+	se := *target
+	se.ID = ""
+	se.ExpiredAt = time.Now().Add(s.ImpersonationDuration).Unix()
+	se.Act = &Actor{Subject: admin.Uid, Username: admin.Username, SessionID: admin.ID}
+	se.Extends = make(map[string]any, len(target.Extends))
+	for k, v := range target.Extends {
+		se.Extends[k] = v
+	}
+	token, refresh, err = s.issueToken(req, &se)
+	if err != nil {
+		return
+	}
+	s.Audit(req, AuditImpersonate, &se, nil)
+	return
+}
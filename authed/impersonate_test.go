@@ -0,0 +1,83 @@
+package authed
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestImpersonate(t *testing.T) {
+	sink := NewMemoryAuditSink()
+	a := NewAuthed(WithAuditSink(sink))
+	admin := &UserSession{ID: "s1", Uid: "1", Username: "admin", Roles: []string{"admin"}}
+	target := &UserSession{Uid: "1001", Username: "tom"}
+
+	token, refresh, err := a.Impersonate(admin, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := a.VerifyToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	se := payload.UserSession
+	if se.Uid != "1001" || !se.IsImpersonated() || se.Act.Subject != "1" || se.Act.SessionID != "s1" {
+		t.Fatalf("unexpected session %+v", se)
+	}
+	if ttl := time.Until(payload.ExpirationTime.Time); ttl <= 0 || ttl > a.ImpersonationDuration || ttl >= a.TokenDuration {
+		t.Fatalf("impersonation ttl not applied: %v", ttl)
+	}
+	if _, _, err = a.Impersonate(se, &UserSession{Uid: "1002"}); !errors.Is(err, ErrorImpersonationDenied) {
+		t.Fatalf("nested impersonation allowed: %v", err)
+	}
+	if _, _, err = a.Impersonate(admin, admin); !errors.Is(err, ErrorImpersonationDenied) {
+		t.Fatal("self impersonation allowed")
+	}
+
+	token, _, err = a.RefreshToken(refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload, err = a.VerifyToken(token); err != nil || time.Until(payload.ExpirationTime.Time) > a.ImpersonationDuration {
+		t.Fatalf("refresh extended impersonation: %v", err)
+	}
+	_, refresh, err = a.Impersonate(admin, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.ImpersonationDuration = 0
+	if _, _, err = a.Impersonate(admin, target); !errors.Is(err, ErrorImpersonationDenied) {
+		t.Fatalf("impersonation without ttl allowed: %v", err)
+	}
+	if _, _, err = a.RefreshToken(refresh); !errors.Is(err, ErrorImpersonationDenied) {
+		t.Fatalf("refresh without impersonation ttl allowed: %v", err)
+	}
+	a.ImpersonationDuration = 15 * time.Minute
+
+	var actor *Actor
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		actor = ActorFromContext(req.Context())
+		if SessionFromContext(req.Context()).Uid != "1001" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || actor == nil || actor.Username != "admin" {
+		t.Fatalf("unexpected response %d actor %+v", w.Code, actor)
+	}
+
+	var found bool
+	for _, e := range sink.Events() {
+		if e.Type == AuditImpersonate && e.Uid == "1001" && e.ActorUid == "1" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("impersonation not audited")
+	}
+}
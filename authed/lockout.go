@@ -0,0 +1,241 @@
+package authed
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorpher/gone/cache"
+)
+
+/*
+登录防爆破:
+1. 按用户名和IP分别记录失败次数，用户名第n次失败后需要等待 BaseDelay*2^(n-1)，最长MaxDelay
+2. 用户名失败MaxFailures次或IP失败IPMaxFailures次后锁定LockoutDuration
+3. 同一IP在Window内尝试的不同用户名达到StuffingThreshold个时判定为撞库并锁定该IP
+4. 登录成功后清除用户名的失败记录
+*/
+
+var ErrorTooManyAttempts = errors.New("too many attempts")
+var ErrorAccountLocked = errors.New("account temporarily locked")
+var ErrorCredentialStuffing = errors.New("credential stuffing detected")
+
+// LoginState 当前是否允许尝试登录，不允许时RetryAfter为需要等待的时间
+type LoginState struct {
+	Allowed    bool
+	RetryAfter time.Duration
+	Failures   int
+	Reason     error
+}
+
+// WriteTooManyRequests 写入429状态码和Retry-After响应头
+func (l LoginState) WriteTooManyRequests(w http.ResponseWriter) {
+	seconds := int((l.RetryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, l.Reason.Error(), http.StatusTooManyRequests)
+}
+
+type attemptState struct {
+	Failures    int      `json:"failures"`
+	LastFailure int64    `json:"last_failure"` // 单位毫秒
+	LockedUntil int64    `json:"locked_until"` // 单位毫秒
+	Stuffing    bool     `json:"stuffing,omitempty"`
+	Users       []string `json:"users,omitempty"` // IP尝试过的用户名
+}
+
+type LoginLimiter struct {
+	MaxFailures       int
+	IPMaxFailures     int
+	StuffingThreshold int
+	BaseDelay         time.Duration
+	MaxDelay          time.Duration
+	LockoutDuration   time.Duration
+	Window            time.Duration // 失败记录保留时间
+	store             cache.Cache
+	namespace         string
+	locks             keyLocker
+}
+
+type LoginLimiterOptFunc func(l *LoginLimiter) *LoginLimiter
+
+func WithLoginLimiterNamespace(namespace string) LoginLimiterOptFunc {
+	return func(l *LoginLimiter) *LoginLimiter {
+		l.namespace = namespace
+		return l
+	}
+}
+
+// WithMaxFailures 设置用户名和IP锁定前允许的失败次数
+func WithMaxFailures(user, ip int) LoginLimiterOptFunc {
+	return func(l *LoginLimiter) *LoginLimiter {
+		l.MaxFailures = user
+		l.IPMaxFailures = ip
+		return l
+	}
+}
+
+func WithLockoutDuration(d time.Duration) LoginLimiterOptFunc {
+	return func(l *LoginLimiter) *LoginLimiter {
+		l.LockoutDuration = d
+		return l
+	}
+}
+
+func NewLoginLimiter(c cache.Cache, opts ...LoginLimiterOptFunc) *LoginLimiter {
+	l := &LoginLimiter{
+		MaxFailures:       5,
+		IPMaxFailures:     20,
+		StuffingThreshold: 10,
+		BaseDelay:         time.Second,
+		MaxDelay:          time.Minute,
+		LockoutDuration:   time.Minute * 15,
+		Window:            time.Minute * 15,
+		store:             c,
+		namespace:         "authed",
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+func (l *LoginLimiter) FormatUserStoreKey(username string) string {
+	return fmt.Sprintf("%s/authed/attempts/user/%s", l.namespace, strings.ToLower(username))
+}
+
+func (l *LoginLimiter) FormatIPStoreKey(ip string) string {
+	return fmt.Sprintf("%s/authed/attempts/ip/%s", l.namespace, ip)
+}
+
+// Check 登录前检查，用户名或IP任一受限时不允许
+func (l *LoginLimiter) Check(username, ip string) LoginState {
+	now := time.Now()
+	userState := l.load(l.FormatUserStoreKey(username))
+	ipState := l.load(l.FormatIPStoreKey(ip))
+	state := l.state(userState, now, ErrorAccountLocked, true)
+	// 同一IP可能是NAT后的多个用户，只做锁定不做退避
+	if s := l.state(ipState, now, ErrorTooManyAttempts, false); s.RetryAfter > state.RetryAfter {
+		state = s
+	}
+	return state
+}
+
+// Fail 记录一次失败并返回之后的状态，同一用户名或IP的计数在进程内串行更新，
+// 多实例部署时并发失败仍可能少计
+func (l *LoginLimiter) Fail(username, ip string) (LoginState, error) {
+	now := time.Now()
+	if err := l.failUser(username, now); err != nil {
+		return LoginState{}, err
+	}
+	if err := l.failIP(username, ip, now); err != nil {
+		return LoginState{}, err
+	}
+	return l.Check(username, ip), nil
+}
+
+func (l *LoginLimiter) failUser(username string, now time.Time) error {
+	userKey := l.FormatUserStoreKey(username)
+	unlock := l.locks.Lock(userKey)
+	defer unlock()
+	userState := l.load(userKey)
+	l.recordFailure(userState, l.MaxFailures, now)
+	return l.save(userKey, userState)
+}
+
+func (l *LoginLimiter) failIP(username, ip string, now time.Time) error {
+	ipKey := l.FormatIPStoreKey(ip)
+	unlock := l.locks.Lock(ipKey)
+	defer unlock()
+	ipState := l.load(ipKey)
+	l.recordFailure(ipState, l.IPMaxFailures, now)
+	name := strings.ToLower(username)
+	if !containsString(ipState.Users, name) && len(ipState.Users) < l.StuffingThreshold {
+		ipState.Users = append(ipState.Users, name)
+	}
+	if l.StuffingThreshold > 0 && len(ipState.Users) >= l.StuffingThreshold {
+		ipState.Stuffing = true
+		ipState.LockedUntil = now.Add(l.LockoutDuration).UnixMilli()
+	}
+	return l.save(ipKey, ipState)
+}
+
+// Success 登录成功后清除用户名的失败记录，IP的记录保留到过期以免撞库时被有效账号重置
+func (l *LoginLimiter) Success(username string) error {
+	return l.store.Del(l.FormatUserStoreKey(username))
+}
+
+// Delay 第failures次失败后需要等待的时间
+func (l *LoginLimiter) Delay(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	d := l.BaseDelay
+	for i := 1; i < failures; i++ {
+		d *= 2
+		if d >= l.MaxDelay {
+			return l.MaxDelay
+		}
+	}
+	return d
+}
+
+func (l *LoginLimiter) recordFailure(st *attemptState, maxFailures int, now time.Time) {
+	st.Failures++
+	st.LastFailure = now.UnixMilli()
+	if maxFailures > 0 && st.Failures >= maxFailures {
+		st.LockedUntil = now.Add(l.LockoutDuration).UnixMilli()
+	}
+}
+
+func (l *LoginLimiter) state(st *attemptState, now time.Time, lockedReason error, backoff bool) LoginState {
+	state := LoginState{Allowed: true, Failures: st.Failures}
+	if until := time.UnixMilli(st.LockedUntil); now.Before(until) {
+		state.Allowed = false
+		state.RetryAfter = until.Sub(now)
+		state.Reason = lockedReason
+		if st.Stuffing {
+			state.Reason = ErrorCredentialStuffing
+		}
+		return state
+	}
+	if !backoff {
+		return state
+	}
+	if next := time.UnixMilli(st.LastFailure).Add(l.Delay(st.Failures)); st.Failures > 0 && now.Before(next) {
+		state.Allowed = false
+		state.RetryAfter = next.Sub(now)
+		state.Reason = ErrorTooManyAttempts
+	}
+	return state
+}
+
+func (l *LoginLimiter) load(key string) *attemptState {
+	st := &attemptState{}
+	data, err := l.store.Get(key)
+	if err != nil || len(data) == 0 {
+		return st
+	}
+	if json.Unmarshal(data, st) != nil {
+		return &attemptState{}
+	}
+	return st
+}
+
+func (l *LoginLimiter) save(key string, st *attemptState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	ttl := l.Window
+	if l.LockoutDuration > ttl {
+		ttl = l.LockoutDuration
+	}
+	return l.store.SetWithTTL(key, string(data), ttl)
+}
@@ -0,0 +1,78 @@
+package authed
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorpher/gone/cache"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	l := NewLoginLimiter(cache.NewMemoryCache(), WithMaxFailures(3, 100))
+	if st := l.Check("tom", "10.0.0.1"); !st.Allowed {
+		t.Fatal("fresh user should be allowed")
+	}
+	st, err := l.Fail("tom", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Allowed || st.RetryAfter <= 0 || st.RetryAfter > time.Second || !errors.Is(st.Reason, ErrorTooManyAttempts) {
+		t.Fatalf("expect backoff, got %+v", st)
+	}
+	if l.Delay(3) != 4*time.Second || l.Delay(20) != l.MaxDelay {
+		t.Fatal("unexpected backoff")
+	}
+	_, _ = l.Fail("tom", "10.0.0.1")  // nolint
+	st, _ = l.Fail("tom", "10.0.0.1") // nolint
+	if st.Allowed || !errors.Is(st.Reason, ErrorAccountLocked) || st.RetryAfter < 14*time.Minute {
+		t.Fatalf("expect lockout, got %+v", st)
+	}
+
+	w := httptest.NewRecorder()
+	st.WriteTooManyRequests(w)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "900" {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	if err = l.Success("tom"); err != nil {
+		t.Fatal(err)
+	}
+	if st = l.Check("Tom", "10.0.0.1"); !st.Allowed {
+		t.Fatalf("success should reset user state, got %+v", st)
+	}
+}
+
+func TestLoginLimiterCredentialStuffing(t *testing.T) {
+	l := NewLoginLimiter(cache.NewMemoryCache())
+	var st LoginState
+	for i := 0; i < l.StuffingThreshold; i++ {
+		st, _ = l.Fail(fmt.Sprintf("user%d", i), "10.0.0.2") // nolint
+	}
+	if st.Allowed || !errors.Is(st.Reason, ErrorCredentialStuffing) {
+		t.Fatalf("expect credential stuffing, got %+v", st)
+	}
+	if st = l.Check("someone", "10.0.0.2"); !errors.Is(st.Reason, ErrorCredentialStuffing) {
+		t.Fatalf("ip should stay locked, got %+v", st)
+	}
+	if st = l.Check("someone", "10.0.0.3"); !st.Allowed {
+		t.Fatal("other ip should be allowed")
+	}
+}
+
+func TestLoginLimiterWindowSlides(t *testing.T) {
+	l := NewLoginLimiter(cache.NewMemoryCache(), WithMaxFailures(100, 100), WithLockoutDuration(300*time.Millisecond))
+	l.Window = 300 * time.Millisecond
+	l.BaseDelay = time.Millisecond
+	_, _ = l.Fail("tom", "10.0.0.3") // nolint
+	time.Sleep(200 * time.Millisecond)
+	_, _ = l.Fail("tom", "10.0.0.3") // nolint
+	// 超过第一次失败的过期时间，第二次失败重新计时
+	time.Sleep(200 * time.Millisecond)
+	if st := l.Check("tom", "10.0.0.3"); st.Failures != 2 {
+		t.Fatalf("failures dropped by stale expiry, got %+v", st)
+	}
+}
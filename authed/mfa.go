@@ -0,0 +1,171 @@
+package authed
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorpher/gone/cryptoutil"
+	"github.com/gorpher/gone/osutil"
+)
+
+var ErrorInvalidMFA = errors.New("invalid mfa session")
+var ErrorInvalidOTP = errors.New("invalid one-time password")
+var ErrorOTPReplay = errors.New("one-time password already used")
+var ErrorInvalidRecoveryCode = errors.New("invalid recovery code")
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// recoveryCodeHasher 恢复码本身是高熵随机串，不需要慢哈希
+var recoveryCodeHasher = &cryptoutil.PBKDF2Hasher{Digest: "sha256", Iterations: 10000, KeyLen: 32, SaltLen: 16}
+
+// PendingMFA 通过第一因子认证、等待第二因子的会话
+type PendingMFA struct {
+	Session   *UserSession `json:"session"`
+	Attempts  int          `json:"attempts"`
+	ExpiresAt int64        `json:"expires_at"` // 单位毫秒，失败重试不会延长有效期
+}
+
+func (s *Authed) FormatMFAStoreKey(key string) string {
+	return fmt.Sprintf("%s/authed/mfa/%s", s.cookieName, key)
+}
+
+func (s *Authed) FormatOTPStoreKey(uid string) string {
+	return fmt.Sprintf("%s/authed/otp/%s", s.cookieName, uid)
+}
+
+// BeginMFA 第一因子认证成功后调用，返回等待第二因子的临时凭证，
+// 该凭证不能作为令牌使用，GetHTTPSession不会识别它
+func (s *Authed) BeginMFA(se *UserSession) (pending string, err error) {
+	if se == nil {
+		err = ErrorInvalidSession
+		return
+	}
+	pending = randomToken(32)
+	err = s.savePendingMFA(pending, &PendingMFA{Session: se, ExpiresAt: time.Now().Add(s.MFADuration).UnixMilli()})
+	return
+}
+
+// PendingMFASession 返回等待第二因子的会话，用于查找用户的TOTP密钥
+func (s *Authed) PendingMFASession(pending string) (*UserSession, error) {
+	p, err := s.getPendingMFA(pending)
+	if err != nil {
+		return nil, err
+	}
+	return p.Session, nil
+}
+
+// CompleteMFA 第二因子校验成功后颁发正式令牌，失败次数超过MFAMaxAttempts时临时凭证失效，
+// 同一临时凭证在进程内串行校验，多实例部署时并发请求仍可能超过尝试次数
+func (s *Authed) CompleteMFA(pending string, verify func(se *UserSession) error) (token, refresh string, err error) {
+	unlock := s.locks.Lock(s.FormatMFAStoreKey(pending))
+	defer unlock()
+	var p *PendingMFA
+	p, err = s.getPendingMFA(pending)
+	if err != nil {
+		return
+	}
+	if err = verify(p.Session); err != nil {
+		p.Attempts++
+		if p.Attempts >= s.MFAMaxAttempts {
+			_ = s.store.Del(s.FormatMFAStoreKey(pending)) // nolint
+			return
+		}
+		if e := s.savePendingMFA(pending, p); e != nil {
+			err = e
+		}
+		return
+	}
+	if err = s.store.Del(s.FormatMFAStoreKey(pending)); err != nil {
+		return
+	}
+	se := p.Session
+	if se.Extends == nil {
+		se.Extends = map[string]any{}
+	}
+	se.Extends["mfa"] = true
+	return s.CreateToken(se)
+}
+
+// ValidateTOTP 校验用户的TOTP密码，同一用户已使用过的计数器不能再次使用，
+// 防重放在进程内是原子的，多实例部署时并发提交同一密码仍可能通过
+func (s *Authed) ValidateTOTP(uid string, totp *cryptoutil.TOTP, code string) error {
+	counter, ok := totp.Validate(strings.TrimSpace(code), time.Now())
+	if !ok {
+		return ErrorInvalidOTP
+	}
+	key := s.FormatOTPStoreKey(uid)
+	unlock := s.locks.Lock(key)
+	defer unlock()
+	last, err := s.store.Get(key)
+	if err == nil && len(last) > 0 {
+		used, e := strconv.ParseUint(string(last), 10, 64)
+		if e == nil && counter <= used {
+			return ErrorOTPReplay
+		}
+	}
+	ttl := totp.Period * time.Duration(2*totp.Skew+2)
+	return s.store.SetWithTTL(key, strconv.FormatUint(counter, 10), ttl)
+}
+
+// GenerateRecoveryCodes 生成n个恢复码，codes展示给用户，hashes加盐摘要后持久化
+func GenerateRecoveryCodes(n int) (codes, hashes []string, err error) {
+	codes = make([]string, n)
+	hashes = make([]string, n)
+	for i := 0; i < n; i++ {
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(osutil.RandBytes(7)))
+		code = code[:5] + "-" + code[5:10]
+		codes[i] = code
+		hashes[i], err = recoveryCodeHasher.Hash([]byte(code))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return codes, hashes, nil
+}
+
+// UseRecoveryCode 校验恢复码，成功时返回去掉已使用恢复码后的摘要列表，调用方需要持久化
+func UseRecoveryCode(hashes []string, code string) (remaining []string, err error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	for i := range hashes {
+		if recoveryCodeHasher.Verify([]byte(code), hashes[i]) == nil {
+			remaining = make([]string, 0, len(hashes)-1)
+			remaining = append(remaining, hashes[:i]...)
+			remaining = append(remaining, hashes[i+1:]...)
+			return remaining, nil
+		}
+	}
+	return hashes, ErrorInvalidRecoveryCode
+}
+
+func (s *Authed) savePendingMFA(pending string, p *PendingMFA) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(time.UnixMilli(p.ExpiresAt))
+	if ttl <= 0 {
+		_ = s.store.Del(s.FormatMFAStoreKey(pending)) // nolint
+		return ErrorInvalidMFA
+	}
+	return s.store.SetWithTTL(s.FormatMFAStoreKey(pending), string(data), ttl)
+}
+
+func (s *Authed) getPendingMFA(pending string) (*PendingMFA, error) {
+	if pending == "" {
+		return nil, ErrorInvalidMFA
+	}
+	data, err := s.store.Get(s.FormatMFAStoreKey(pending))
+	if err != nil || len(data) == 0 {
+		return nil, ErrorInvalidMFA
+	}
+	var p PendingMFA
+	if err = json.Unmarshal(data, &p); err != nil || p.Session == nil || time.Now().UnixMilli() >= p.ExpiresAt {
+		return nil, ErrorInvalidMFA
+	}
+	return &p, nil
+}
@@ -0,0 +1,138 @@
+package authed
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorpher/gone/cryptoutil"
+)
+
+func TestMFA(t *testing.T) {
+	a := NewAuthed()
+	secret, err := cryptoutil.GenerateOTPSecret(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	totp := cryptoutil.NewTOTP(secret)
+	pending, err := a.BeginMFA(&UserSession{Uid: "1001", Username: "tom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.VerifyToken(pending); err == nil {
+		t.Fatal("pending mfa must not be a valid token")
+	}
+	verify := func(code string) func(se *UserSession) error {
+		return func(se *UserSession) error {
+			return a.ValidateTOTP(se.Uid, totp, code)
+		}
+	}
+	if _, _, err = a.CompleteMFA(pending, verify("000000x")); !errors.Is(err, ErrorInvalidOTP) {
+		t.Fatalf("expect invalid otp, got %v", err)
+	}
+	code, err := totp.Generate(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := a.CompleteMFA(pending, verify(code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := a.VerifyToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Uid != "1001" || payload.Extends["mfa"] != true {
+		t.Fatalf("unexpected session %+v", payload.UserSession)
+	}
+	if _, _, err = a.CompleteMFA(pending, verify(code)); !errors.Is(err, ErrorInvalidMFA) {
+		t.Fatalf("pending mfa reused: %v", err)
+	}
+	if err = a.ValidateTOTP("1001", totp, code); !errors.Is(err, ErrorOTPReplay) {
+		t.Fatalf("expect replay error, got %v", err)
+	}
+}
+
+func TestMFAMaxAttempts(t *testing.T) {
+	a := NewAuthed()
+	a.MFAMaxAttempts = 2
+	pending, err := a.BeginMFA(&UserSession{Uid: "1001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fail := func(se *UserSession) error { return ErrorInvalidOTP }
+	for i := 0; i < 2; i++ {
+		if _, _, err = a.CompleteMFA(pending, fail); !errors.Is(err, ErrorInvalidOTP) {
+			t.Fatal(err)
+		}
+	}
+	if _, err = a.PendingMFASession(pending); !errors.Is(err, ErrorInvalidMFA) {
+		t.Fatalf("pending mfa should be discarded, got %v", err)
+	}
+}
+
+func TestMFAFailureKeepsExpiry(t *testing.T) {
+	a := NewAuthed()
+	a.MFADuration = 300 * time.Millisecond
+	pending, err := a.BeginMFA(&UserSession{Uid: "1001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	fail := func(se *UserSession) error { return ErrorInvalidOTP }
+	if _, _, err = a.CompleteMFA(pending, fail); !errors.Is(err, ErrorInvalidOTP) {
+		t.Fatal(err)
+	}
+	// 失败后仍按第一次的有效期过期
+	time.Sleep(150 * time.Millisecond)
+	if _, err = a.PendingMFASession(pending); !errors.Is(err, ErrorInvalidMFA) {
+		t.Fatalf("failed attempt extended pending mfa: %v", err)
+	}
+}
+
+func TestValidateTOTPConcurrentReplay(t *testing.T) {
+	a := NewAuthed()
+	secret, err := cryptoutil.GenerateOTPSecret(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	totp := cryptoutil.NewTOTP(secret)
+	code, err := totp.Generate(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ok int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if a.ValidateTOTP("1001", totp, code) == nil {
+				atomic.AddInt32(&ok, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if ok != 1 {
+		t.Fatalf("code accepted %d times", ok)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining, err := UseRecoveryCode(hashes, codes[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 2 {
+		t.Fatalf("expect 2 remaining codes, got %d", len(remaining))
+	}
+	if _, err = UseRecoveryCode(remaining, codes[1]); !errors.Is(err, ErrorInvalidRecoveryCode) {
+		t.Fatal("recovery code reused")
+	}
+}
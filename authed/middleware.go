@@ -0,0 +1,38 @@
+package authed
+
+import (
+	"context"
+	"net/http"
+)
+
+type sessionContextKey struct{}
+
+// Middleware 要求请求已认证，会话写入请求上下文，未认证时返回401
+func (s *Authed) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		se := s.GetHTTPSession(req)
+		if se == nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(ContextWithSession(req.Context(), se)))
+	})
+}
+
+func ContextWithSession(ctx context.Context, se *UserSession) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, se)
+}
+
+// SessionFromContext 返回请求对应的用户，代理登录时为被代理的用户
+func SessionFromContext(ctx context.Context) *UserSession {
+	se, _ := ctx.Value(sessionContextKey{}).(*UserSession) // nolint
+	return se
+}
+
+// ActorFromContext 代理登录时返回实际操作的管理员，否则返回nil
+func ActorFromContext(ctx context.Context) *Actor {
+	if se := SessionFromContext(ctx); se != nil {
+		return se.Act
+	}
+	return nil
+}
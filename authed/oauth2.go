@@ -0,0 +1,743 @@
+package authed
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorpher/gone/cache"
+	"github.com/gorpher/gone/osutil"
+)
+
+// OAuth2 授权类型
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeRefreshToken      = "refresh_token"
+)
+
+// PKCE code_challenge_method
+const (
+	CodeChallengePlain = "plain"
+	CodeChallengeS256  = "S256"
+)
+
+// OAuth2 错误码，参考 RFC 6749 5.2
+const (
+	OAuth2ErrInvalidRequest       = "invalid_request"
+	OAuth2ErrInvalidClient        = "invalid_client"
+	OAuth2ErrInvalidGrant         = "invalid_grant"
+	OAuth2ErrInvalidScope         = "invalid_scope"
+	OAuth2ErrUnauthorizedClient   = "unauthorized_client"
+	OAuth2ErrUnsupportedGrantType = "unsupported_grant_type"
+	OAuth2ErrUnsupportedRespType  = "unsupported_response_type"
+	OAuth2ErrLoginRequired        = "login_required"
+	OAuth2ErrServerError          = "server_error"
+)
+
+var ErrorInvalidClient = errors.New("invalid client")
+var ErrorInvalidCode = errors.New("invalid authorization code")
+
+// OAuth2Client 客户端注册信息，Secret只保存sha256摘要
+type OAuth2Client struct {
+	ID           string   `json:"id"`
+	Secret       string   `json:"secret,omitempty"` // sha256 hex
+	Name         string   `json:"name,omitempty"`
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+	GrantTypes   []string `json:"grant_types,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+	Public       bool     `json:"public,omitempty"` // 公共客户端没有密钥，必须使用PKCE
+}
+
+// SetSecret 设置客户端密钥，只保存摘要
+func (c *OAuth2Client) SetSecret(secret string) {
+	c.Secret = hashOAuth2Secret(secret)
+}
+
+// VerifySecret 常量时间比较客户端密钥
+func (c *OAuth2Client) VerifySecret(secret string) bool {
+	if c.Secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Secret), []byte(hashOAuth2Secret(secret))) == 1
+}
+
+func (c *OAuth2Client) allowGrant(grantType string) bool {
+	if len(c.GrantTypes) == 0 {
+		return grantType != GrantTypeClientCredentials || !c.Public
+	}
+	return containsString(c.GrantTypes, grantType)
+}
+
+func (c *OAuth2Client) allowRedirectURI(uri string) bool {
+	return containsString(c.RedirectURIs, uri)
+}
+
+// allowScopes 请求的scope必须是客户端scope的子集，客户端未限制scope时全部允许
+func (c *OAuth2Client) allowScopes(scopes []string) bool {
+	if len(c.Scopes) == 0 {
+		return true
+	}
+	for _, scope := range scopes {
+		if !containsString(c.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// OAuth2Code 授权码保存的内容
+type OAuth2Code struct {
+	ClientID    string `json:"client_id"`
+	RedirectURI string `json:"redirect_uri"`
+	// RedirectURISent 授权请求中显式传了redirect_uri，令牌请求必须传相同的值
+	RedirectURISent     bool         `json:"redirect_uri_sent,omitempty"`
+	Scopes              []string     `json:"scopes,omitempty"`
+	CodeChallenge       string       `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string       `json:"code_challenge_method,omitempty"`
+	Session             *UserSession `json:"session"`
+}
+
+// OAuth2Token 令牌端点响应体
+type OAuth2Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// OAuth2Introspection 令牌内省响应体，参考 RFC 7662
+type OAuth2Introspection struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Nbf       int64    `json:"nbf,omitempty"`
+	Sub       string   `json:"sub,omitempty"`
+	Aud       []string `json:"aud,omitempty"`
+	Iss       string   `json:"iss,omitempty"`
+	Jti       string   `json:"jti,omitempty"`
+}
+
+// OAuth2Error 错误响应体
+type OAuth2Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuth2Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// OAuth2Server 基于Authed的OAuth2授权服务
+type OAuth2Server struct {
+	CodeDuration time.Duration
+	RequirePKCE  bool // 机密客户端也必须使用PKCE
+	// ===============================
+	authed *Authed
+	store  cache.Cache
+	// resourceOwner 获取当前登录用户，返回nil时授权端点返回login_required
+	resourceOwner func(w http.ResponseWriter, r *http.Request) *UserSession
+}
+
+type OAuth2OptFunc func(s *OAuth2Server) *OAuth2Server
+
+func WithOAuth2Cache(c cache.Cache) OAuth2OptFunc {
+	return func(s *OAuth2Server) *OAuth2Server {
+		s.store = c
+		return s
+	}
+}
+
+func WithOAuth2CodeDuration(d time.Duration) OAuth2OptFunc {
+	return func(s *OAuth2Server) *OAuth2Server {
+		s.CodeDuration = d
+		return s
+	}
+}
+
+func WithOAuth2RequirePKCE() OAuth2OptFunc {
+	return func(s *OAuth2Server) *OAuth2Server {
+		s.RequirePKCE = true
+		return s
+	}
+}
+
+// WithOAuth2ResourceOwner 自定义获取登录用户的方法，默认使用Authed.GetHTTPSession
+func WithOAuth2ResourceOwner(f func(w http.ResponseWriter, r *http.Request) *UserSession) OAuth2OptFunc {
+	return func(s *OAuth2Server) *OAuth2Server {
+		s.resourceOwner = f
+		return s
+	}
+}
+
+func NewOAuth2Server(a *Authed, opts ...OAuth2OptFunc) *OAuth2Server {
+	s := &OAuth2Server{
+		CodeDuration: time.Minute * 5,
+		authed:       a,
+		store:        a.store,
+	}
+	s.resourceOwner = func(w http.ResponseWriter, r *http.Request) *UserSession {
+		return a.GetHTTPSession(r)
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *OAuth2Server) FormatClientStoreKey(id string) string {
+	return fmt.Sprintf("%s/authed/oauth2/client/%s", s.authed.cookieName, id)
+}
+
+func (s *OAuth2Server) FormatCodeStoreKey(code string) string {
+	return fmt.Sprintf("%s/authed/oauth2/code/%s", s.authed.cookieName, code)
+}
+
+// RegisterClient 保存客户端注册信息
+func (s *OAuth2Server) RegisterClient(c *OAuth2Client) error {
+	if c == nil || c.ID == "" {
+		return ErrorInvalidClient
+	}
+	if !c.Public && c.Secret == "" {
+		return ErrorInvalidClient
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(s.FormatClientStoreKey(c.ID), string(data))
+}
+
+func (s *OAuth2Server) DeleteClient(id string) error {
+	return s.store.Del(s.FormatClientStoreKey(id))
+}
+
+func (s *OAuth2Server) GetClient(id string) (*OAuth2Client, error) {
+	if id == "" {
+		return nil, ErrorInvalidClient
+	}
+	data, err := s.store.Get(s.FormatClientStoreKey(id))
+	if err != nil || len(data) == 0 {
+		return nil, ErrorInvalidClient
+	}
+	var c OAuth2Client
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// AuthorizeHandler 授权端点，只支持response_type=code
+func (s *OAuth2Server) AuthorizeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		if r.Method == http.MethodPost {
+			if err := r.ParseForm(); err != nil {
+				writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrInvalidRequest, err.Error())
+				return
+			}
+			q = r.Form
+		}
+		client, err := s.GetClient(q.Get("client_id"))
+		if err != nil {
+			writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrInvalidClient, "unknown client")
+			return
+		}
+		redirectURI := q.Get("redirect_uri")
+		redirectURISent := redirectURI != ""
+		if redirectURI == "" && len(client.RedirectURIs) == 1 {
+			redirectURI = client.RedirectURIs[0]
+		}
+		// redirect_uri 未通过校验时不能重定向，直接返回错误
+		if !client.allowRedirectURI(redirectURI) {
+			writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrInvalidRequest, "invalid redirect_uri")
+			return
+		}
+		state := q.Get("state")
+		redirectError := func(code, desc string) {
+			v := url.Values{}
+			v.Set("error", code)
+			if desc != "" {
+				v.Set("error_description", desc)
+			}
+			if state != "" {
+				v.Set("state", state)
+			}
+			http.Redirect(w, r, appendQuery(redirectURI, v), http.StatusFound)
+		}
+		if q.Get("response_type") != "code" {
+			redirectError(OAuth2ErrUnsupportedRespType, "")
+			return
+		}
+		if !client.allowGrant(GrantTypeAuthorizationCode) {
+			redirectError(OAuth2ErrUnauthorizedClient, "")
+			return
+		}
+		scopes := strings.Fields(q.Get("scope"))
+		if !client.allowScopes(scopes) {
+			redirectError(OAuth2ErrInvalidScope, "")
+			return
+		}
+		challenge := q.Get("code_challenge")
+		method := q.Get("code_challenge_method")
+		if challenge == "" && (client.Public || s.RequirePKCE) {
+			redirectError(OAuth2ErrInvalidRequest, "code_challenge required")
+			return
+		}
+		if challenge != "" {
+			if method == "" {
+				method = CodeChallengePlain
+			}
+			if method != CodeChallengePlain && method != CodeChallengeS256 {
+				redirectError(OAuth2ErrInvalidRequest, "unsupported code_challenge_method")
+				return
+			}
+		}
+		se := s.resourceOwner(w, r)
+		if se == nil {
+			writeOAuth2Error(w, http.StatusUnauthorized, OAuth2ErrLoginRequired, "")
+			return
+		}
+		code := randomToken(32)
+		data, err := json.Marshal(OAuth2Code{
+			ClientID:            client.ID,
+			RedirectURI:         redirectURI,
+			RedirectURISent:     redirectURISent,
+			Scopes:              scopes,
+			CodeChallenge:       challenge,
+			CodeChallengeMethod: method,
+			Session:             se,
+		})
+		if err != nil {
+			redirectError(OAuth2ErrServerError, "")
+			return
+		}
+		err = s.store.SetWithTTL(s.FormatCodeStoreKey(code), string(data), s.CodeDuration)
+		if err != nil {
+			redirectError(OAuth2ErrServerError, "")
+			return
+		}
+		v := url.Values{}
+		v.Set("code", code)
+		if state != "" {
+			v.Set("state", state)
+		}
+		http.Redirect(w, r, appendQuery(redirectURI, v), http.StatusFound)
+	})
+}
+
+// TokenHandler 令牌端点，支持authorization_code、client_credentials和refresh_token
+func (s *OAuth2Server) TokenHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrInvalidRequest, err.Error())
+			return
+		}
+		grantType := r.PostForm.Get("grant_type")
+		// 公共客户端没有密钥，可以使用授权码和轮换的刷新令牌
+		client, err := s.authenticateClient(r, grantType == GrantTypeAuthorizationCode || grantType == GrantTypeRefreshToken)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+			writeOAuth2Error(w, http.StatusUnauthorized, OAuth2ErrInvalidClient, "")
+			return
+		}
+		if !client.allowGrant(grantType) {
+			writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrUnauthorizedClient, "")
+			return
+		}
+		var token *OAuth2Token
+		switch grantType {
+		case GrantTypeAuthorizationCode:
+			token, err = s.exchangeCode(r, client)
+		case GrantTypeClientCredentials:
+			token, err = s.clientCredentials(r, client)
+		case GrantTypeRefreshToken:
+			token, err = s.refreshToken(r, client)
+		default:
+			err = &OAuth2Error{Code: OAuth2ErrUnsupportedGrantType}
+		}
+		if err != nil {
+			var oe *OAuth2Error
+			if errors.As(err, &oe) {
+				writeOAuth2Error(w, http.StatusBadRequest, oe.Code, oe.Description)
+				return
+			}
+			writeOAuth2Error(w, http.StatusInternalServerError, OAuth2ErrServerError, "")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Pragma", "no-cache")
+		writeOAuth2JSON(w, http.StatusOK, token)
+	})
+}
+
+// IntrospectHandler 令牌内省端点，参考 RFC 7662
+func (s *OAuth2Server) IntrospectHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrInvalidRequest, err.Error())
+			return
+		}
+		if _, err := s.authenticateClient(r, false); err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+			writeOAuth2Error(w, http.StatusUnauthorized, OAuth2ErrInvalidClient, "")
+			return
+		}
+		token := r.PostForm.Get("token")
+		if token == "" {
+			writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrInvalidRequest, "token required")
+			return
+		}
+		writeOAuth2JSON(w, http.StatusOK, s.Introspect(token, r.PostForm.Get("token_type_hint")))
+	})
+}
+
+// RevokeHandler 令牌撤销端点，参考 RFC 7009，无论令牌是否有效都返回200
+func (s *OAuth2Server) RevokeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrInvalidRequest, err.Error())
+			return
+		}
+		// 公共客户端可以撤销自己的刷新令牌
+		client, err := s.authenticateClient(r, true)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+			writeOAuth2Error(w, http.StatusUnauthorized, OAuth2ErrInvalidClient, "")
+			return
+		}
+		token := r.PostForm.Get("token")
+		if token == "" {
+			writeOAuth2Error(w, http.StatusBadRequest, OAuth2ErrInvalidRequest, "token required")
+			return
+		}
+		if err = s.revoke(r, client, token); err != nil {
+			writeOAuth2Error(w, http.StatusServiceUnavailable, OAuth2ErrServerError, "")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// Introspect 查询令牌状态，先按访问令牌再按刷新令牌查找
+func (s *OAuth2Server) Introspect(token, hint string) *OAuth2Introspection {
+	if hint != GrantTypeRefreshToken {
+		if payload, err := s.authed.VerifyToken(token); err == nil && payload.UserSession != nil {
+			return introspection(&payload, "access_token")
+		}
+	}
+	if payload, err := s.refreshPayload(token); err == nil && payload.UserSession != nil {
+		return introspection(payload, GrantTypeRefreshToken)
+	}
+	if hint == GrantTypeRefreshToken {
+		if payload, err := s.authed.VerifyToken(token); err == nil && payload.UserSession != nil {
+			return introspection(&payload, "access_token")
+		}
+	}
+	return &OAuth2Introspection{Active: false}
+}
+
+// Revoke 撤销访问令牌或刷新令牌，令牌不属于该客户端时忽略
+func (s *OAuth2Server) Revoke(client *OAuth2Client, token string) error {
+	return s.revoke(nil, client, token)
+}
+
+func (s *OAuth2Server) revoke(r *http.Request, client *OAuth2Client, token string) error {
+	if payload, err := s.authed.VerifyToken(token); err == nil && payload.UserSession != nil {
+		if payload.ClientName != client.ID {
+			return nil
+		}
+		return s.authed.deleteToken(r, payload.JWTID)
+	}
+	payload, err := s.refreshPayload(token)
+	if err != nil || payload.UserSession == nil || payload.ClientName != client.ID {
+		return nil
+	}
+	return s.authed.deleteToken(r, payload.JWTID)
+}
+
+func (s *OAuth2Server) exchangeCode(r *http.Request, client *OAuth2Client) (*OAuth2Token, error) {
+	form := r.PostForm
+	code := form.Get("code")
+	if code == "" {
+		return nil, &OAuth2Error{Code: OAuth2ErrInvalidRequest, Description: "code required"}
+	}
+	key := s.FormatCodeStoreKey(code)
+	// 授权码只能使用一次，在进程内串行读取和删除
+	unlock := s.authed.locks.Lock(key)
+	defer unlock()
+	data, err := s.store.Get(key)
+	if err != nil || len(data) == 0 {
+		return nil, &OAuth2Error{Code: OAuth2ErrInvalidGrant, Description: ErrorInvalidCode.Error()}
+	}
+	if err = s.store.Del(key); err != nil {
+		return nil, err
+	}
+	var c OAuth2Code
+	if err = json.Unmarshal(data, &c); err != nil || c.Session == nil {
+		return nil, &OAuth2Error{Code: OAuth2ErrInvalidGrant, Description: ErrorInvalidCode.Error()}
+	}
+	if c.ClientID != client.ID {
+		return nil, &OAuth2Error{Code: OAuth2ErrInvalidGrant, Description: ErrorInvalidCode.Error()}
+	}
+	// RFC 6749 4.1.3 授权请求包含redirect_uri时令牌请求必须包含相同的值
+	if redirectURI := form.Get("redirect_uri"); (c.RedirectURISent || redirectURI != "") && redirectURI != c.RedirectURI {
+		return nil, &OAuth2Error{Code: OAuth2ErrInvalidGrant, Description: "redirect_uri mismatch"}
+	}
+	if c.CodeChallenge != "" &&
+		!VerifyCodeChallenge(c.CodeChallengeMethod, c.CodeChallenge, form.Get("code_verifier")) {
+		return nil, &OAuth2Error{Code: OAuth2ErrInvalidGrant, Description: "invalid code_verifier"}
+	}
+	se := c.Session
+	se.ID = ""
+	se.ExpiredAt = 0
+	se.ClientName = client.ID
+	se.Scopes = c.Scopes
+	return s.issue(r, se, true)
+}
+
+func (s *OAuth2Server) clientCredentials(r *http.Request, client *OAuth2Client) (*OAuth2Token, error) {
+	form := r.PostForm
+	scopes := strings.Fields(form.Get("scope"))
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !client.allowScopes(scopes) {
+		return nil, &OAuth2Error{Code: OAuth2ErrInvalidScope}
+	}
+	// RFC 6749 4.4.3 客户端凭证模式不应该颁发刷新令牌
+	return s.issue(r, &UserSession{
+		ClientName: client.ID,
+		Username:   client.Name,
+		Scopes:     scopes,
+	}, false)
+}
+
+func (s *OAuth2Server) refreshToken(r *http.Request, client *OAuth2Client) (*OAuth2Token, error) {
+	form := r.PostForm
+	refresh := form.Get("refresh_token")
+	// 同一刷新令牌在进程内串行轮换，只有第一个请求能换到新令牌
+	unlock := s.authed.locks.Lock(s.authed.FormatRefreshTokenStoreKey(refresh))
+	defer unlock()
+	payload, err := s.refreshPayload(refresh)
+	if err != nil || payload.UserSession == nil || payload.ClientName != client.ID {
+		return nil, &OAuth2Error{Code: OAuth2ErrInvalidGrant, Description: ErrorInvalidRefreshToken.Error()}
+	}
+	// 缩小scope范围
+	if scopes := strings.Fields(form.Get("scope")); len(scopes) > 0 {
+		for _, scope := range scopes {
+			if !containsString(payload.Scopes, scope) {
+				return nil, &OAuth2Error{Code: OAuth2ErrInvalidScope}
+			}
+		}
+		payload.Scopes = scopes
+	}
+	// 刷新令牌轮换，旧的刷新令牌立即失效
+	if err = s.authed.store.Del(s.authed.FormatRefreshTokenStoreKey(refresh)); err != nil {
+		return nil, err
+	}
+	payload.SetExpired(time.Now().Add(s.authed.TokenDuration))
+	token, newRefresh, err := s.authed.createToken(payload)
+	if err != nil {
+		return nil, err
+	}
+	s.authed.Audit(r, AuditTokenRefreshed, payload.UserSession, nil)
+	return s.tokenResponse(token, newRefresh, payload.Scopes), nil
+}
+
+func (s *OAuth2Server) issue(r *http.Request, se *UserSession, withRefresh bool) (*OAuth2Token, error) {
+	token, refresh, err := s.authed.issueToken(r, se)
+	if err != nil {
+		return nil, err
+	}
+	if !withRefresh {
+		if err = s.authed.store.Del(s.authed.FormatRefreshTokenStoreKey(refresh)); err != nil {
+			return nil, err
+		}
+		if err = s.authed.store.Del(s.authed.FormatLinkTokenStoreKey(se.ID)); err != nil {
+			return nil, err
+		}
+		refresh = ""
+	}
+	return s.tokenResponse(token, refresh, se.Scopes), nil
+}
+
+func (s *OAuth2Server) tokenResponse(token, refresh string, scopes []string) *OAuth2Token {
+	return &OAuth2Token{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.authed.TokenDuration / time.Second),
+		RefreshToken: refresh,
+		Scope:        strings.Join(scopes, " "),
+	}
+}
+
+// refreshPayload 根据刷新令牌读取对应的令牌内容
+func (s *OAuth2Server) refreshPayload(refresh string) (*Payload, error) {
+	if refresh == "" {
+		return nil, ErrorInvalidRefreshToken
+	}
+	a := s.authed
+	tokenBytes, err := a.store.Get(a.FormatRefreshTokenStoreKey(refresh))
+	if err != nil {
+		return nil, err
+	}
+	if len(tokenBytes) == 0 {
+		return nil, ErrorInvalidRefreshToken
+	}
+	plainByte, err := a.cryptoCodec.Decode(a.cryptoKey, tokenBytes)
+	if err != nil {
+		return nil, err
+	}
+	var payload Payload
+	if err = a.objectCodec.Decode(plainByte, &payload); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+// authenticateClient 客户端认证，支持HTTP Basic和表单client_id/client_secret，
+// allowPublic为true时公共客户端只需要client_id
+func (s *OAuth2Server) authenticateClient(r *http.Request, allowPublic bool) (*OAuth2Client, error) {
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		var err error
+		if id, err = url.QueryUnescape(id); err != nil {
+			return nil, ErrorInvalidClient
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return nil, ErrorInvalidClient
+		}
+	} else {
+		id = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	client, err := s.GetClient(id)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public {
+		if !allowPublic || secret != "" {
+			return nil, ErrorInvalidClient
+		}
+		return client, nil
+	}
+	if !client.VerifySecret(secret) {
+		return nil, ErrorInvalidClient
+	}
+	return client, nil
+}
+
+// NewCodeVerifier 生成PKCE code_verifier和S256 code_challenge
+func NewCodeVerifier() (verifier, challenge string) {
+	verifier = base64.RawURLEncoding.EncodeToString(osutil.RandBytes(32))
+	return verifier, CodeChallenge(verifier)
+}
+
+// CodeChallenge 计算S256 code_challenge
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyCodeChallenge 校验PKCE code_verifier，参考 RFC 7636 4.6
+func VerifyCodeChallenge(method, challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	switch method {
+	case CodeChallengeS256:
+		return subtle.ConstantTimeCompare([]byte(CodeChallenge(verifier)), []byte(challenge)) == 1
+	case CodeChallengePlain, "":
+		return subtle.ConstantTimeCompare([]byte(verifier), []byte(challenge)) == 1
+	default:
+		return false
+	}
+}
+
+func introspection(payload *Payload, tokenType string) *OAuth2Introspection {
+	in := &OAuth2Introspection{
+		Active:    true,
+		Scope:     strings.Join(payload.Scopes, " "),
+		ClientID:  payload.ClientName,
+		Username:  payload.Username,
+		TokenType: tokenType,
+		Sub:       payload.Uid,
+		Aud:       payload.Audience,
+		Iss:       payload.Issuer,
+		Jti:       payload.JWTID,
+	}
+	if payload.ExpirationTime != nil && tokenType != GrantTypeRefreshToken {
+		in.Exp = payload.ExpirationTime.Unix()
+	}
+	if payload.IssuedAt != nil {
+		in.Iat = payload.IssuedAt.Unix()
+	}
+	if payload.NotBefore != nil {
+		in.Nbf = payload.NotBefore.Unix()
+	}
+	return in
+}
+
+func hashOAuth2Secret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func appendQuery(uri string, v url.Values) string {
+	if strings.Contains(uri, "?") {
+		return uri + "&" + v.Encode()
+	}
+	return uri + "?" + v.Encode()
+}
+
+func containsString(list []string, s string) bool {
+	for i := range list {
+		if list[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+func writeOAuth2Error(w http.ResponseWriter, status int, code, desc string) {
+	writeOAuth2JSON(w, status, &OAuth2Error{Code: code, Description: desc})
+}
+
+func writeOAuth2JSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v) // nolint
+}
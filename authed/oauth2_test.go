@@ -0,0 +1,278 @@
+package authed
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorpher/gone/cache"
+)
+
+func newOAuth2TestServer(t *testing.T, opts ...OptFunc) (*Authed, *OAuth2Server) {
+	a := NewAuthed(opts...)
+	s := NewOAuth2Server(a, WithOAuth2ResourceOwner(func(w http.ResponseWriter, r *http.Request) *UserSession {
+		if r.Header.Get("X-User") == "" {
+			return nil
+		}
+		return &UserSession{Uid: r.Header.Get("X-User"), Username: "tom"}
+	}))
+	confidential := &OAuth2Client{
+		ID:           "web",
+		RedirectURIs: []string{"https://app.example.com/cb"},
+		Scopes:       []string{"read", "write"},
+	}
+	confidential.SetSecret("secret")
+	if err := s.RegisterClient(confidential); err != nil {
+		t.Fatal(err)
+	}
+	public := &OAuth2Client{
+		ID:           "spa",
+		Public:       true,
+		RedirectURIs: []string{"https://spa.example.com/cb"},
+	}
+	if err := s.RegisterClient(public); err != nil {
+		t.Fatal(err)
+	}
+	return a, s
+}
+
+func postForm(h http.Handler, form url.Values, user, pass string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func authorize(t *testing.T, s *OAuth2Server, query url.Values) *url.URL {
+	req := httptest.NewRequest(http.MethodGet, "/authorize?"+query.Encode(), nil)
+	req.Header.Set("X-User", "1001")
+	w := httptest.NewRecorder()
+	s.AuthorizeHandler().ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("authorize status %d: %s", w.Code, w.Body.String())
+	}
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestOAuth2AuthorizationCodePKCE(t *testing.T) {
+	a, s := newOAuth2TestServer(t)
+	verifier, challenge := NewCodeVerifier()
+	loc := authorize(t, s, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"spa"},
+		"redirect_uri":          {"https://spa.example.com/cb"},
+		"scope":                 {"profile"},
+		"state":                 {"xyz"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {CodeChallengeS256},
+	})
+	if loc.Query().Get("state") != "xyz" {
+		t.Fatalf("state lost: %s", loc)
+	}
+	code := loc.Query().Get("code")
+	form := url.Values{
+		"grant_type":    {GrantTypeAuthorizationCode},
+		"client_id":     {"spa"},
+		"code":          {code},
+		"redirect_uri":  {"https://spa.example.com/cb"},
+		"code_verifier": {"wrong" + verifier},
+	}
+	if w := postForm(s.TokenHandler(), form, "", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("wrong verifier accepted: %d", w.Code)
+	}
+	// 授权码已被消费，需要重新授权
+	code = authorize(t, s, url.Values{
+		"response_type":  {"code"},
+		"client_id":      {"spa"},
+		"code_challenge": {challenge}, "code_challenge_method": {CodeChallengeS256},
+	}).Query().Get("code")
+	form.Set("code", code)
+	form.Set("code_verifier", verifier)
+	w := postForm(s.TokenHandler(), form, "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("token status %d: %s", w.Code, w.Body.String())
+	}
+	var token OAuth2Token
+	if err := json.Unmarshal(w.Body.Bytes(), &token); err != nil {
+		t.Fatal(err)
+	}
+	payload, err := a.VerifyToken(token.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Uid != "1001" || payload.ClientName != "spa" {
+		t.Fatalf("unexpected session %+v", payload.UserSession)
+	}
+	if w = postForm(s.TokenHandler(), form, "", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("code reused: %d", w.Code)
+	}
+}
+
+func TestOAuth2AuthorizeRequiresPKCEForPublicClient(t *testing.T) {
+	_, s := newOAuth2TestServer(t)
+	loc := authorize(t, s, url.Values{"response_type": {"code"}, "client_id": {"spa"}})
+	if loc.Query().Get("error") != OAuth2ErrInvalidRequest {
+		t.Fatalf("expect invalid_request, got %s", loc)
+	}
+}
+
+func TestOAuth2ClientCredentialsIntrospectRevoke(t *testing.T) {
+	_, s := newOAuth2TestServer(t)
+	form := url.Values{"grant_type": {GrantTypeClientCredentials}, "scope": {"read"}}
+	if w := postForm(s.TokenHandler(), form, "web", "bad"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("bad secret accepted: %d", w.Code)
+	}
+	form.Set("scope", "admin")
+	if w := postForm(s.TokenHandler(), form, "web", "secret"); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid scope accepted: %d", w.Code)
+	}
+	form.Set("scope", "read")
+	w := postForm(s.TokenHandler(), form, "web", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("token status %d: %s", w.Code, w.Body.String())
+	}
+	var token OAuth2Token
+	if err := json.Unmarshal(w.Body.Bytes(), &token); err != nil {
+		t.Fatal(err)
+	}
+	if token.RefreshToken != "" {
+		t.Fatal("client_credentials must not issue refresh token")
+	}
+
+	var in OAuth2Introspection
+	w = postForm(s.IntrospectHandler(), url.Values{"token": {token.AccessToken}}, "web", "secret")
+	if err := json.Unmarshal(w.Body.Bytes(), &in); err != nil {
+		t.Fatal(err)
+	}
+	if !in.Active || in.ClientID != "web" || in.Scope != "read" {
+		t.Fatalf("unexpected introspection %+v", in)
+	}
+
+	if w = postForm(s.RevokeHandler(), url.Values{"token": {token.AccessToken}}, "web", "secret"); w.Code != http.StatusOK {
+		t.Fatalf("revoke status %d", w.Code)
+	}
+	w = postForm(s.IntrospectHandler(), url.Values{"token": {token.AccessToken}}, "web", "secret")
+	in = OAuth2Introspection{}
+	if err := json.Unmarshal(w.Body.Bytes(), &in); err != nil {
+		t.Fatal(err)
+	}
+	if in.Active {
+		t.Fatal("revoked token still active")
+	}
+}
+
+func TestOAuth2RefreshToken(t *testing.T) {
+	_, s := newOAuth2TestServer(t)
+	code := authorize(t, s, url.Values{
+		"response_type": {"code"},
+		"client_id":     {"web"},
+		"scope":         {"read write"},
+	}).Query().Get("code")
+	w := postForm(s.TokenHandler(), url.Values{"grant_type": {GrantTypeAuthorizationCode}, "code": {code}}, "web", "secret")
+	var token OAuth2Token
+	if err := json.Unmarshal(w.Body.Bytes(), &token); err != nil {
+		t.Fatal(err)
+	}
+	if token.RefreshToken == "" {
+		t.Fatalf("missing refresh token: %s", w.Body.String())
+	}
+	form := url.Values{"grant_type": {GrantTypeRefreshToken}, "refresh_token": {token.RefreshToken}, "scope": {"read"}}
+	w = postForm(s.TokenHandler(), form, "web", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh status %d: %s", w.Code, w.Body.String())
+	}
+	var refreshed OAuth2Token
+	if err := json.Unmarshal(w.Body.Bytes(), &refreshed); err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.Scope != "read" || refreshed.RefreshToken == token.RefreshToken {
+		t.Fatalf("unexpected refresh response %+v", refreshed)
+	}
+	if w = postForm(s.TokenHandler(), form, "web", "secret"); w.Code != http.StatusBadRequest {
+		t.Fatalf("rotated refresh token reused: %d", w.Code)
+	}
+}
+
+func TestOAuth2PublicClientRefresh(t *testing.T) {
+	_, s := newOAuth2TestServer(t)
+	verifier, challenge := NewCodeVerifier()
+	query := url.Values{
+		"response_type":  {"code"},
+		"client_id":      {"spa"},
+		"redirect_uri":   {"https://spa.example.com/cb"},
+		"code_challenge": {challenge}, "code_challenge_method": {CodeChallengeS256},
+	}
+	form := url.Values{
+		"grant_type":    {GrantTypeAuthorizationCode},
+		"client_id":     {"spa"},
+		"code":          {authorize(t, s, query).Query().Get("code")},
+		"code_verifier": {verifier},
+	}
+	// 授权请求包含redirect_uri，令牌请求也必须包含
+	if w := postForm(s.TokenHandler(), form, "", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("missing redirect_uri accepted: %d", w.Code)
+	}
+	form.Set("code", authorize(t, s, query).Query().Get("code"))
+	form.Set("redirect_uri", "https://spa.example.com/cb")
+	w := postForm(s.TokenHandler(), form, "", "")
+	var token OAuth2Token
+	if err := json.Unmarshal(w.Body.Bytes(), &token); err != nil {
+		t.Fatal(err)
+	}
+	if token.RefreshToken == "" {
+		t.Fatalf("missing refresh token: %s", w.Body.String())
+	}
+	refresh := url.Values{"grant_type": {GrantTypeRefreshToken}, "client_id": {"spa"}, "refresh_token": {token.RefreshToken}}
+	if w = postForm(s.TokenHandler(), refresh, "", ""); w.Code != http.StatusOK {
+		t.Fatalf("public refresh status %d: %s", w.Code, w.Body.String())
+	}
+	if w = postForm(s.TokenHandler(), refresh, "", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("rotated refresh token reused: %d", w.Code)
+	}
+}
+
+func TestOAuth2ConcurrentGrants(t *testing.T) {
+	_, s := newOAuth2TestServer(t, WithCache(slowCache{cache.NewMemoryCache()}))
+	code := authorize(t, s, url.Values{
+		"response_type": {"code"},
+		"client_id":     {"web"},
+		"scope":         {"read"},
+	}).Query().Get("code")
+	form := url.Values{"grant_type": {GrantTypeAuthorizationCode}, "code": {code}}
+	var refresh string
+	if n := parallel(8, func() error {
+		w := postForm(s.TokenHandler(), form, "web", "secret")
+		if w.Code != http.StatusOK {
+			return ErrorInvalidCode
+		}
+		var token OAuth2Token
+		if err := json.Unmarshal(w.Body.Bytes(), &token); err != nil {
+			return err
+		}
+		refresh = token.RefreshToken
+		return nil
+	}); n != 1 {
+		t.Fatalf("authorization code exchanged %d times", n)
+	}
+
+	form = url.Values{"grant_type": {GrantTypeRefreshToken}, "refresh_token": {refresh}}
+	if n := parallel(8, func() error {
+		if w := postForm(s.TokenHandler(), form, "web", "secret"); w.Code != http.StatusOK {
+			return ErrorInvalidRefreshToken
+		}
+		return nil
+	}); n != 1 {
+		t.Fatalf("refresh token rotated %d times", n)
+	}
+}
@@ -0,0 +1,200 @@
+package authed
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/gorpher/gone/cryptoutil"
+	"github.com/gorpher/gone/httputil"
+)
+
+/*
+免密登录:
+1. 登录链接: 随机令牌通过邮件/短信发送，缓存中只保存令牌的sha256
+2. 验证码: 6位数字，按 用途+邮箱/手机号 保存HMAC摘要和尝试次数，超过PasswordlessMaxAttempts次后作废
+两者都只能使用一次，兑换成功后通过CreateToken颁发正式令牌.
+*/
+
+var ErrorInvalidIdentifier = errors.New("invalid email or mobile")
+var ErrorInvalidLoginToken = errors.New("invalid login token")
+var ErrorInvalidLoginCode = errors.New("invalid login code")
+
+// PasswordlessLookup 根据邮箱或手机号查找用户会话
+type PasswordlessLookup func(identifier string) (*UserSession, error)
+
+type passwordlessRecord struct {
+	Identifier string `json:"identifier"`
+	Purpose    string `json:"purpose"`
+	Hash       string `json:"hash,omitempty"`
+	Attempts   int    `json:"attempts"`
+}
+
+func (s *Authed) FormatLoginLinkStoreKey(hash string) string {
+	return fmt.Sprintf("%s/authed/loginlink/%s", s.cookieName, hash)
+}
+
+func (s *Authed) FormatLoginCodeStoreKey(purpose, identifier string) string {
+	return fmt.Sprintf("%s/authed/logincode/%s/%s", s.cookieName, purpose, identifier)
+}
+
+// IssueLoginLink 为邮箱或手机号生成登录链接令牌，purpose区分登录、注册、找回密码等用途
+func (s *Authed) IssueLoginLink(identifier, purpose string) (token string, err error) {
+	if identifier, err = normalizeIdentifier(identifier); err != nil {
+		return
+	}
+	token = randomToken(32)
+	err = s.savePasswordless(s.FormatLoginLinkStoreKey(hashLoginToken(token)),
+		&passwordlessRecord{Identifier: identifier, Purpose: purpose})
+	return
+}
+
+// VerifyLoginLink 校验并作废登录链接令牌，返回绑定的邮箱或手机号，同一令牌在进程内串行校验
+func (s *Authed) VerifyLoginLink(token, purpose string) (identifier string, err error) {
+	if token == "" {
+		err = ErrorInvalidLoginToken
+		return
+	}
+	key := s.FormatLoginLinkStoreKey(hashLoginToken(token))
+	unlock := s.locks.Lock(key)
+	defer unlock()
+	rec, err := s.getPasswordless(key)
+	if err != nil {
+		err = ErrorInvalidLoginToken
+		return
+	}
+	if err = s.store.Del(key); err != nil {
+		return
+	}
+	if rec.Purpose != purpose {
+		err = ErrorInvalidLoginToken
+		return
+	}
+	identifier = rec.Identifier
+	return
+}
+
+// IssueLoginCode 为邮箱或手机号生成6位数字验证码，重新生成会使之前的验证码失效
+func (s *Authed) IssueLoginCode(identifier, purpose string) (code string, err error) {
+	if identifier, err = normalizeIdentifier(identifier); err != nil {
+		return
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return
+	}
+	code = fmt.Sprintf("%06d", n.Int64())
+	err = s.savePasswordless(s.FormatLoginCodeStoreKey(purpose, identifier),
+		&passwordlessRecord{Identifier: identifier, Purpose: purpose, Hash: s.hashLoginCode(identifier, purpose, code)})
+	return
+}
+
+// VerifyLoginCode 校验并作废验证码，失败次数达到PasswordlessMaxAttempts后验证码作废，
+// 同一验证码在进程内串行校验
+func (s *Authed) VerifyLoginCode(identifier, purpose, code string) (err error) {
+	if identifier, err = normalizeIdentifier(identifier); err != nil {
+		return
+	}
+	key := s.FormatLoginCodeStoreKey(purpose, identifier)
+	unlock := s.locks.Lock(key)
+	defer unlock()
+	rec, err := s.getPasswordless(key)
+	if err != nil {
+		return ErrorInvalidLoginCode
+	}
+	want := s.hashLoginCode(identifier, purpose, strings.TrimSpace(code))
+	if subtle.ConstantTimeCompare([]byte(rec.Hash), []byte(want)) != 1 {
+		rec.Attempts++
+		if rec.Attempts >= s.PasswordlessMaxAttempts {
+			_ = s.store.Del(key) // nolint
+		} else if e := s.savePasswordless(key, rec); e != nil {
+			return e
+		}
+		return ErrorInvalidLoginCode
+	}
+	return s.store.Del(key)
+}
+
+// ExchangeLoginLink 登录链接兑换正式令牌
+func (s *Authed) ExchangeLoginLink(token, purpose string, lookup PasswordlessLookup) (string, string, error) {
+	identifier, err := s.VerifyLoginLink(token, purpose)
+	if err != nil {
+		return "", "", err
+	}
+	return s.exchangePasswordless(identifier, "link", lookup)
+}
+
+// ExchangeLoginCode 验证码兑换正式令牌
+func (s *Authed) ExchangeLoginCode(identifier, purpose, code string, lookup PasswordlessLookup) (string, string, error) {
+	if err := s.VerifyLoginCode(identifier, purpose, code); err != nil {
+		return "", "", err
+	}
+	identifier, _ = normalizeIdentifier(identifier) // nolint
+	return s.exchangePasswordless(identifier, "code", lookup)
+}
+
+func (s *Authed) exchangePasswordless(identifier, method string, lookup PasswordlessLookup) (string, string, error) {
+	se, err := lookup(identifier)
+	if err != nil {
+		return "", "", err
+	}
+	if se == nil {
+		return "", "", ErrorInvalidSession
+	}
+	if se.Extends == nil {
+		se.Extends = map[string]any{}
+	}
+	se.Extends["auth"] = "passwordless_" + method
+	return s.CreateToken(se)
+}
+
+func (s *Authed) savePasswordless(key string, rec *passwordlessRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.store.SetWithTTL(key, string(data), s.PasswordlessDuration)
+}
+
+func (s *Authed) getPasswordless(key string) (*passwordlessRecord, error) {
+	data, err := s.store.Get(key)
+	if err != nil || len(data) == 0 {
+		return nil, ErrorInvalidLoginToken
+	}
+	var rec passwordlessRecord
+	if err = json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// hashLoginCode 验证码只有6位，使用带密钥的摘要防止缓存泄露后被离线穷举
+func (s *Authed) hashLoginCode(identifier, purpose, code string) string {
+	return cryptoutil.HMacSha256(s.cryptoKey, []byte(purpose+"|"+identifier+"|"+code))
+}
+
+func hashLoginToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeIdentifier 只接受邮箱或手机号，邮箱统一为小写
+func normalizeIdentifier(identifier string) (string, error) {
+	identifier = strings.TrimSpace(identifier)
+	if identifier == "" {
+		return "", ErrorInvalidIdentifier
+	}
+	if httputil.IsMobile(identifier) {
+		return identifier, nil
+	}
+	if strings.Contains(identifier, "@") && httputil.IsEmail(identifier) {
+		return strings.ToLower(identifier), nil
+	}
+	return "", ErrorInvalidIdentifier
+}
@@ -0,0 +1,123 @@
+package authed
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorpher/gone/cache"
+)
+
+func TestLoginLink(t *testing.T) {
+	a := NewAuthed()
+	lookup := func(identifier string) (*UserSession, error) {
+		return &UserSession{Uid: "1001", Username: identifier}, nil
+	}
+	if _, err := a.IssueLoginLink("not-an-email", "login"); !errors.Is(err, ErrorInvalidIdentifier) {
+		t.Fatalf("expect invalid identifier, got %v", err)
+	}
+	link, err := a.IssueLoginLink("Tom@Example.com", "login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = a.ExchangeLoginLink(link, "reset_password", lookup); !errors.Is(err, ErrorInvalidLoginToken) {
+		t.Fatalf("purpose not checked: %v", err)
+	}
+
+	link, _ = a.IssueLoginLink("Tom@Example.com", "login") // nolint
+	token, _, err := a.ExchangeLoginLink(link, "login", lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := a.VerifyToken(token)
+	if err != nil || payload.Username != "tom@example.com" || payload.Extends["auth"] != "passwordless_link" {
+		t.Fatalf("unexpected payload %+v %v", payload.UserSession, err)
+	}
+	if _, _, err = a.ExchangeLoginLink(link, "login", lookup); !errors.Is(err, ErrorInvalidLoginToken) {
+		t.Fatal("login link reused")
+	}
+}
+
+func TestLoginCode(t *testing.T) {
+	a := NewAuthed()
+	a.PasswordlessMaxAttempts = 3
+	lookup := func(identifier string) (*UserSession, error) {
+		return &UserSession{Uid: identifier}, nil
+	}
+	code, err := a.IssueLoginCode("13800138000", "login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 6 {
+		t.Fatalf("unexpected code %s", code)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	if _, _, err = a.ExchangeLoginCode("13800138000", "login", wrong, lookup); !errors.Is(err, ErrorInvalidLoginCode) {
+		t.Fatal(err)
+	}
+	if _, _, err = a.ExchangeLoginCode("13800138000", "login", code, lookup); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = a.ExchangeLoginCode("13800138000", "login", code, lookup); !errors.Is(err, ErrorInvalidLoginCode) {
+		t.Fatal("login code reused")
+	}
+
+	code, _ = a.IssueLoginCode("13800138000", "login") // nolint
+	if code == wrong {
+		wrong = "222222"
+	}
+	for i := 0; i < 3; i++ {
+		_ = a.VerifyLoginCode("13800138000", "login", wrong) // nolint
+	}
+	if err = a.VerifyLoginCode("13800138000", "login", code); !errors.Is(err, ErrorInvalidLoginCode) {
+		t.Fatal("code should be discarded after max attempts")
+	}
+}
+
+func TestPasswordlessDefaults(t *testing.T) {
+	a := NewAuthed()
+	link, err := a.IssueLoginLink("tom@example.com", "login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := a.IssueLoginCode("tom@example.com", "login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err = a.VerifyLoginLink(link, "login"); err != nil {
+		t.Fatalf("login link expired immediately: %v", err)
+	}
+	if err = a.VerifyLoginCode("tom@example.com", "login", code); err != nil {
+		t.Fatalf("login code expired immediately: %v", err)
+	}
+
+	code, _ = a.IssueLoginCode("tom@example.com", "login") // nolint
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	if err = a.VerifyLoginCode("tom@example.com", "login", wrong); !errors.Is(err, ErrorInvalidLoginCode) {
+		t.Fatal(err)
+	}
+	if err = a.VerifyLoginCode("tom@example.com", "login", code); err != nil {
+		t.Fatalf("code discarded after one wrong attempt: %v", err)
+	}
+}
+
+func TestLoginLinkConcurrentRedeem(t *testing.T) {
+	a := NewAuthed(WithCache(slowCache{cache.NewMemoryCache()}))
+	link, err := a.IssueLoginLink("tom@example.com", "login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := parallel(8, func() error {
+		_, err := a.VerifyLoginLink(link, "login")
+		return err
+	}); n != 1 {
+		t.Fatalf("login link redeemed %d times", n)
+	}
+}
@@ -0,0 +1,217 @@
+package authed
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorpher/gone/cryptoutil"
+)
+
+/*
+服务端会话模式:
+cookie中只保存 <随机ID>.<HMAC签名>，UserSession保存在cache中.
+1. 空闲超时: 超过SessionIdleTimeout未访问则失效，每次访问顺延(滑动过期)
+2. 绝对超时: 创建后超过SessionAbsoluteTimeout必定失效
+3. 登录时调用CreateSession会丢弃请求中已有的会话ID，防止会话固定攻击
+*/
+
+var ErrorSessionExpired = errors.New("session expired")
+var ErrorServerSessionDisabled = errors.New("server session disabled")
+
+// Flash 只读取一次的提示消息
+type Flash struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+type serverSession struct {
+	Session    *UserSession `json:"session"`
+	CreatedAt  int64        `json:"created_at"`
+	LastSeenAt int64        `json:"last_seen_at"`
+	Flashes    []Flash      `json:"flashes,omitempty"`
+}
+
+// WithServerSession 启用服务端会话模式，idle为空闲超时，absolute为绝对超时，为0时使用默认值
+func WithServerSession(idle, absolute time.Duration) OptFunc {
+	return func(s *Authed) *Authed {
+		s.serverSession = true
+		if idle > 0 {
+			s.SessionIdleTimeout = idle
+		}
+		if absolute > 0 {
+			s.SessionAbsoluteTimeout = absolute
+		}
+		return s
+	}
+}
+
+func (s *Authed) FormatSessionStoreKey(id string) string {
+	return fmt.Sprintf("%s/authed/session/%s", s.cookieName, id)
+}
+
+// CreateSession 登录成功后创建服务端会话并写入cookie，请求中已有的会话会被删除
+func (s *Authed) CreateSession(w http.ResponseWriter, req *http.Request, se *UserSession) (sid string, err error) {
+	if !s.serverSession {
+		err = ErrorServerSessionDisabled
+		return
+	}
+	if se == nil {
+		err = ErrorInvalidSession
+		return
+	}
+	if id, ok := s.requestSessionID(req); ok {
+		if err = s.store.Del(s.FormatSessionStoreKey(id)); err != nil {
+			return
+		}
+	}
+	now := time.Now()
+	ss := &serverSession{Session: se, CreatedAt: now.Unix(), LastSeenAt: now.Unix()}
+	return s.saveNewSession(w, ss)
+}
+
+// RegenerateSession 权限变化时更换会话ID，会话数据保持不变
+func (s *Authed) RegenerateSession(w http.ResponseWriter, req *http.Request) (sid string, err error) {
+	id, ss, err := s.loadSession(req)
+	if err != nil {
+		return
+	}
+	if err = s.store.Del(s.FormatSessionStoreKey(id)); err != nil {
+		return
+	}
+	return s.saveNewSession(w, ss)
+}
+
+// DestroySession 退出登录，删除服务端会话和cookie
+func (s *Authed) DestroySession(w http.ResponseWriter, req *http.Request) error {
+	if id, ok := s.requestSessionID(req); ok {
+		if err := s.store.Del(s.FormatSessionStoreKey(id)); err != nil {
+			return err
+		}
+	}
+	s.DeleteCookieToken(w, req)
+	return nil
+}
+
+// AddFlash 添加提示消息，下一次调用Flashes时返回
+func (s *Authed) AddFlash(req *http.Request, kind, message string) error {
+	id, ss, err := s.loadSession(req)
+	if err != nil {
+		return err
+	}
+	ss.Flashes = append(ss.Flashes, Flash{Kind: kind, Message: message})
+	return s.saveSession(id, ss)
+}
+
+// Flashes 读取并清空提示消息
+func (s *Authed) Flashes(req *http.Request) ([]Flash, error) {
+	id, ss, err := s.loadSession(req)
+	if err != nil {
+		return nil, err
+	}
+	flashes := ss.Flashes
+	if len(flashes) == 0 {
+		return nil, nil
+	}
+	ss.Flashes = nil
+	return flashes, s.saveSession(id, ss)
+}
+
+// getServerSession 读取会话并顺延空闲超时
+func (s *Authed) getServerSession(req *http.Request) (*UserSession, error) {
+	id, ss, err := s.loadSession(req)
+	if err != nil {
+		return nil, err
+	}
+	ss.LastSeenAt = time.Now().Unix()
+	if err = s.saveSession(id, ss); err != nil {
+		return nil, err
+	}
+	return ss.Session, nil
+}
+
+func (s *Authed) loadSession(req *http.Request) (id string, ss *serverSession, err error) {
+	if !s.serverSession {
+		err = ErrorServerSessionDisabled
+		return
+	}
+	id, ok := s.requestSessionID(req)
+	if !ok {
+		err = ErrorInvalidSession
+		if s.extractToken(req) == "" {
+			err = ErrorTokenNotFound
+		}
+		return
+	}
+	var data []byte
+	data, err = s.store.Get(s.FormatSessionStoreKey(id))
+	if err != nil || len(data) == 0 {
+		err = ErrorInvalidSession
+		return
+	}
+	ss = &serverSession{}
+	if err = json.Unmarshal(data, ss); err != nil || ss.Session == nil {
+		err = ErrorInvalidSession
+		return
+	}
+	// 时间按秒保存，按整秒比较，避免截断导致提前过期
+	now := time.Now().Unix()
+	if now-ss.LastSeenAt > int64(s.SessionIdleTimeout/time.Second) ||
+		now-ss.CreatedAt > int64(s.SessionAbsoluteTimeout/time.Second) {
+		_ = s.store.Del(s.FormatSessionStoreKey(id)) // nolint
+		err = ErrorSessionExpired
+		return
+	}
+	return
+}
+
+func (s *Authed) saveNewSession(w http.ResponseWriter, ss *serverSession) (sid string, err error) {
+	id := randomToken(32)
+	ss.Session.ID = id
+	ss.Session.ExpiredAt = ss.CreatedAt + int64(s.SessionAbsoluteTimeout/time.Second)
+	if err = s.saveSession(id, ss); err != nil {
+		return
+	}
+	sid = id + "." + s.signSessionID(id)
+	remaining := time.Until(time.Unix(ss.Session.ExpiredAt, 0))
+	if err = s.SetCookieToken(w, sid, int(remaining/time.Second)); err != nil {
+		_ = s.store.Del(s.FormatSessionStoreKey(id)) // nolint
+		sid = ""
+	}
+	return
+}
+
+func (s *Authed) saveSession(id string, ss *serverSession) error {
+	data, err := json.Marshal(ss)
+	if err != nil {
+		return err
+	}
+	ttl := s.SessionIdleTimeout
+	if remaining := time.Until(time.Unix(ss.CreatedAt, 0).Add(s.SessionAbsoluteTimeout)); remaining < ttl {
+		ttl = remaining
+	}
+	if ttl <= 0 {
+		return ErrorSessionExpired
+	}
+	return s.store.SetWithTTL(s.FormatSessionStoreKey(id), string(data), ttl)
+}
+
+// requestSessionID 通过令牌读取链获取会话ID并校验签名
+func (s *Authed) requestSessionID(req *http.Request) (string, bool) {
+	id, signature, ok := strings.Cut(s.extractToken(req), ".")
+	if !ok || id == "" {
+		return "", false
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signSessionID(id))) {
+		return "", false
+	}
+	return id, true
+}
+
+func (s *Authed) signSessionID(id string) string {
+	return cryptoutil.HMacSha256(s.cryptoKey, []byte("session|"+id))
+}
@@ -0,0 +1,131 @@
+package authed
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func sessionRequest(cookies []*http.Cookie) *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	return req
+}
+
+func TestServerSession(t *testing.T) {
+	a := NewAuthed(WithServerSession(time.Minute, time.Hour))
+	if _, err := NewAuthed().CreateSession(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), &UserSession{}); !errors.Is(err, ErrorServerSessionDisabled) {
+		t.Fatal("server session should be disabled by default")
+	}
+
+	// 攻击者预先植入的会话
+	w := httptest.NewRecorder()
+	if _, err := a.CreateSession(w, httptest.NewRequest("GET", "/", nil), &UserSession{Uid: "attacker"}); err != nil {
+		t.Fatal(err)
+	}
+	fixed := w.Result().Cookies()
+
+	w = httptest.NewRecorder()
+	sid, err := a.CreateSession(w, sessionRequest(fixed), &UserSession{Uid: "1001", Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != sid {
+		t.Fatalf("unexpected cookies %v", cookies)
+	}
+	if se := a.GetHTTPSession(sessionRequest(fixed)); se != nil {
+		t.Fatal("old session id still valid after login")
+	}
+	se := a.GetHTTPSession(sessionRequest(cookies))
+	if se == nil || se.Uid != "1001" || se.Roles[0] != "admin" {
+		t.Fatalf("unexpected session %+v", se)
+	}
+
+	forged := sid[:len(sid)-1] + "0"
+	if sid[len(sid)-1] == '0' {
+		forged = sid[:len(sid)-1] + "1"
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+forged)
+	if se = a.GetHTTPSession(req); se != nil {
+		t.Fatal("forged session id accepted")
+	}
+
+	if err = a.AddFlash(sessionRequest(cookies), "info", "saved"); err != nil {
+		t.Fatal(err)
+	}
+	flashes, err := a.Flashes(sessionRequest(cookies))
+	if err != nil || len(flashes) != 1 || flashes[0].Message != "saved" {
+		t.Fatalf("unexpected flashes %v %v", flashes, err)
+	}
+	if flashes, _ = a.Flashes(sessionRequest(cookies)); len(flashes) != 0 {
+		t.Fatal("flash read twice")
+	}
+
+	w = httptest.NewRecorder()
+	if _, err = a.RegenerateSession(w, sessionRequest(cookies)); err != nil {
+		t.Fatal(err)
+	}
+	if se = a.GetHTTPSession(sessionRequest(cookies)); se != nil {
+		t.Fatal("session id not rotated")
+	}
+	cookies = w.Result().Cookies()
+	if se = a.GetHTTPSession(sessionRequest(cookies)); se == nil || se.Uid != "1001" {
+		t.Fatal("regenerated session lost")
+	}
+
+	w = httptest.NewRecorder()
+	if err = a.DestroySession(w, sessionRequest(cookies)); err != nil {
+		t.Fatal(err)
+	}
+	if se = a.GetHTTPSession(sessionRequest(cookies)); se != nil {
+		t.Fatal("destroyed session still valid")
+	}
+}
+
+func TestServerSessionTimeout(t *testing.T) {
+	a := NewAuthed(WithServerSession(time.Minute, time.Hour))
+	w := httptest.NewRecorder()
+	if _, err := a.CreateSession(w, httptest.NewRequest("GET", "/", nil), &UserSession{Uid: "1001"}); err != nil {
+		t.Fatal(err)
+	}
+	req := sessionRequest(w.Result().Cookies())
+	id, _, err := a.loadSession(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟空闲超时
+	_, ss, _ := a.loadSession(req) // nolint
+	ss.LastSeenAt = time.Now().Add(-2 * time.Minute).Unix()
+	if err = a.saveSession(id, ss); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = a.loadSession(req); !errors.Is(err, ErrorSessionExpired) {
+		t.Fatalf("expect idle timeout, got %v", err)
+	}
+}
+
+func TestServerSessionSliding(t *testing.T) {
+	a := NewAuthed(WithServerSession(time.Second, time.Hour))
+	w := httptest.NewRecorder()
+	if _, err := a.CreateSession(w, httptest.NewRequest("GET", "/", nil), &UserSession{Uid: "1001"}); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	// 持续访问时超过空闲时间仍然有效
+	for i := 0; i < 4; i++ {
+		time.Sleep(600 * time.Millisecond)
+		if se := a.GetHTTPSession(sessionRequest(cookies)); se == nil {
+			t.Fatalf("session expired after touch %d", i)
+		}
+	}
+	time.Sleep(2100 * time.Millisecond)
+	if se := a.GetHTTPSession(sessionRequest(cookies)); se != nil {
+		t.Fatal("expect idle session expired")
+	}
+}
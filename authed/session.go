@@ -27,9 +27,18 @@ type UserSession struct {
 	Roles      []string       `json:"roles,omitempty"`
 	Scopes     []string       `json:"scopes,omitempty"`
 	Extends    map[string]any `json:"extends,omitempty"`
+	Act        *Actor         `json:"act,omitempty"` // 代理登录时的实际操作者, 参考 RFC 8693 4.1
 	token      string
 }
 
+// Actor RFC 8693 act声明，嵌套的Act表示委托链中更早的操作者
+type Actor struct {
+	Subject   string `json:"sub"`
+	Username  string `json:"username,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	Act       *Actor `json:"act,omitempty"`
+}
+
 func (u *UserSession) GetIDInt64() int64 {
 	id, _ := strconv.ParseInt(u.ID, 10, 64) //nolint
 	return id
@@ -42,6 +51,11 @@ func (u *UserSession) GetToken() string {
 	return u.token
 }
 
+// IsImpersonated 是否为管理员代理登录的会话
+func (u *UserSession) IsImpersonated() bool {
+	return u.Act != nil
+}
+
 type Payload struct {
 	*UserSession
 	codec.Payload
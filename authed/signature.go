@@ -0,0 +1,259 @@
+package authed
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorpher/gone/cache"
+	"github.com/gorpher/gone/cryptoutil"
+)
+
+/*
+HMAC请求签名:
+Authorization: HMAC-SHA256 KeyId=<id>, SignedHeaders=content-type;host, Signature=<hex>
+X-Signature-Date: unix秒
+X-Signature-Nonce: 随机串
+X-Content-Sha256: 请求体sha256十六进制
+
+待签名字符串按行拼接: 算法、方法、路径、排序后的查询参数、签名头(name:value)、签名头列表、时间戳、随机串、请求体摘要,
+签名为 cryptoutil.HMacSha256(secret, 待签名字符串).
+*/
+
+const (
+	SignatureAlgorithm     = "HMAC-SHA256"
+	SignatureDateHeader    = "X-Signature-Date"
+	SignatureNonceHeader   = "X-Signature-Nonce"
+	SignatureContentHeader = "X-Content-Sha256"
+)
+
+var ErrorInvalidSignature = errors.New("invalid signature")
+var ErrorSignatureExpired = errors.New("signature expired")
+var ErrorSignatureReplay = errors.New("signature nonce already used")
+var ErrorSignatureBodyTooLarge = errors.New("signed request body too large")
+
+// SignatureKeyFunc 根据KeyId返回签名密钥和对应的用户会话，每次调用应返回新的会话对象
+type SignatureKeyFunc func(keyID string) (secret []byte, se *UserSession, err error)
+
+// SignatureAuthenticator HMAC请求签名认证器，随机串在时间窗口内只能使用一次，
+// 防重放在进程内是原子的，多实例部署时并发重放同一请求仍可能通过
+type SignatureAuthenticator struct {
+	MaxSkew     time.Duration // 允许的时间偏差
+	MaxBodySize int64         // 校验签名前最多读取的请求体字节数
+	keyFunc     SignatureKeyFunc
+	store       cache.Cache
+	namespace   string
+	locks       keyLocker
+}
+
+func NewSignatureAuthenticator(store cache.Cache, keyFunc SignatureKeyFunc) *SignatureAuthenticator {
+	return &SignatureAuthenticator{
+		MaxSkew:     time.Minute * 5,
+		MaxBodySize: 10 << 20,
+		keyFunc:     keyFunc,
+		store:       store,
+		namespace:   "authed",
+	}
+}
+
+func (a *SignatureAuthenticator) FormatNonceStoreKey(keyID, nonce string) string {
+	return fmt.Sprintf("%s/authed/nonce/%s/%s", a.namespace, keyID, nonce)
+}
+
+func (a *SignatureAuthenticator) Authenticate(req *http.Request) (*UserSession, error) {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, SignatureAlgorithm+" ") {
+		return nil, ErrorNoCredentials
+	}
+	params := parseSignatureParams(strings.TrimPrefix(auth, SignatureAlgorithm+" "))
+	keyID, signature := params["KeyId"], params["Signature"]
+	if keyID == "" || signature == "" {
+		return nil, ErrorInvalidSignature
+	}
+	timestamp, err := strconv.ParseInt(req.Header.Get(SignatureDateHeader), 10, 64)
+	if err != nil {
+		return nil, ErrorInvalidSignature
+	}
+	if d := time.Since(time.Unix(timestamp, 0)); d > a.MaxSkew || d < -a.MaxSkew {
+		return nil, ErrorSignatureExpired
+	}
+	nonce := req.Header.Get(SignatureNonceHeader)
+	if nonce == "" {
+		return nil, ErrorInvalidSignature
+	}
+	secret, se, err := a.keyFunc(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if se == nil {
+		return nil, ErrorInvalidSignature
+	}
+	bodyHash, err := requestBodyHash(req, a.MaxBodySize)
+	if err != nil {
+		return nil, err
+	}
+	if bodyHash != req.Header.Get(SignatureContentHeader) {
+		return nil, ErrorInvalidSignature
+	}
+	signedHeaders := strings.Split(params["SignedHeaders"], ";")
+	if !containsString(signedHeaders, "host") {
+		return nil, ErrorInvalidSignature
+	}
+	want := cryptoutil.HMacSha256(secret, []byte(canonicalRequest(req, signedHeaders, bodyHash)))
+	if !hmac.Equal([]byte(want), []byte(signature)) {
+		return nil, ErrorInvalidSignature
+	}
+	nonceKey := a.FormatNonceStoreKey(keyID, nonce)
+	unlock := a.locks.Lock(nonceKey)
+	defer unlock()
+	if used, e := a.store.Get(nonceKey); e == nil && len(used) > 0 {
+		return nil, ErrorSignatureReplay
+	}
+	if err = a.store.SetWithTTL(nonceKey, "1", 2*a.MaxSkew); err != nil {
+		return nil, err
+	}
+	if se.Extends == nil {
+		se.Extends = map[string]any{}
+	}
+	se.Extends["auth"] = "hmac"
+	return se, nil
+}
+
+// SignRequest 为请求添加签名，signedHeaders为参与签名的请求头，host始终参与签名
+func SignRequest(req *http.Request, keyID string, secret []byte, signedHeaders ...string) error {
+	bodyHash, err := requestBodyHash(req, 0)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(SignatureDateHeader, strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set(SignatureNonceHeader, randomToken(16))
+	req.Header.Set(SignatureContentHeader, bodyHash)
+	headers := []string{"host"}
+	for _, h := range signedHeaders {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h != "" && h != "host" {
+			headers = append(headers, h)
+		}
+	}
+	sort.Strings(headers)
+	signature := cryptoutil.HMacSha256(secret, []byte(canonicalRequest(req, headers, bodyHash)))
+	req.Header.Set("Authorization", fmt.Sprintf("%s KeyId=%s, SignedHeaders=%s, Signature=%s",
+		SignatureAlgorithm, keyID, strings.Join(headers, ";"), signature))
+	return nil
+}
+
+// SignatureTransport 对发出的请求签名的http.RoundTripper
+type SignatureTransport struct {
+	KeyID         string
+	Secret        []byte
+	SignedHeaders []string
+	Base          http.RoundTripper
+}
+
+func (t *SignatureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTripper 不能修改原始请求
+	r := req.Clone(req.Context())
+	if err := SignRequest(r, t.KeyID, t.Secret, t.SignedHeaders...); err != nil {
+		return nil, err
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
+
+func canonicalRequest(req *http.Request, signedHeaders []string, bodyHash string) string {
+	var b strings.Builder
+	b.WriteString(SignatureAlgorithm + "\n")
+	b.WriteString(strings.ToUpper(req.Method) + "\n")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	b.WriteString(path + "\n")
+	b.WriteString(canonicalQuery(req.URL.Query()) + "\n")
+	for _, h := range signedHeaders {
+		var value string
+		if h == "host" {
+			value = req.Host
+			if value == "" {
+				value = req.URL.Host
+			}
+		} else {
+			value = strings.Join(req.Header.Values(h), ",")
+		}
+		b.WriteString(h + ":" + strings.TrimSpace(value) + "\n")
+	}
+	b.WriteString(strings.Join(signedHeaders, ";") + "\n")
+	b.WriteString(req.Header.Get(SignatureDateHeader) + "\n")
+	b.WriteString(req.Header.Get(SignatureNonceHeader) + "\n")
+	b.WriteString(bodyHash)
+	return b.String()
+}
+
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(values))
+	for _, k := range keys {
+		vs := append([]string(nil), values[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// requestBodyHash 计算请求体摘要，读取后恢复请求体，limit大于0时请求体超过limit返回错误
+func requestBodyHash(req *http.Request, limit int64) (string, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var (
+			r   io.Reader = req.Body
+			err error
+		)
+		if limit > 0 {
+			r = io.LimitReader(req.Body, limit+1)
+		}
+		body, err = io.ReadAll(r)
+		if err != nil {
+			return "", err
+		}
+		if limit > 0 && int64(len(body)) > limit {
+			return "", ErrorSignatureBodyTooLarge
+		}
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func parseSignatureParams(s string) map[string]string {
+	params := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[k] = v
+		}
+	}
+	return params
+}
@@ -9,11 +9,14 @@ import (
 type MemoryCache struct {
 	mutex sync.RWMutex
 	cache map[string]string
+	// timers 每个key的过期定时器，重新设置或删除key时取消旧的定时器
+	timers map[string]*time.Timer
 }
 
 func NewMemoryCache() *MemoryCache {
 	return &MemoryCache{
-		cache: map[string]string{},
+		cache:  map[string]string{},
+		timers: map[string]*time.Timer{},
 	}
 }
 func (c *MemoryCache) Get(k string) ([]byte, error) {
@@ -25,6 +28,10 @@ func (c *MemoryCache) Get(k string) ([]byte, error) {
 func (c *MemoryCache) Set(key string, value interface{}) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	return c.set(key, value)
+}
+
+func (c *MemoryCache) set(key string, value interface{}) error {
 	switch v := value.(type) {
 	case string:
 		c.cache[key] = v
@@ -37,6 +44,7 @@ func (c *MemoryCache) Set(key string, value interface{}) error {
 		}
 		c.cache[key] = string(data)
 	}
+	c.stopTimer(key)
 	return nil
 }
 
@@ -44,14 +52,33 @@ func (c *MemoryCache) Del(key string) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	delete(c.cache, key)
+	c.stopTimer(key)
 	return nil
 }
 
 func (c *MemoryCache) SetWithTTL(key string, value string, duration time.Duration) error {
-	_ = time.AfterFunc(duration, func() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.set(key, value); err != nil {
+		return err
+	}
+	var t *time.Timer
+	t = time.AfterFunc(duration, func() {
 		c.mutex.Lock()
-		delete(c.cache, key)
-		c.mutex.Unlock()
+		defer c.mutex.Unlock()
+		// 已经被重新设置的key由新的定时器负责
+		if c.timers[key] == t {
+			delete(c.cache, key)
+			delete(c.timers, key)
+		}
 	})
-	return c.Set(key, value)
+	c.timers[key] = t
+	return nil
+}
+
+func (c *MemoryCache) stopTimer(key string) {
+	if t, ok := c.timers[key]; ok {
+		t.Stop()
+		delete(c.timers, key)
+	}
 }
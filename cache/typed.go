@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gorpher/gone/codec"
+)
+
+// ErrCodecNotFound MIME类型没有注册编解码器
+var ErrCodecNotFound = errors.New("cache: codec not registered for mime type")
+
+// ErrKeyNotFound 缓存中没有该key，部分实现读取不存在的key时返回空值而不是错误
+var ErrKeyNotFound = errors.New("cache: key not found")
+
+// Typed 按类型读写缓存，值使用codec中按MIME注册的编解码器序列化
+type Typed[T any] struct {
+	cache Cache
+	codec codec.ObjectCodec
+}
+
+// NewTyped 创建类型化缓存，mime为空时使用JSON
+func NewTyped[T any](c Cache, mime string) (*Typed[T], error) {
+	if mime == "" {
+		mime = codec.MIMEJSON
+	}
+	cc, ok := codec.LookupMIME(mime)
+	if !ok {
+		return nil, ErrCodecNotFound
+	}
+	return &Typed[T]{cache: c, codec: cc}, nil
+}
+
+// Get 读取并解码，key不存在时返回底层缓存的错误，底层缓存返回空值时返回ErrKeyNotFound
+func (t *Typed[T]) Get(key string) (T, error) {
+	var v T
+	b, err := t.cache.Get(key)
+	if err != nil {
+		return v, err
+	}
+	if len(b) == 0 {
+		return v, ErrKeyNotFound
+	}
+	err = t.codec.Decode(b, &v)
+	return v, err
+}
+
+func (t *Typed[T]) Set(key string, value T) error {
+	b, err := t.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	// 各实现对[]byte的处理不一致，统一按字符串写入
+	return t.cache.Set(key, string(b))
+}
+
+func (t *Typed[T]) SetWithTTL(key string, value T, duration time.Duration) error {
+	b, err := t.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return t.cache.SetWithTTL(key, string(b), duration)
+}
+
+func (t *Typed[T]) Del(key string) error {
+	return t.cache.Del(key)
+}
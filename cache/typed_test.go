@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorpher/gone/codec"
+)
+
+type typedItem struct {
+	Name  string   `json:"name" yaml:"name" codec:"name"`
+	Count int      `json:"count" yaml:"count" codec:"count"`
+	Tags  []string `json:"tags" yaml:"tags" codec:"tags"`
+}
+
+func TestTyped(t *testing.T) {
+	src := typedItem{Name: "gone", Count: 3, Tags: []string{"a", "b"}}
+	for _, mime := range []string{"", codec.MIMEYAML, codec.MIMEMSGPACK} {
+		c, err := NewTyped[typedItem](NewMemoryCache(), mime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Set("k", src); err != nil {
+			t.Fatal(err)
+		}
+		dst, err := c.Get("k")
+		if err != nil || dst.Name != src.Name || dst.Count != src.Count || len(dst.Tags) != 2 {
+			t.Fatalf("%q: got %+v %v", mime, dst, err)
+		}
+		if err = c.SetWithTTL("ttl", src, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if dst, err = c.Get("ttl"); err != nil || dst.Name != src.Name {
+			t.Fatalf("%q: got %+v %v", mime, dst, err)
+		}
+		if err = c.Del("k"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = c.Get("k"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("%q: deleted key found", mime)
+		}
+	}
+	if _, err := NewTyped[typedItem](NewMemoryCache(), "text/html"); !errors.Is(err, ErrCodecNotFound) {
+		t.Fatalf("expect codec not found, got %v", err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/cipher"
 	"errors"
 	crypto2 "github.com/gorpher/gone/cryptoutil"
+	"hash"
+	"time"
 )
 
 type CryptoCodec interface {
@@ -15,11 +17,16 @@ type CryptoCodec interface {
 type cookieCodec struct {
 	hashKey   []byte
 	blockKey  []byte
-	block     cipher.Block
+	keys      []cookieKey
+	rotation  []CookieKeyPair
 	blockMode crypto2.BlockStreamMode
+	newCipher func(key []byte) (cipher.Block, error)
+	newHash   func() hash.Hash
 	maxLength int
 	maxAge    int64
 	minAge    int64
+	legacy    bool
+	now       func() time.Time
 	err       error
 }
 
@@ -32,4 +39,5 @@ var (
 	errCiphertextInvalid = errors.New("the ciphertext is not valid")
 	errTimestampInvalid  = errors.New("invalid timestamp")
 	errTimestampExpired  = errors.New("expired timestamp")
+	errTimestampTooNew   = errors.New("timestamp is too new")
 )
@@ -3,20 +3,105 @@ package codec
 import (
 	"bytes"
 	"crypto/aes"
-	"fmt"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"github.com/gorpher/gone/core"
 	crypto2 "github.com/gorpher/gone/cryptoutil"
+	"golang.org/x/crypto/hkdf"
+	"io"
 	"strconv"
 	"time"
 )
 
-func NewCookieCodec(hashKey, blockKey []byte) CryptoCodec {
+/*
+cookie编码格式:
+1. v2: base64url(0x02 | 时间戳(8字节，大端) | nonce | 密文 | 认证标签)，
+   使用GCM认证加密，附加数据为 "key|" + 版本和时间戳，GCM密钥由 HKDF(blockKey, hashKey) 派生
+2. v1(旧格式): base64url("时间戳|base64url(CTR密文)|hex(HMAC)")，HMAC的内容为 "key|时间戳|密文"，
+   默认仍然可以解码，迁移完成后使用WithCookieRejectLegacy关闭
+编码使用第一组密钥，解码时依次尝试所有密钥，轮换时把旧密钥放到WithCookieRotationKeys中.
+*/
+
+const (
+	cookieVersion2 byte = 2
+	// cookieClockSkew 允许的服务器时钟误差，单位秒
+	cookieClockSkew = 60
+)
+
+// CookieKeyPair 用于轮换的旧密钥
+type CookieKeyPair struct {
+	HashKey  []byte
+	BlockKey []byte
+}
+
+type cookieKey struct {
+	hashKey []byte
+	block   cipher.Block
+	aead    cipher.AEAD
+}
+
+type CookieCodecOptFunc func(s *cookieCodec)
+
+// WithCookieBlockCipher 设置分组密码，默认AES，分组长度必须是16字节
+func WithCookieBlockCipher(newCipher func(key []byte) (cipher.Block, error)) CookieCodecOptFunc {
+	return func(s *cookieCodec) {
+		s.newCipher = newCipher
+	}
+}
+
+// WithCookieMaxLength 设置编码后的最大长度，0表示不限制，cookie分块保存时需要放大该值
+func WithCookieMaxLength(n int) CookieCodecOptFunc {
+	return func(s *cookieCodec) {
+		s.maxLength = n
+	}
+}
+
+// WithCookieMaxAge 设置最大有效期，单位秒，0表示不限制，默认30天
+func WithCookieMaxAge(seconds int64) CookieCodecOptFunc {
+	return func(s *cookieCodec) {
+		s.maxAge = seconds
+	}
+}
+
+// WithCookieMinAge 设置编码后至少经过多少秒才能解码
+func WithCookieMinAge(seconds int64) CookieCodecOptFunc {
+	return func(s *cookieCodec) {
+		s.minAge = seconds
+	}
+}
+
+// WithCookieRotationKeys 设置只用于解码的旧密钥
+func WithCookieRotationKeys(pairs ...CookieKeyPair) CookieCodecOptFunc {
+	return func(s *cookieCodec) {
+		s.rotation = append(s.rotation, pairs...)
+	}
+}
+
+// WithCookieRejectLegacy 不再解码v1旧格式
+func WithCookieRejectLegacy() CookieCodecOptFunc {
+	return func(s *cookieCodec) {
+		s.legacy = false
+	}
+}
+
+func NewCookieCodec(hashKey, blockKey []byte, opts ...CookieCodecOptFunc) CryptoCodec {
 	s := &cookieCodec{
 		hashKey:   hashKey,
 		blockKey:  blockKey,
 		maxAge:    86400 * 30,
 		maxLength: 4096,
 		blockMode: crypto2.CTR,
+		newCipher: aes.NewCipher,
+		newHash:   sha256.New,
+		legacy:    true,
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	if hashKey == nil {
 		s.err = errHashKeyNotSet
@@ -24,10 +109,44 @@ func NewCookieCodec(hashKey, blockKey []byte) CryptoCodec {
 	if blockKey == nil {
 		s.err = errBlockKeyNotSet
 	}
-	s.block, s.err = aes.NewCipher(s.blockKey)
+	if s.err != nil {
+		return s
+	}
+	for _, pair := range append([]CookieKeyPair{{HashKey: hashKey, BlockKey: blockKey}}, s.rotation...) {
+		k, err := s.newKey(pair)
+		if err != nil {
+			s.err = err
+			return s
+		}
+		s.keys = append(s.keys, k)
+	}
 	return s
 }
 
+func (s *cookieCodec) newKey(pair CookieKeyPair) (k cookieKey, err error) {
+	if pair.HashKey == nil {
+		return k, errHashKeyNotSet
+	}
+	if pair.BlockKey == nil {
+		return k, errBlockKeyNotSet
+	}
+	k.hashKey = pair.HashKey
+	if k.block, err = s.newCipher(pair.BlockKey); err != nil {
+		return k, err
+	}
+	// GCM使用派生密钥，不与旧格式的CTR共用密钥
+	aeadKey := make([]byte, len(pair.BlockKey))
+	if _, err = io.ReadFull(hkdf.New(s.newHash, pair.BlockKey, pair.HashKey, []byte("cookie v2")), aeadKey); err != nil {
+		return k, err
+	}
+	block, err := s.newCipher(aeadKey)
+	if err != nil {
+		return k, err
+	}
+	k.aead, err = cipher.NewGCM(block)
+	return k, err
+}
+
 func (s *cookieCodec) Encode(key, plaintext []byte) ([]byte, error) {
 	if s.err != nil {
 		return nil, s.err
@@ -35,73 +154,114 @@ func (s *cookieCodec) Encode(key, plaintext []byte) ([]byte, error) {
 	if len(plaintext) == 0 {
 		return nil, errPlaintextInvalid
 	}
-	var err error
-	var b = make([]byte, len(plaintext))
-	copy(b, plaintext)
-	// 1. 加密.
-	b, err = crypto2.BlockEncrypt(s.block, s.blockMode, b)
-	if err != nil {
+	k := s.keys[0]
+	header := make([]byte, 9, 9+k.aead.NonceSize()+len(plaintext)+k.aead.Overhead())
+	header[0] = cookieVersion2
+	binary.BigEndian.PutUint64(header[1:], uint64(s.timestamp()))
+	nonce := header[9 : 9+k.aead.NonceSize()]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return nil, err
 	}
+	b := k.aead.Seal(header[:9+len(nonce)], nonce, plaintext, cookieAdditionalData(key, header[:9]))
 	b = core.Base64URLEncode(b)
-	// 2. 根据 "key|date|plaintext" 格式生成hash.
-	b = []byte(fmt.Sprintf("%s|%d|%s|", key, s.timestamp(), b))
-	mac := crypto2.HMacSha256(s.hashKey, b[:len(b)-1])
-
-	// 删除key，尾部追加hash
-	b = append(b, mac...)[len(key)+1:]
-	// 3. 使用base64编码.
-	b = core.Base64URLEncode(b)
-	// 4. 检查长度
 	if s.maxLength != 0 && len(b) > s.maxLength {
 		return nil, errPlaintextTooLong
 	}
 	return b, nil
 }
 
+// cookieAdditionalData 把cookie名称和头部绑定到密文
+func cookieAdditionalData(key, header []byte) []byte {
+	return append(append(append([]byte(nil), key...), '|'), header...)
+}
+
 func (s *cookieCodec) timestamp() int64 {
-	return time.Now().UTC().Unix()
+	return s.now().UTC().Unix()
+}
+
+// checkAge 校验时间戳，t是编码时的时间
+func (s *cookieCodec) checkAge(t int64) error {
+	age := s.timestamp() - t
+	if age < -cookieClockSkew {
+		return errTimestampInvalid
+	}
+	if s.minAge != 0 && age < s.minAge {
+		return errTimestampTooNew
+	}
+	if s.maxAge != 0 && age > s.maxAge {
+		return errTimestampExpired
+	}
+	return nil
 }
 
 func (s *cookieCodec) Decode(key, ciphertext []byte) ([]byte, error) {
 	if s.err != nil {
 		return nil, s.err
 	}
-	// 1. 检查长度.
 	if s.maxLength != 0 && len(ciphertext) > s.maxLength {
 		return nil, errCiphertextTooLong
 	}
-	// 2. 解码base64.
 	b, err := core.Base64URLDecode(ciphertext)
 	if err != nil {
 		return nil, err
 	}
-	// 3. 验证hash值. 格式： "date|ciphertext|mac".
-	parts := bytes.SplitN(b, []byte("|"), 3)
-	if len(parts) != 3 {
-		return nil, errCiphertextInvalid
-	}
-
-	b = append([]byte(string(key)+"|"), b[:len(b)-len(parts[2])-1]...)
-	if string(parts[2]) != crypto2.HMacSha256(s.hashKey, b) {
-		return nil, errCiphertextInvalid
+	if len(b) > 0 && b[0] == cookieVersion2 {
+		return s.decodeV2(key, b)
 	}
-	// 4. 验证日期范围.
-	var t1 int64
-	if t1, err = strconv.ParseInt(string(parts[0]), 10, 64); err != nil {
-		return nil, errTimestampInvalid
+	if s.legacy {
+		return s.decodeLegacy(key, b)
 	}
-	t2 := s.timestamp()
-	if s.minAge != 0 && t1-t2 < s.minAge {
-		return nil, errTimestampExpired
+	return nil, errCiphertextInvalid
+}
+
+func (s *cookieCodec) decodeV2(key, b []byte) ([]byte, error) {
+	for _, k := range s.keys {
+		nonceSize := k.aead.NonceSize()
+		if len(b) < 9+nonceSize+k.aead.Overhead() {
+			return nil, errCiphertextInvalid
+		}
+		plaintext, err := k.aead.Open(nil, b[9:9+nonceSize], b[9+nonceSize:], cookieAdditionalData(key, b[:9]))
+		if err != nil {
+			continue
+		}
+		if err = s.checkAge(int64(binary.BigEndian.Uint64(b[1:9]))); err != nil {
+			return nil, err
+		}
+		return plaintext, nil
 	}
-	if s.maxAge != 0 && t1-t2 > s.maxAge {
-		return nil, errTimestampExpired
+	return nil, errCiphertextInvalid
+}
+
+// decodeLegacy 解码v1格式: "date|ciphertext|mac"
+func (s *cookieCodec) decodeLegacy(key, b []byte) ([]byte, error) {
+	parts := bytes.SplitN(b, []byte("|"), 3)
+	if len(parts) != 3 {
+		return nil, errCiphertextInvalid
 	}
-	// 5. 解密.
-	b, err = core.Base64URLDecode(parts[1])
-	if err != nil {
-		return nil, err
+	signed := append([]byte(string(key)+"|"), b[:len(b)-len(parts[2])-1]...)
+	for _, k := range s.keys {
+		if !hmac.Equal(parts[2], []byte(s.mac(k.hashKey, signed))) {
+			continue
+		}
+		t, err := strconv.ParseInt(string(parts[0]), 10, 64)
+		if err != nil {
+			return nil, errTimestampInvalid
+		}
+		if err = s.checkAge(t); err != nil {
+			return nil, err
+		}
+		encrypted, err := core.Base64URLDecode(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		return crypto2.BlockDecrypt(k.block, s.blockMode, encrypted)
 	}
-	return crypto2.BlockDecrypt(s.block, s.blockMode, b)
+	return nil, errCiphertextInvalid
+}
+
+// mac 计算hex编码的HMAC
+func (s *cookieCodec) mac(hashKey, value []byte) string {
+	h := hmac.New(s.newHash, hashKey)
+	h.Write(value)
+	return hex.EncodeToString(h.Sum(nil))
 }
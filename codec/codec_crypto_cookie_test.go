@@ -0,0 +1,108 @@
+package codec
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorpher/gone/core"
+	crypto2 "github.com/gorpher/gone/cryptoutil"
+	"github.com/gorpher/gone/osutil"
+)
+
+// encodeLegacy 生成v1旧格式
+func encodeLegacy(t *testing.T, s *cookieCodec, key, plaintext []byte) []byte {
+	b, err := crypto2.BlockEncrypt(s.keys[0].block, s.blockMode, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = []byte(fmt.Sprintf("%s|%d|%s|", key, s.timestamp(), core.Base64URLEncode(b)))
+	mac := s.mac(s.keys[0].hashKey, b[:len(b)-1])
+	return core.Base64URLEncode(append(b, mac...)[len(key)+1:])
+}
+
+func TestCookieCodecAge(t *testing.T) {
+	now := time.Now()
+	s := NewCookieCodec(osutil.RandBytes(32), osutil.RandBytes(32), WithCookieMaxAge(3600), WithCookieMinAge(10)).(*cookieCodec)
+	s.now = func() time.Time { return now }
+	encoded, err := s.Encode([]byte("sid"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := encodeLegacy(t, s, []byte("sid"), []byte("value"))
+	for _, c := range []struct {
+		elapsed time.Duration
+		err     error
+	}{
+		{0, errTimestampTooNew},
+		{time.Minute, nil},
+		{2 * time.Hour, errTimestampExpired},
+		{-time.Hour, errTimestampInvalid},
+	} {
+		s.now = func() time.Time { return now.Add(c.elapsed) }
+		for _, v := range [][]byte{encoded, legacy} {
+			if _, err = s.Decode([]byte("sid"), v); err != c.err {
+				t.Fatalf("elapsed %s: got %v, want %v", c.elapsed, err, c.err)
+			}
+		}
+	}
+}
+
+func TestCookieCodecRotation(t *testing.T) {
+	oldPair := CookieKeyPair{HashKey: osutil.RandBytes(32), BlockKey: osutil.RandBytes(16)}
+	old := NewCookieCodec(oldPair.HashKey, oldPair.BlockKey).(*cookieCodec)
+	encoded, err := old.Encode([]byte("sid"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := encodeLegacy(t, old, []byte("sid"), []byte("value"))
+
+	rotated := NewCookieCodec(osutil.RandBytes(32), osutil.RandBytes(16), WithCookieRotationKeys(oldPair))
+	for _, v := range [][]byte{encoded, legacy} {
+		plaintext, err := rotated.Decode([]byte("sid"), v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plaintext) != "value" {
+			t.Fatalf("got %s", plaintext)
+		}
+	}
+	// 新密钥编码，旧编解码器无法解码
+	encoded, err = rotated.Encode([]byte("sid"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = old.Decode([]byte("sid"), encoded); err != errCiphertextInvalid {
+		t.Fatalf("old key decoded new cookie: %v", err)
+	}
+	// 关闭旧格式
+	strict := NewCookieCodec(oldPair.HashKey, oldPair.BlockKey, WithCookieRejectLegacy())
+	if _, err = strict.Decode([]byte("sid"), legacy); err != errCiphertextInvalid {
+		t.Fatalf("legacy accepted: %v", err)
+	}
+}
+
+func TestCookieCodecTamper(t *testing.T) {
+	s := NewCookieCodec(osutil.RandBytes(32), osutil.RandBytes(32))
+	encoded, err := s.Encode([]byte("sid"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := core.Base64URLDecode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 修改时间戳
+	b[8] ^= 1
+	if _, err = s.Decode([]byte("sid"), core.Base64URLEncode(b)); err != errCiphertextInvalid {
+		t.Fatalf("tampered timestamp: %v", err)
+	}
+	b[8] ^= 1
+	b[len(b)-1] ^= 1
+	if _, err = s.Decode([]byte("sid"), core.Base64URLEncode(b)); err != errCiphertextInvalid {
+		t.Fatalf("tampered tag: %v", err)
+	}
+	if _, err = s.Decode([]byte("other"), encoded); err != errCiphertextInvalid {
+		t.Fatalf("cookie name not bound: %v", err)
+	}
+}
@@ -0,0 +1,593 @@
+package codec
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+/*
+JWE紧凑序列化，参考 RFC 7516、RFC 7518 4、5:
+BASE64URL(header).BASE64URL(encrypted_key).BASE64URL(iv).BASE64URL(ciphertext).BASE64URL(tag)
+1. 密钥管理: dir、A128KW/A192KW/A256KW 使用Encode/Decode的key参数，RSA-OAEP-256、ECDH-ES 使用选项设置的公钥和私钥
+2. 内容加密: A128GCM/A192GCM/A256GCM、A128CBC-HS256/A192CBC-HS384/A256CBC-HS512
+3. 解密时header的alg、enc必须与创建时一致，不接受zip和crit
+4. WithJweNested 先签名再加密，header的cty为JWT
+*/
+
+var (
+	ErrJweUnsupportedAlgorithm = errors.New("jwe: unsupported algorithm")
+	ErrJweAlgorithmMismatch    = errors.New("jwe: algorithm mismatch")
+	ErrJweInvalidKey           = errors.New("jwe: invalid key")
+	ErrJweDecryption           = errors.New("jwe: decryption failed")
+	ErrJweNotNested            = errors.New("jwe: payload is not a nested jwt")
+	ErrJweUnsupportedHeader    = errors.New("jwe: unsupported header parameter")
+)
+
+type jweHeader struct {
+	Algorithm          string        `json:"alg"`
+	Encryption         string        `json:"enc"`
+	KeyID              string        `json:"kid,omitempty"`
+	ContentType        string        `json:"cty,omitempty"`
+	Type               string        `json:"typ,omitempty"`
+	EphemeralPublicKey *jweEphemeral `json:"epk,omitempty"`
+	PartyUInfo         string        `json:"apu,omitempty"`
+	PartyVInfo         string        `json:"apv,omitempty"`
+	Zip                string        `json:"zip,omitempty"`
+	Critical           []string      `json:"crit,omitempty"`
+}
+
+// jweEphemeral ECDH-ES的临时公钥，EC或OKP格式的JWK
+type jweEphemeral struct {
+	KTY string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+}
+
+// jweContentCipher 内容加密算法，keySize为CEK字节数
+type jweContentCipher struct {
+	keySize int
+	ivSize  int
+	hash    func() hash.Hash // 为nil时使用AES-GCM
+}
+
+var jweContentCiphers = map[string]jweContentCipher{
+	"A128GCM":       {keySize: 16, ivSize: 12},
+	"A192GCM":       {keySize: 24, ivSize: 12},
+	"A256GCM":       {keySize: 32, ivSize: 12},
+	"A128CBC-HS256": {keySize: 32, ivSize: 16, hash: sha256.New},
+	"A192CBC-HS384": {keySize: 48, ivSize: 16, hash: sha512.New384},
+	"A256CBC-HS512": {keySize: 64, ivSize: 16, hash: sha512.New},
+}
+
+// jweKeyWrapSizes AES密钥包装算法的KEK字节数
+var jweKeyWrapSizes = map[string]int{
+	"A128KW": 16,
+	"A192KW": 24,
+	"A256KW": 32,
+}
+
+type jweCodec struct {
+	err       error
+	algorithm string
+	enc       string
+	content   jweContentCipher
+	keyID     string
+	publicKey crypto.PublicKey
+	privKey   crypto.PrivateKey
+	nested    CryptoCodec
+	signKey   []byte
+}
+
+type JweCodecOptFunc func(j *jweCodec)
+
+// WithJweRecipientKey 设置RSA-OAEP-256、ECDH-ES加密使用的公钥，
+// 支持*rsa.PublicKey、*ecdsa.PublicKey、*ecdh.PublicKey
+func WithJweRecipientKey(pub crypto.PublicKey) JweCodecOptFunc {
+	return func(j *jweCodec) {
+		j.publicKey = pub
+	}
+}
+
+// WithJweDecryptionKey 设置RSA-OAEP-256、ECDH-ES解密使用的私钥，同时用其公钥加密
+func WithJweDecryptionKey(priv crypto.PrivateKey) JweCodecOptFunc {
+	return func(j *jweCodec) {
+		j.privKey = priv
+		if j.publicKey == nil {
+			if p, ok := priv.(interface{ Public() crypto.PublicKey }); ok {
+				j.publicKey = p.Public()
+			}
+		}
+	}
+}
+
+func WithJweKeyID(kid string) JweCodecOptFunc {
+	return func(j *jweCodec) {
+		j.keyID = kid
+	}
+}
+
+// WithJweNested 先用signer签名再加密，解密时必须是签名后的JWT
+func WithJweNested(signer CryptoCodec, signKey []byte) JweCodecOptFunc {
+	return func(j *jweCodec) {
+		j.nested = signer
+		j.signKey = signKey
+	}
+}
+
+// NewJweCodec 创建JWE编解码，alg为密钥管理算法，enc为内容加密算法
+func NewJweCodec(alg, enc string, opts ...JweCodecOptFunc) CryptoCodec {
+	j := &jweCodec{algorithm: alg, enc: enc}
+	for _, opt := range opts {
+		opt(j)
+	}
+	var ok bool
+	if j.content, ok = jweContentCiphers[enc]; !ok {
+		j.err = fmt.Errorf("%w: %s", ErrJweUnsupportedAlgorithm, enc)
+		return j
+	}
+	switch alg {
+	case "dir", "A128KW", "A192KW", "A256KW":
+	case "RSA-OAEP-256":
+		if _, ok = j.publicKey.(*rsa.PublicKey); !ok && j.privKey == nil {
+			j.err = ErrJweInvalidKey
+		}
+	case "ECDH-ES":
+		if j.publicKey == nil && j.privKey == nil {
+			j.err = ErrJweInvalidKey
+		}
+	default:
+		j.err = fmt.Errorf("%w: %s", ErrJweUnsupportedAlgorithm, alg)
+	}
+	return j
+}
+
+func (j *jweCodec) Encode(key, plaintext []byte) ([]byte, error) {
+	if j.err != nil {
+		return nil, j.err
+	}
+	header := jweHeader{Algorithm: j.algorithm, Encryption: j.enc, KeyID: j.keyID, Type: "JWT"}
+	if j.nested != nil {
+		signed, err := j.nested.Encode(j.signKey, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		plaintext = signed
+		header.ContentType = "JWT"
+	}
+	cek, encryptedKey, err := j.encryptKey(key, &header)
+	if err != nil {
+		return nil, err
+	}
+	hb, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	aad := []byte(base64.RawURLEncoding.EncodeToString(hb))
+	iv := make([]byte, j.content.ivSize)
+	if _, err = rand.Read(iv); err != nil {
+		return nil, err
+	}
+	ciphertext, tag, err := j.content.seal(cek, iv, plaintext, aad)
+	if err != nil {
+		return nil, err
+	}
+	enc := base64.RawURLEncoding
+	parts := [][]byte{aad, []byte(enc.EncodeToString(encryptedKey)), []byte(enc.EncodeToString(iv)),
+		[]byte(enc.EncodeToString(ciphertext)), []byte(enc.EncodeToString(tag))}
+	return bytes.Join(parts, []byte{'.'}), nil
+}
+
+func (j *jweCodec) Decode(key, ciphertext []byte) ([]byte, error) {
+	if j.err != nil {
+		return nil, j.err
+	}
+	parts := bytes.Split(ciphertext, []byte{'.'})
+	if len(parts) != 5 {
+		return nil, ErrMalformed
+	}
+	decoded := make([][]byte, 5)
+	for i, p := range parts {
+		b, err := base64.RawURLEncoding.DecodeString(string(p))
+		if err != nil {
+			return nil, ErrMalformed
+		}
+		decoded[i] = b
+	}
+	var header jweHeader
+	if err := json.Unmarshal(decoded[0], &header); err != nil {
+		return nil, ErrMalformed
+	}
+	if header.Algorithm != j.algorithm || header.Encryption != j.enc {
+		return nil, ErrJweAlgorithmMismatch
+	}
+	if header.Zip != "" || len(header.Critical) > 0 {
+		return nil, ErrJweUnsupportedHeader
+	}
+	cek, err := j.decryptKey(key, &header, decoded[1])
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := j.content.open(cek, decoded[2], decoded[3], decoded[4], parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if j.nested != nil {
+		if header.ContentType != "JWT" {
+			return nil, ErrJweNotNested
+		}
+		return j.nested.Decode(j.signKey, plaintext)
+	}
+	return plaintext, nil
+}
+
+// encryptKey 生成CEK并按密钥管理算法加密，dir和ECDH-ES的encrypted_key为空
+func (j *jweCodec) encryptKey(key []byte, header *jweHeader) (cek, encryptedKey []byte, err error) {
+	switch j.algorithm {
+	case "dir":
+		if len(key) != j.content.keySize {
+			return nil, nil, ErrJweInvalidKey
+		}
+		return key, nil, nil
+	case "ECDH-ES":
+		return j.ecdhEncrypt(header)
+	}
+	cek = make([]byte, j.content.keySize)
+	if _, err = rand.Read(cek); err != nil {
+		return nil, nil, err
+	}
+	if j.algorithm == "RSA-OAEP-256" {
+		pub, ok := j.publicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, nil, ErrJweInvalidKey
+		}
+		encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, cek, nil)
+		return cek, encryptedKey, err
+	}
+	if len(key) != jweKeyWrapSizes[j.algorithm] {
+		return nil, nil, ErrJweInvalidKey
+	}
+	encryptedKey, err = aesKeyWrap(key, cek)
+	return cek, encryptedKey, err
+}
+
+func (j *jweCodec) decryptKey(key []byte, header *jweHeader, encryptedKey []byte) ([]byte, error) {
+	switch j.algorithm {
+	case "dir":
+		if len(encryptedKey) != 0 {
+			return nil, ErrMalformed
+		}
+		if len(key) != j.content.keySize {
+			return nil, ErrJweInvalidKey
+		}
+		return key, nil
+	case "ECDH-ES":
+		if len(encryptedKey) != 0 {
+			return nil, ErrMalformed
+		}
+		return j.ecdhDecrypt(header)
+	case "RSA-OAEP-256":
+		priv, ok := j.privKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrJweInvalidKey
+		}
+		cek, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, encryptedKey, nil)
+		if err != nil || len(cek) != j.content.keySize {
+			// 参考 RFC 7516 11.5，使用随机CEK继续解密，不暴露失败位置
+			cek = make([]byte, j.content.keySize)
+			_, _ = rand.Read(cek) // nolint
+		}
+		return cek, nil
+	}
+	if len(key) != jweKeyWrapSizes[j.algorithm] {
+		return nil, ErrJweInvalidKey
+	}
+	cek, err := aesKeyUnwrap(key, encryptedKey)
+	if err != nil || len(cek) != j.content.keySize {
+		return nil, ErrJweDecryption
+	}
+	return cek, nil
+}
+
+func (j *jweCodec) ecdhEncrypt(header *jweHeader) (cek, encryptedKey []byte, err error) {
+	pub, err := ecdhPublicKey(j.publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	ephemeral, err := pub.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	z, err := ephemeral.ECDH(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.EphemeralPublicKey, err = newJweEphemeral(ephemeral.PublicKey()); err != nil {
+		return nil, nil, err
+	}
+	return concatKDF(z, j.enc, nil, nil, j.content.keySize), nil, nil
+}
+
+func (j *jweCodec) ecdhDecrypt(header *jweHeader) ([]byte, error) {
+	priv, err := ecdhPrivateKey(j.privKey)
+	if err != nil {
+		return nil, err
+	}
+	if header.EphemeralPublicKey == nil {
+		return nil, ErrMalformed
+	}
+	epk, err := header.EphemeralPublicKey.publicKey(priv.Curve())
+	if err != nil {
+		return nil, err
+	}
+	z, err := priv.ECDH(epk)
+	if err != nil {
+		return nil, ErrJweDecryption
+	}
+	apu, err := base64.RawURLEncoding.DecodeString(header.PartyUInfo)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	apv, err := base64.RawURLEncoding.DecodeString(header.PartyVInfo)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return concatKDF(z, j.enc, apu, apv, j.content.keySize), nil
+}
+
+func ecdhPublicKey(key crypto.PublicKey) (*ecdh.PublicKey, error) {
+	switch k := key.(type) {
+	case *ecdh.PublicKey:
+		return k, nil
+	case *ecdsa.PublicKey:
+		return k.ECDH()
+	default:
+		return nil, ErrJweInvalidKey
+	}
+}
+
+func ecdhPrivateKey(key crypto.PrivateKey) (*ecdh.PrivateKey, error) {
+	switch k := key.(type) {
+	case *ecdh.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k.ECDH()
+	default:
+		return nil, ErrJweInvalidKey
+	}
+}
+
+var jweCurveNames = map[ecdh.Curve]string{
+	ecdh.P256():   "P-256",
+	ecdh.P384():   "P-384",
+	ecdh.P521():   "P-521",
+	ecdh.X25519(): "X25519",
+}
+
+func newJweEphemeral(pub *ecdh.PublicKey) (*jweEphemeral, error) {
+	name, ok := jweCurveNames[pub.Curve()]
+	if !ok {
+		return nil, ErrJweInvalidKey
+	}
+	raw := pub.Bytes()
+	enc := base64.RawURLEncoding
+	if name == "X25519" {
+		return &jweEphemeral{KTY: "OKP", Crv: name, X: enc.EncodeToString(raw)}, nil
+	}
+	// 非压缩格式 0x04||X||Y
+	size := (len(raw) - 1) / 2
+	return &jweEphemeral{KTY: "EC", Crv: name, X: enc.EncodeToString(raw[1 : 1+size]), Y: enc.EncodeToString(raw[1+size:])}, nil
+}
+
+// publicKey 解析临时公钥，曲线必须与接收方私钥一致，NewPublicKey会校验点是否在曲线上
+func (e *jweEphemeral) publicKey(curve ecdh.Curve) (*ecdh.PublicKey, error) {
+	if jweCurveNames[curve] != e.Crv {
+		return nil, ErrJweInvalidKey
+	}
+	x, err := base64.RawURLEncoding.DecodeString(e.X)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if e.KTY == "OKP" {
+		return curve.NewPublicKey(x)
+	}
+	y, err := base64.RawURLEncoding.DecodeString(e.Y)
+	if err != nil || len(x) != len(y) {
+		return nil, ErrMalformed
+	}
+	raw := append(append([]byte{4}, x...), y...)
+	pub, err := curve.NewPublicKey(raw)
+	if err != nil {
+		return nil, ErrJweInvalidKey
+	}
+	return pub, nil
+}
+
+// concatKDF 参考 NIST SP 800-56A 5.8.1 和 RFC 7518 4.6.2，直接密钥协商时AlgorithmID为enc
+func concatKDF(z []byte, algID string, apu, apv []byte, keySize int) []byte {
+	lengthPrefixed := func(b []byte) []byte {
+		out := make([]byte, 4+len(b))
+		binary.BigEndian.PutUint32(out, uint32(len(b)))
+		copy(out[4:], b)
+		return out
+	}
+	var otherInfo []byte
+	otherInfo = append(otherInfo, lengthPrefixed([]byte(algID))...)
+	otherInfo = append(otherInfo, lengthPrefixed(apu)...)
+	otherInfo = append(otherInfo, lengthPrefixed(apv)...)
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(keySize*8))
+
+	var out []byte
+	for counter := uint32(1); len(out) < keySize; counter++ {
+		h := sha256.New()
+		_ = binary.Write(h, binary.BigEndian, counter) // nolint
+		h.Write(z)
+		h.Write(otherInfo)
+		out = h.Sum(out)
+	}
+	return out[:keySize]
+}
+
+var aesKeyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// aesKeyWrap 参考 RFC 3394 2.2.1
+func aesKeyWrap(kek, cek []byte) ([]byte, error) {
+	if len(cek)%8 != 0 || len(cek) < 16 {
+		return nil, ErrJweInvalidKey
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(cek) / 8
+	r := make([]byte, len(cek))
+	copy(r, cek)
+	a := make([]byte, 8)
+	copy(a, aesKeyWrapIV)
+	buf := make([]byte, 16)
+	for j := 0; j < 6; j++ {
+		for i := 0; i < n; i++ {
+			copy(buf, a)
+			copy(buf[8:], r[i*8:i*8+8])
+			block.Encrypt(buf, buf)
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(buf[:8])^t)
+			copy(r[i*8:], buf[8:])
+		}
+	}
+	return append(a, r...), nil
+}
+
+// aesKeyUnwrap 参考 RFC 3394 2.2.2
+func aesKeyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped)%8 != 0 || len(wrapped) < 24 {
+		return nil, ErrJweDecryption
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(wrapped)/8 - 1
+	a := make([]byte, 8)
+	copy(a, wrapped[:8])
+	r := make([]byte, n*8)
+	copy(r, wrapped[8:])
+	buf := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n - 1; i >= 0; i-- {
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(buf, binary.BigEndian.Uint64(a)^t)
+			copy(buf[8:], r[i*8:i*8+8])
+			block.Decrypt(buf, buf)
+			copy(a, buf[:8])
+			copy(r[i*8:], buf[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(a, aesKeyWrapIV) != 1 {
+		return nil, ErrJweDecryption
+	}
+	return r, nil
+}
+
+func (c jweContentCipher) seal(cek, iv, plaintext, aad []byte) (ciphertext, tag []byte, err error) {
+	if len(cek) != c.keySize {
+		return nil, nil, ErrJweInvalidKey
+	}
+	if c.hash == nil {
+		aead, err := newJweGCM(cek)
+		if err != nil {
+			return nil, nil, err
+		}
+		out := aead.Seal(nil, iv, plaintext, aad)
+		split := len(out) - aead.Overhead()
+		return out[:split], out[split:], nil
+	}
+	// AES-CBC-HMAC，参考 RFC 7518 5.2.2.1，CEK前半部分为MAC密钥，后半部分为加密密钥
+	macKey, encKey := cek[:c.keySize/2], cek[c.keySize/2:]
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	ciphertext = make([]byte, len(plaintext)+padding)
+	copy(ciphertext, plaintext)
+	for i := len(plaintext); i < len(ciphertext); i++ {
+		ciphertext[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+	return ciphertext, c.cbcTag(macKey, aad, iv, ciphertext), nil
+}
+
+func (c jweContentCipher) open(cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	if len(cek) != c.keySize || len(iv) != c.ivSize {
+		return nil, ErrJweDecryption
+	}
+	if c.hash == nil {
+		aead, err := newJweGCM(cek)
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := aead.Open(nil, iv, append(append([]byte{}, ciphertext...), tag...), aad)
+		if err != nil {
+			return nil, ErrJweDecryption
+		}
+		return plaintext, nil
+	}
+	macKey, encKey := cek[:c.keySize/2], cek[c.keySize/2:]
+	if !hmac.Equal(tag, c.cbcTag(macKey, aad, iv, ciphertext)) {
+		return nil, ErrJweDecryption
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, ErrJweDecryption
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, ErrJweDecryption
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, ErrJweDecryption
+		}
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+// cbcTag HMAC(AAD || IV || ciphertext || AL)截取前一半，AL为AAD的位数
+func (c jweContentCipher) cbcTag(macKey, aad, iv, ciphertext []byte) []byte {
+	m := hmac.New(c.hash, macKey)
+	m.Write(aad)
+	m.Write(iv)
+	m.Write(ciphertext)
+	_ = binary.Write(m, binary.BigEndian, uint64(len(aad))*8) // nolint
+	return m.Sum(nil)[:c.keySize/2]
+}
+
+func newJweGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,243 @@
+package codec
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/gorpher/gone/osutil"
+)
+
+// nimbus-jose-jwt 生成的RSA-OAEP-256测试向量使用的私钥
+var jweTestRSAKey = `MIIEvQIBADANBgkqhkiG9w0BAQEFAASCBKcwggSjAgEAAoIBAQCNRCEmf5PlbXKuT4uwnbwGKvFr
+tpi+bDYxOZxxqxdVkZM/bYATAnD1fg9pNvLMKeF+MWJ9kPIMmDgOh9RdnRdLvQGbBzhLmxwhhcua
+2QYiHEZizXmiaXvNP12bzEBhebdX7ObW8izMVW0p0lqHPNzkK3K75B0SxoFMVKkZ7KtBHgepBT5y
+PhPPcNe5lXQeTne5bo3I60DRcN9jTBgMJOXdq0I9o4y6ZmoXdNTm0EyLzn9/EYiHqBxtKFh791EH
+R7wYgyi/t+nOKr4sO74NbEByP0mHDil+mPvZSzFW4l7fPxOclRZvpRIKIub2TroZA9s2WsshGf79
+eqqXYbBB9NNRAgMBAAECggEAIExbZ/nzTplfhwsY3SCzRJW87OuqsJ79JPQPGM4NX7sQ94eJqM7+
+FKLl0yCFErjgnYGdCyiArvB+oJPdsimgkeh83X0hGeg03lVA3/6OsG3WifCAxulnLN44AM8KST8S
+9D9t5+cm5vEBLHazzAfWWTS13s+g9hH8rf8NSqgZ36EutjKlvLdHx1mWcKX7SREFVHT8FWPAbdhT
+LEHUjoWHrfSektnczaSHntq8fFJy6Ld13QkF1ZJRUhtA24XrD+qLTc+M36IuedjeZaLHFB+KyhYR
+3YvXEtrbCug7dCRduG6uTlDCSaSy7xHeTPolWtWo9F202jal54otxiAJFGUHgQKBgQDRAT0s6YQZ
+UfwE0wluXVk0JdhDdCo8sC1aMmKlRKWUkBAqrDl7BI3MF56VOr4ybr90buuscshFf9TtrtBOjHSG
+cfDItSKfhhkW5ewQKB0YqyHzoD6UKT0/XAshFY3esc3uCxuJ/6vOiXV0og9o7eFvr51O0TfDFhmc
+TvW4wirKlQKBgQCtB7UAu8I9Nn8czkd6oXLDRyTWYviuiqFmxR+PM9klgZtsumkeSxO1lkfFoj9+
+G8nFaqYEBA9sPeNtJVTSROCvj/iQtoqpV2NiI/wWeVszpBwsswx2mlks4LJa8aYz9xrsfNoroKYV
+ppefc/MCoSx4M+99RSm3FSpLGZQHAUGyzQKBgQDMQmq4JuuMF1y2lk0ESESyuz21BqV0tDVOjils
+HT+5hmXWXoS6nkO6L2czrrpM7YE82F6JJZBmo7zEIXHBInGLJ3XLoYLZ5qNEhqYDUEDHaBCBWZ1v
+DTKnZlwWFEuXVavNNZvPbUhKTHq25t8qjDki/r09VykpBsM2yNBKpbBOVQKBgCJyUVd3CaFUExQy
+AMrqD0XPCQdhJq7gzGcAQVsp8EXmOoH3zmuIeMECzQEMXuWFNLMHm0tbX5Kl83vMHcnKioyI9ewh
+WxOBYTitf0ceG8j5F97SOl32NmCXzwoJ55Oa0xJXfLuIvOe8hZzp4WwZmBfKBxiCR166aPQQgIaw
+elrVAoGAEJsHomfCI4epxH4oMwqYJMCGy95zloB+2+c86BZCOJAGwnfzbtc2eutWZw61/9sSO8sQ
+CfzA8oX+5HwAgnFVzwW4lNMZohppYcpwN9EyjkPaCXuALC7p5rF2o63wY7JLvnjS2aYZliknh2yW
+6X6fSB0PK0CpvdlAIyRw6Kud0zI=`
+
+// jose4j 生成的ECDH-ES测试向量，与 RFC 7518 附录C 中Bob的密钥相同
+var jweTestECKey = &ecdsa.PrivateKey{
+	PublicKey: ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     jweTestBigInt("weNJy2HscCSM6AEDTDg04biOvhFhyyWvOHQfeF_PxMQ"),
+		Y:     jweTestBigInt("e8lnCO-AlStT-NJVX-crhB7QRYhiix03illJOVAOyck"),
+	},
+	D: jweTestBigInt("VEmDZpDXXK8p8N0Cndsxs924q6nS1RXFASRl6BfUqdw"),
+}
+
+func jweTestBigInt(s string) *big.Int {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return new(big.Int).SetBytes(b)
+}
+
+func TestJweCodecVectors(t *testing.T) {
+	der, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(jweTestRSAKey, "\n", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		alg, enc string
+		opt      JweCodecOptFunc
+		token    string
+		want     string
+	}{
+		{"RSA-OAEP-256", "A128GCM", WithJweDecryptionKey(priv), "eyJlbmMiOiJBMTI4R0NNIiwiYWxnIjoiUlNBLU9BRVAtMjU2In0.fDTxO_ZzZ3Jdrdw-bxvg7u-xWB2q1tp3kI5zH6JfhLUm4h6rt9qDA_wZlRym8-GzEtkUjkTtQGs6HgQx_qlyy8ylCakY5GHsNhCG4m0UNhRiNfcasAs03JSXfON9-tfTJimWD9n4k5OHHhvcrsCW1G3jYeLsK9WHCGRIhNz5ULbo8HBrCTbmZ6bOEQ9mqhdssLpdV24HDpebotf3bgPJqoaTfWU6Uy7tLmPiNuuNRLQ-iTpLyNMTVvGqqZhpcV3lAEN5l77QabI5xLJYucvYjrXQhAEZ7YXO8oRYhGkdG2XXIRcwr87rBeRH-47HAyhZgF_PBPBhhrJNS9UNMqdfBw.FvU4_s7Md6vxnXWd.fw29Q4_gHt4f026DPPV-CNebQ8plJ6IVLX8._apBZrw7WsT8HOmxgCrTwA", "Lorem ipsum dolor sit amet"},
+		{"RSA-OAEP-256", "A128CBC-HS256", WithJweDecryptionKey(priv), "eyJlbmMiOiJBMTI4Q0JDLUhTMjU2IiwiYWxnIjoiUlNBLU9BRVAtMjU2In0.EDq6cNP6Yp1sds5HZ4CkXYp7bs9plIYVZScKvuyxUy0H1VyBC_YWg0HvndPNb-vwh1LA6KMxRazlOwJ9iPR9YzHnYmGgPM3Je_ZzBfiPlRfq6hQBpGnNaypBI1XZ2tyFBhulsVLqyJe2SmM2Ud00kasOdMYgcN8FNFzq7IOE7E0FUQkIwLdUL1nrzepiYDp-5bGkxWRcL02cYfdqdm00G4m0GkUxAmdxa3oPNxZlt2NeBI_UVWQSgJE-DJVJQkDcyA0id27TV2RCDnmujYauNT_wYlyb0bFDx3pYzzNXfAXd4wHZxt75QaLZ5APJ0EVfiXJ0qki6kT-GRVmOimUbQA.vTULZL7LvS0WD8kR8ZUtLg.mb2f0StEmmkuuvsyz8UplMvF58FtZzlu8eEwzvPUvN0.hbhveEN40V-pgG2hSVgyKg", "Lorem ipsum dolor sit amet"},
+		{"ECDH-ES", "A128CBC-HS256", WithJweDecryptionKey(jweTestECKey), "eyJhbGciOiJFQ0RILUVTIiwiZW5jIjoiQTEyOENCQy1IUzI1NiIsImVwayI6eyJrdHkiOiJFQyIsIngiOiJTQzAtRnJHUkVvVkpKSmg1TGhORmZqZnFXMC1XSUFyd3RZMzJzQmFQVVh3IiwieSI6ImFQMWlPRENveU9laTVyS1l2VENMNlRMZFN5UEdUN0djMnFsRnBwNXdiWFEiLCJjcnYiOiJQLTI1NiJ9fQ..3mifklTnTTGuA_etSUBBCw.dj8KFM8OlrQ3rT35nHcHZ7A5p84VB2OZb054ghSjS-M.KOIgnJjz87LGqMtikXGxXw", "Lorem ipsum dolor sit amet."},
+	}
+	for _, tt := range tests {
+		plaintext, err := NewJweCodec(tt.alg, tt.enc, tt.opt).Decode(nil, []byte(tt.token))
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.alg, tt.enc, err)
+		}
+		if string(plaintext) != tt.want {
+			t.Fatalf("%s %s: got %q", tt.alg, tt.enc, plaintext)
+		}
+	}
+}
+
+// RFC 7518 附录C
+func TestJweConcatKDF(t *testing.T) {
+	a, err := ecdh.P256().NewPrivateKey(jweTestBigInt("0_NxaRPUMQoAJt50Gz8YiTr8gRTwyEaCumd-MToTmIo").FillBytes(make([]byte, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := jweTestECKey.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := a.ECDH(b.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := concatKDF(z, "A128GCM", []byte("Alice"), []byte("Bob"), 16)
+	if base64.RawURLEncoding.EncodeToString(key) != "VqqN6vgjbSBcIijNcacQGg" {
+		t.Fatalf("got %x", key)
+	}
+}
+
+// RFC 3394 4.1、4.6
+func TestJweAesKeyWrap(t *testing.T) {
+	tests := []struct{ kek, key, wrapped string }{
+		{"000102030405060708090A0B0C0D0E0F", "00112233445566778899AABBCCDDEEFF", "1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5"},
+		{"000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+			"00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F",
+			"28C9F404C4B810F4CBCCB35CFB87F8263F5786E2D80ED326CBC7F0E71A99F43BFB988B9B7A02DD21"},
+	}
+	for _, tt := range tests {
+		kek, _ := hex.DecodeString(tt.kek)
+		key, _ := hex.DecodeString(tt.key)
+		want, _ := hex.DecodeString(tt.wrapped)
+		wrapped, err := aesKeyWrap(kek, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(wrapped, want) {
+			t.Fatalf("wrap got %X", wrapped)
+		}
+		unwrapped, err := aesKeyUnwrap(kek, wrapped)
+		if err != nil || !bytes.Equal(unwrapped, key) {
+			t.Fatalf("unwrap got %X %v", unwrapped, err)
+		}
+		wrapped[3] ^= 1
+		if _, err = aesKeyUnwrap(kek, wrapped); !errors.Is(err, ErrJweDecryption) {
+			t.Fatalf("tampered unwrap: %v", err)
+		}
+	}
+}
+
+func TestJweCodec(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte(`{"sub":"1","roles":["admin"]}`)
+	for _, enc := range []string{"A128GCM", "A192GCM", "A256GCM", "A128CBC-HS256", "A192CBC-HS384", "A256CBC-HS512"} {
+		tests := []struct {
+			alg  string
+			key  []byte
+			opts []JweCodecOptFunc
+		}{
+			{"dir", osutil.RandBytes(jweContentCiphers[enc].keySize), nil},
+			{"A128KW", osutil.RandBytes(16), nil},
+			{"A256KW", osutil.RandBytes(32), nil},
+			{"RSA-OAEP-256", nil, []JweCodecOptFunc{WithJweDecryptionKey(rsaKey)}},
+			{"ECDH-ES", nil, []JweCodecOptFunc{WithJweDecryptionKey(p384)}},
+			{"ECDH-ES", nil, []JweCodecOptFunc{WithJweDecryptionKey(x25519)}},
+		}
+		for _, tt := range tests {
+			c := NewJweCodec(tt.alg, enc, tt.opts...)
+			token, err := c.Encode(tt.key, plaintext)
+			if err != nil {
+				t.Fatalf("%s %s: %v", tt.alg, enc, err)
+			}
+			if bytes.Count(token, []byte{'.'}) != 4 {
+				t.Fatalf("%s %s: not compact serialization", tt.alg, enc)
+			}
+			decoded, err := c.Decode(tt.key, token)
+			if err != nil {
+				t.Fatalf("%s %s: %v", tt.alg, enc, err)
+			}
+			if !bytes.Equal(decoded, plaintext) {
+				t.Fatalf("%s %s: got %s", tt.alg, enc, decoded)
+			}
+			parts := bytes.Split(token, []byte{'.'})
+			parts[3][0] ^= 1
+			if _, err = c.Decode(tt.key, bytes.Join(parts, []byte{'.'})); err == nil {
+				t.Fatalf("%s %s: tampered token decoded", tt.alg, enc)
+			}
+		}
+	}
+}
+
+func TestJweCodecAlgorithmMismatch(t *testing.T) {
+	key := osutil.RandBytes(32)
+	token, err := NewJweCodec("dir", "A256GCM").Encode(key, []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewJweCodec("A256KW", "A256GCM").Decode(key, token); !errors.Is(err, ErrJweAlgorithmMismatch) {
+		t.Fatalf("alg mismatch: %v", err)
+	}
+	if _, err = NewJweCodec("dir", "A128CBC-HS256").Decode(key, token); !errors.Is(err, ErrJweAlgorithmMismatch) {
+		t.Fatalf("enc mismatch: %v", err)
+	}
+	if _, err = NewJweCodec("dir", "A256GCM").Encode(key[:16], []byte(`{}`)); !errors.Is(err, ErrJweInvalidKey) {
+		t.Fatalf("short key: %v", err)
+	}
+	if _, err = NewJweCodec("none", "A256GCM").Encode(key, []byte(`{}`)); !errors.Is(err, ErrJweUnsupportedAlgorithm) {
+		t.Fatalf("unsupported alg: %v", err)
+	}
+}
+
+func TestJweCodecNested(t *testing.T) {
+	encKey := osutil.RandBytes(32)
+	signKey := osutil.RandBytes(32)
+	c := NewJweCodec("dir", "A256GCM", WithJweNested(NewJwtCodec("HS256"), signKey))
+	plaintext := []byte(`{"sub":"1"}`)
+	token, err := c.Encode(encKey, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := c.Decode(encKey, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, plaintext) {
+		t.Fatalf("got %s", decoded)
+	}
+	// 未签名的JWE不能冒充嵌套令牌
+	plain, err := NewJweCodec("dir", "A256GCM").Encode(encKey, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Decode(encKey, plain); !errors.Is(err, ErrJweNotNested) {
+		t.Fatalf("unsigned payload: %v", err)
+	}
+	other := NewJweCodec("dir", "A256GCM", WithJweNested(NewJwtCodec("HS256"), osutil.RandBytes(32)))
+	if _, err = other.Decode(encKey, token); err == nil {
+		t.Fatal("wrong signing key accepted")
+	}
+}
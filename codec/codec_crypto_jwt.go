@@ -2,6 +2,7 @@ package codec
 
 import (
 	"bytes"
+	"crypto/hmac"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -34,6 +35,11 @@ type Payload struct {
 	JWTID          string     `json:"jti,omitempty"`
 }
 
+// RegisteredClaims 返回注册声明，嵌入Payload的自定义声明可以直接用于jwtutil.Parse
+func (p Payload) RegisteredClaims() Payload {
+	return p
+}
+
 // Audience is a special claim that may either be
 // a single string or an array of strings, as per the RFC 7519.
 type Audience []string
@@ -50,6 +56,16 @@ func (a Audience) MarshalJSON() ([]byte, error) {
 	}
 }
 
+// Contains 是否包含指定的受众
+func (a Audience) Contains(aud string) bool {
+	for i := range a {
+		if a[i] == aud {
+			return true
+		}
+	}
+	return false
+}
+
 // UnmarshalJSON implements an unmarshaling function for "aud" claim.
 func (a *Audience) UnmarshalJSON(b []byte) error {
 	var (
@@ -76,21 +92,27 @@ func (a *Audience) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// NewJwtCodec 创建jwt编解码器，HS256、HS384、HS512、HMAC-SM3使用key作为HMAC密钥，
+// SM2SM3使用key作为PKCS8编码的SM2私钥，解码时key也可以是SM2公钥
 func NewJwtCodec(alg string) CryptoCodec {
 	j := &jwtCodec{
-		sz: JSONEncoder{},
+		sz:        JSONEncoder{},
+		algorithm: alg,
+	}
+	if alg != "SM2SM3" {
+		j.hashFunc, j.err = core.JwtHS(alg)
 	}
-
-	hashFunc, err := core.JwtHS(alg)
-	j.hashFunc = hashFunc
-	j.algorithm = alg
-	j.err = err
 	return j
 }
 
 // ErrNotJSONObject is the error for when a JWT payload is not a JSON object.
 var ErrNotJSONObject = errors.New("jwt: payload is not a valid JSON object")
 
+var (
+	errJwtSignature = errors.New("invalid jwt token")
+	errJwtAlgorithm = errors.New("jwt: algorithm mismatch")
+)
+
 // ErrMalformed indicates a token doesn't have a valid format, as per the RFC 7519.
 var ErrMalformed = errors.New("jwt: malformed token")
 
@@ -113,20 +135,41 @@ func (j *jwtCodec) Encode(key, plaintext []byte) ([]byte, error) {
 	if !isJSONObject(plaintext) {
 		return nil, ErrNotJSONObject
 	}
-	h := j.hashFunc(key)
 	enc := base64.RawURLEncoding
 	h64len := enc.EncodedLen(len(hb))
 	p64len := enc.EncodedLen(len(plaintext))
-	sig64len := enc.EncodedLen(h.Size())
-	token := make([]byte, h64len+1+p64len+1+sig64len)
+	token := make([]byte, h64len+1+p64len+1)
 	enc.Encode(token, hb)
 	token[h64len] = '.'
 	enc.Encode(token[h64len+1:], plaintext)
 	token[h64len+1+p64len] = '.'
-	h.Write(token[:h64len+1+p64len])
-	sig := h.Sum(nil)
-	enc.Encode(token[h64len+1+p64len+1:], sig)
-	return token, nil
+	sig, err := j.sign(key, token[:h64len+1+p64len])
+	if err != nil {
+		return nil, err
+	}
+	sig64 := make([]byte, enc.EncodedLen(len(sig)))
+	enc.Encode(sig64, sig)
+	return append(token, sig64...), nil
+}
+
+func (j *jwtCodec) sign(key, signingInput []byte) ([]byte, error) {
+	if j.algorithm == "SM2SM3" {
+		return sm2JwtSign(key, signingInput)
+	}
+	h := j.hashFunc(key)
+	h.Write(signingInput)
+	return h.Sum(nil), nil
+}
+
+func (j *jwtCodec) verify(key, signingInput, sig []byte) error {
+	if j.algorithm == "SM2SM3" {
+		return sm2JwtVerify(key, signingInput, sig)
+	}
+	expected, _ := j.sign(key, signingInput) // nolint
+	if !hmac.Equal(expected, sig) {
+		return errJwtSignature
+	}
+	return nil
 }
 
 func (j *jwtCodec) Decode(key, ciphertext []byte) ([]byte, error) {
@@ -160,17 +203,16 @@ func (j *jwtCodec) Decode(key, ciphertext []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	hs, err := core.JwtHS(header.Algorithm)
+	// 只接受编解码器的算法，防止用公钥作为HMAC密钥伪造令牌
+	if header.Algorithm != j.algorithm {
+		return nil, errJwtAlgorithm
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(string(sig))
 	if err != nil {
 		return nil, err
 	}
-	h := hs(key)
-	p := ciphertext[:sep1+1+sep2]
-	h.Write(p)
-
-	sha256 := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
-	if sha256 != string(sig) {
-		return nil, errors.New("invalid jwt token")
+	if err = j.verify(key, ciphertext[:sep1+1+sep2], signature); err != nil {
+		return nil, err
 	}
 	return base64.RawURLEncoding.DecodeString(string(cbytes[:sep2]))
 }
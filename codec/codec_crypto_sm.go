@@ -0,0 +1,103 @@
+package codec
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"math/big"
+	"sync"
+
+	crypto2 "github.com/gorpher/gone/cryptoutil"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+	"github.com/tjfoc/gmsm/sm4"
+	x509sm "github.com/tjfoc/gmsm/x509"
+)
+
+// sm2SignatureSize SM2签名为定长的 R||S，与jwtutil的SM2SM3算法一致
+const sm2SignatureSize = 64
+
+// parseSM2PrivateKey 解析PKCS8编码的SM2私钥，支持pem、hex、base64
+func parseSM2PrivateKey(key []byte) (*sm2.PrivateKey, error) {
+	der, err := crypto2.DecodePemHexBase64(key)
+	if err != nil {
+		return nil, err
+	}
+	return x509sm.ParsePKCS8PrivateKey(der, nil)
+}
+
+// parseSM2PublicKey 解析SM2公钥，key是私钥时使用其公钥
+func parseSM2PublicKey(key []byte) (*sm2.PublicKey, error) {
+	der, err := crypto2.DecodePemHexBase64(key)
+	if err != nil {
+		return nil, err
+	}
+	if priv, err := x509sm.ParsePKCS8PrivateKey(der, nil); err == nil {
+		return &priv.PublicKey, nil
+	}
+	return crypto2.ParseSM2PublicKey(der)
+}
+
+func sm2JwtSign(key, signingInput []byte) ([]byte, error) {
+	priv, err := parseSM2PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	r, s, err := sm2.Sm2Sign(priv, signingInput, nil, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, sm2SignatureSize)
+	r.FillBytes(sig[:sm2SignatureSize/2])
+	s.FillBytes(sig[sm2SignatureSize/2:])
+	return sig, nil
+}
+
+func sm2JwtVerify(key, signingInput, sig []byte) error {
+	pub, err := parseSM2PublicKey(key)
+	if err != nil {
+		return err
+	}
+	if len(sig) != sm2SignatureSize {
+		return errJwtSignature
+	}
+	r := new(big.Int).SetBytes(sig[:sm2SignatureSize/2])
+	s := new(big.Int).SetBytes(sig[sm2SignatureSize/2:])
+	if !sm2.Sm2Verify(pub, signingInput, nil, r, s) {
+		return errJwtSignature
+	}
+	return nil
+}
+
+// WithCookieSM4 使用国密套件，SM4分组加密，HMAC-SM3签名，blockKey必须是16字节
+func WithCookieSM4() CookieCodecOptFunc {
+	return func(s *cookieCodec) {
+		s.newCipher = newSM4Cipher
+		s.newHash = sm3.New
+	}
+}
+
+// lockedBlock tjfoc/gmsm的SM4加解密复用内部缓冲区，不能并发使用
+type lockedBlock struct {
+	mu sync.Mutex
+	cipher.Block
+}
+
+func (b *lockedBlock) Encrypt(dst, src []byte) {
+	b.mu.Lock()
+	b.Block.Encrypt(dst, src)
+	b.mu.Unlock()
+}
+
+func (b *lockedBlock) Decrypt(dst, src []byte) {
+	b.mu.Lock()
+	b.Block.Decrypt(dst, src)
+	b.mu.Unlock()
+}
+
+func newSM4Cipher(key []byte) (cipher.Block, error) {
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &lockedBlock{Block: block}, nil
+}
@@ -0,0 +1,125 @@
+package codec
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/gorpher/gone/core"
+	"github.com/gorpher/gone/osutil"
+	"github.com/tjfoc/gmsm/sm2"
+	x509sm "github.com/tjfoc/gmsm/x509"
+)
+
+func TestJwtCodecSM2SM3(t *testing.T) {
+	priv, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPEM, err := x509sm.WritePrivateKeyToPem(priv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509sm.MarshalSm2PublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := core.Base64RawURLEncode(der)
+
+	c := NewJwtCodec("SM2SM3")
+	token, err := c.Encode(privPEM, []byte(`{"sub":"1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range [][]byte{privPEM, pub} {
+		payload, err := c.Decode(key, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(payload) != `{"sub":"1"}` {
+			t.Fatalf("got %s", payload)
+		}
+	}
+	// 篡改签名
+	tampered := append([]byte(nil), token...)
+	tampered[len(tampered)-2] ^= 1
+	if _, err = c.Decode(pub, tampered); err == nil {
+		t.Fatal("tampered token verified")
+	}
+	// HS256令牌不能用SM2SM3编解码器校验
+	hs, err := NewJwtCodec("HS256").Encode(pub, []byte(`{"sub":"admin"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Decode(pub, hs); err != errJwtAlgorithm {
+		t.Fatalf("alg confusion: %v", err)
+	}
+}
+
+func TestJwtCodecHmacSM3(t *testing.T) {
+	c := NewJwtCodec("HMAC-SM3")
+	key := osutil.RandBytes(32)
+	token, err := c.Encode(key, []byte(`{"sub":"1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Decode(key, token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Decode(osutil.RandBytes(32), token); err == nil {
+		t.Fatal("wrong key accepted")
+	}
+}
+
+func TestCookieCodecSM4(t *testing.T) {
+	s := NewCookieCodec(osutil.RandBytes(32), osutil.RandBytes(16), WithCookieSM4())
+	encoded, err := s.Encode([]byte("sid"), []byte("hello sm4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := s.Decode([]byte("sid"), encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, []byte("hello sm4")) {
+		t.Fatalf("got %s", decoded)
+	}
+	if _, err = s.Decode([]byte("other"), encoded); err == nil {
+		t.Fatal("mac with wrong name accepted")
+	}
+	if _, err = NewCookieCodec(osutil.RandBytes(32), osutil.RandBytes(32), WithCookieSM4()).Encode([]byte("sid"), []byte("x")); err == nil {
+		t.Fatal("32 byte sm4 key accepted")
+	}
+}
+
+func TestCookieCodecSM4Concurrent(t *testing.T) {
+	s := NewCookieCodec(osutil.RandBytes(32), osutil.RandBytes(16), WithCookieSM4())
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		go func() {
+			value := osutil.RandBytes(256)
+			for j := 0; j < 50; j++ {
+				encoded, err := s.Encode([]byte("sid"), value)
+				if err != nil {
+					errs <- err
+					return
+				}
+				decoded, err := s.Decode([]byte("sid"), encoded)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(decoded, value) {
+					errs <- errCiphertextInvalid
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
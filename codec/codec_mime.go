@@ -0,0 +1,250 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+按MIME类型注册的编解码器，httputil、ginutil的请求解码和响应协商、cache.Typed共用:
+1. LookupMIME 根据Content-Type选择编解码器，忽略charset等参数
+2. Negotiate 根据Accept选择编解码器，按q值排序，支持 "*\/*" 和 "type/*"
+*/
+
+const (
+	MIMEJSON     = "application/json"
+	MIMEXML      = "application/xml"
+	MIMEXML2     = "text/xml"
+	MIMEYAML     = "application/x-yaml"
+	MIMEYAML2    = "application/yaml"
+	MIMETOML     = "application/toml"
+	MIMEMSGPACK  = "application/x-msgpack"
+	MIMEMSGPACK2 = "application/msgpack"
+	MIMEPROTOBUF = "application/x-protobuf"
+	MIMEPOSTForm = "application/x-www-form-urlencoded"
+)
+
+var (
+	mimeCodecsMu sync.RWMutex
+	mimeCodecs   = map[string]ObjectCodec{}
+	// mimeOrder 注册顺序，协商 "type/*" 时按该顺序选择
+	mimeOrder []string
+)
+
+func init() {
+	RegisterMIME(MIMEJSON, JSONEncoder{})
+	RegisterMIME(MIMEXML, XMLEncoder{})
+	RegisterMIME(MIMEXML2, XMLEncoder{})
+	RegisterMIME(MIMEYAML, YAMLEncoder{})
+	RegisterMIME(MIMEYAML2, YAMLEncoder{})
+	RegisterMIME(MIMETOML, TOMLEncoder{})
+	RegisterMIME(MIMEMSGPACK, MsgpackEncoder{})
+	RegisterMIME(MIMEMSGPACK2, MsgpackEncoder{})
+	RegisterMIME(MIMEPROTOBUF, ProtobufEncoder{})
+	RegisterMIME(MIMEPOSTForm, FormEncoder{})
+}
+
+// RegisterMIME 注册或替换MIME类型的编解码器
+func RegisterMIME(mime string, c ObjectCodec) {
+	mime = normalizeMIME(mime)
+	mimeCodecsMu.Lock()
+	defer mimeCodecsMu.Unlock()
+	if _, ok := mimeCodecs[mime]; !ok {
+		mimeOrder = append(mimeOrder, mime)
+	}
+	mimeCodecs[mime] = c
+}
+
+// LookupMIME 根据Content-Type查找编解码器
+func LookupMIME(contentType string) (ObjectCodec, bool) {
+	mimeCodecsMu.RLock()
+	defer mimeCodecsMu.RUnlock()
+	c, ok := mimeCodecs[normalizeMIME(contentType)]
+	return c, ok
+}
+
+// Negotiate 根据Accept请求头选择响应的MIME类型和编解码器，
+// Accept为空或者没有匹配时返回fallback，fallback没有注册时ok为false
+func Negotiate(accept, fallback string) (mime string, c ObjectCodec, ok bool) {
+	mimeCodecsMu.RLock()
+	defer mimeCodecsMu.RUnlock()
+	for _, r := range parseAccept(accept) {
+		switch {
+		case r == "*/*":
+			// 交给fallback
+		case strings.HasSuffix(r, "/*"):
+			for _, m := range mimeOrder {
+				if strings.HasPrefix(m, r[:len(r)-1]) {
+					return m, mimeCodecs[m], true
+				}
+			}
+		default:
+			if c, ok = mimeCodecs[r]; ok {
+				return r, c, true
+			}
+		}
+	}
+	fallback = normalizeMIME(fallback)
+	c, ok = mimeCodecs[fallback]
+	return fallback, c, ok
+}
+
+// ContentType 返回响应头Content-Type，文本格式带上charset
+func ContentType(mime string) string {
+	switch mime {
+	case MIMEJSON, MIMEXML, MIMEXML2, MIMEYAML, MIMEYAML2, MIMETOML:
+		return mime + "; charset=UTF-8"
+	default:
+		return mime
+	}
+}
+
+func normalizeMIME(contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// parseAccept 解析Accept，按q值从高到低返回，q=0的类型不接受
+func parseAccept(accept string) []string {
+	type mediaRange struct {
+		mime string
+		q    float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mime := normalizeMIME(params[0])
+		if mime == "" {
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.EqualFold(k, "q") {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{mime: mime, q: q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+	out := make([]string, len(ranges))
+	for i := range ranges {
+		out[i] = ranges[i].mime
+	}
+	return out
+}
+
+// XMLEncoder 使用encoding/xml编码，不支持map.
+type XMLEncoder struct{}
+
+func (e XMLEncoder) Encode(src interface{}) ([]byte, error) {
+	return xml.Marshal(src)
+}
+
+func (e XMLEncoder) Decode(src []byte, dst interface{}) error {
+	return xml.Unmarshal(src, dst)
+}
+
+// YAMLEncoder 使用YAML编码，结构体字段使用yaml标签.
+type YAMLEncoder struct{}
+
+func (e YAMLEncoder) Encode(src interface{}) ([]byte, error) {
+	return yaml.Marshal(src)
+}
+
+func (e YAMLEncoder) Decode(src []byte, dst interface{}) error {
+	return yaml.Unmarshal(src, dst)
+}
+
+// TOMLEncoder 使用TOML编码，结构体字段使用toml标签.
+type TOMLEncoder struct{}
+
+func (e TOMLEncoder) Encode(src interface{}) ([]byte, error) {
+	return toml.Marshal(src)
+}
+
+func (e TOMLEncoder) Decode(src []byte, dst interface{}) error {
+	return toml.Unmarshal(src, dst)
+}
+
+// ErrFormValue 表单只能编码扁平的对象
+var ErrFormValue = errors.New("codec: form value must be a flat object")
+
+// FormEncoder 使用application/x-www-form-urlencoded编码，字段使用json标签，
+// 解码时每个字段只取第一个值，数字、布尔值按字符串弱类型转换
+type FormEncoder struct{}
+
+func (e FormEncoder) Encode(src interface{}) ([]byte, error) {
+	if v, ok := src.(url.Values); ok {
+		return []byte(v.Encode()), nil
+	}
+	b, err := json.Marshal(src)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err = dec.Decode(&m); err != nil {
+		return nil, ErrFormValue
+	}
+	values := make(url.Values, len(m))
+	for k, v := range m {
+		switch vv := v.(type) {
+		case nil:
+		case string:
+			values.Set(k, vv)
+		case json.Number:
+			values.Set(k, vv.String())
+		case bool:
+			values.Set(k, strconv.FormatBool(vv))
+		default:
+			return nil, ErrFormValue
+		}
+	}
+	return []byte(values.Encode()), nil
+}
+
+func (e FormEncoder) Decode(src []byte, dst interface{}) error {
+	values, err := url.ParseQuery(string(src))
+	if err != nil {
+		return err
+	}
+	if v, ok := dst.(*url.Values); ok {
+		*v = values
+		return nil
+	}
+	m := make(map[string]interface{}, len(values))
+	for k := range values {
+		m[k] = values.Get(k)
+	}
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           dst,
+		TagName:          "json",
+		WeaklyTypedInput: true,
+		Squash:           true,
+	})
+	if err != nil {
+		return err
+	}
+	return dec.Decode(m)
+}
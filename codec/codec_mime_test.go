@@ -0,0 +1,59 @@
+package codec
+
+import (
+	"reflect"
+	"testing"
+)
+
+type mimeItem struct {
+	Name  string `json:"name" xml:"name" yaml:"name" toml:"name" codec:"name"`
+	Count int    `json:"count" xml:"count" yaml:"count" toml:"count" codec:"count"`
+	Admin bool   `json:"admin" xml:"admin" yaml:"admin" toml:"admin" codec:"admin"`
+}
+
+func TestMIMECodecs(t *testing.T) {
+	src := mimeItem{Name: "gone", Count: 3, Admin: true}
+	for _, mime := range []string{
+		MIMEJSON, MIMEXML, MIMEXML2, MIMEYAML, MIMETOML, MIMEMSGPACK, MIMEPOSTForm,
+	} {
+		c, ok := LookupMIME(mime + "; charset=UTF-8")
+		if !ok {
+			t.Fatalf("%s not registered", mime)
+		}
+		b, err := c.Encode(src)
+		if err != nil {
+			t.Fatalf("%s: %v", mime, err)
+		}
+		var dst mimeItem
+		if err = c.Decode(b, &dst); err != nil {
+			t.Fatalf("%s: %v", mime, err)
+		}
+		if !reflect.DeepEqual(src, dst) {
+			t.Fatalf("%s: got %+v", mime, dst)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, c := range []struct {
+		accept string
+		want   string
+	}{
+		{"", MIMEJSON},
+		{"*/*", MIMEJSON},
+		{"text/html", MIMEJSON},
+		{"application/xml", MIMEXML},
+		{"Application/X-YAML; q=0.9, application/toml", MIMETOML},
+		{"text/html, text/*;q=0.8", MIMEXML2},
+		{"application/x-msgpack;q=0, application/json;q=0.1", MIMEJSON},
+		{"application/msgpack;q=0.5, */*;q=0.1", MIMEMSGPACK2},
+	} {
+		mime, codec, ok := Negotiate(c.accept, MIMEJSON)
+		if !ok || codec == nil || mime != c.want {
+			t.Fatalf("%q: got %s, want %s", c.accept, mime, c.want)
+		}
+	}
+	if _, _, ok := Negotiate("text/html", "text/html"); ok {
+		t.Fatal("unregistered fallback negotiated")
+	}
+}
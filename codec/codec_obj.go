@@ -5,8 +5,15 @@ import (
 	"encoding/gob"
 	"encoding/json"
 	"errors"
+	"reflect"
+
+	ugcodec "github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
 )
 
+// ErrNotProtoMessage 编解码的值没有实现proto.Message
+var ErrNotProtoMessage = errors.New("codec: value is not a proto.Message")
+
 type ObjectCodec interface {
 	codec
 	Encode(src interface{}) ([]byte, error)
@@ -21,7 +28,7 @@ func (e GobEncoder) Encode(src interface{}) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	enc := gob.NewEncoder(buf)
 	if err := enc.Encode(src); err != nil {
-		return nil, errors.New("")
+		return nil, err
 	}
 	return buf.Bytes(), nil
 }
@@ -29,10 +36,7 @@ func (e GobEncoder) Encode(src interface{}) ([]byte, error) {
 // Decode decodes a value using gob.
 func (e GobEncoder) Decode(src []byte, dst interface{}) error {
 	dec := gob.NewDecoder(bytes.NewBuffer(src))
-	if err := dec.Decode(dst); err != nil {
-		return errors.New("")
-	}
-	return nil
+	return dec.Decode(dst)
 }
 
 type JSONEncoder struct{}
@@ -57,3 +61,58 @@ func (e JSONEncoder) Decode(src []byte, dst interface{}) error {
 	}
 	return nil
 }
+
+var (
+	msgpackHandle = &ugcodec.MsgpackHandle{WriteExt: true}
+	cborHandle    = &ugcodec.CborHandle{}
+)
+
+func init() {
+	// 解码到interface{}时，字符串不解码为[]byte，map与encoding/json一致
+	msgpackHandle.RawToString = true
+	msgpackHandle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	cborHandle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+}
+
+// MsgpackEncoder 使用MessagePack编码，结构体字段使用codec或json标签.
+type MsgpackEncoder struct{}
+
+func (e MsgpackEncoder) Encode(src interface{}) (b []byte, err error) {
+	err = ugcodec.NewEncoderBytes(&b, msgpackHandle).Encode(src)
+	return
+}
+
+func (e MsgpackEncoder) Decode(src []byte, dst interface{}) error {
+	return ugcodec.NewDecoderBytes(src, msgpackHandle).Decode(dst)
+}
+
+// CborEncoder 使用CBOR(RFC 8949)编码，结构体字段使用codec或json标签.
+type CborEncoder struct{}
+
+func (e CborEncoder) Encode(src interface{}) (b []byte, err error) {
+	err = ugcodec.NewEncoderBytes(&b, cborHandle).Encode(src)
+	return
+}
+
+func (e CborEncoder) Decode(src []byte, dst interface{}) error {
+	return ugcodec.NewDecoderBytes(src, cborHandle).Decode(dst)
+}
+
+// ProtobufEncoder 使用protobuf编码，src和dst必须实现proto.Message.
+type ProtobufEncoder struct{}
+
+func (e ProtobufEncoder) Encode(src interface{}) ([]byte, error) {
+	m, ok := src.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	return proto.Marshal(m)
+}
+
+func (e ProtobufEncoder) Decode(src []byte, dst interface{}) error {
+	m, ok := dst.(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+	return proto.Unmarshal(src, m)
+}
@@ -0,0 +1,137 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+type Compression string
+
+const (
+	Gzip   Compression = "gzip"
+	Zstd   Compression = "zstd"
+	Snappy Compression = "snappy"
+)
+
+// maxDecompressedSize 解压后的最大长度，防止压缩炸弹
+const maxDecompressedSize = 64 << 20
+
+// ErrDecompressedTooLarge 解压后超过最大长度
+var ErrDecompressedTooLarge = errors.New("codec: decompressed data too large")
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// zstdCodec EncodeAll、DecodeAll可以并发调用，共用一个编解码器
+func zstdCodec() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		if zstdEncoder, zstdErr = zstd.NewWriter(nil); zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressedSize))
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+type compressedCodec struct {
+	codec ObjectCodec
+	algo  Compression
+}
+
+// Compressed 编码后压缩，解码前解压
+func Compressed(codec ObjectCodec, algo Compression) ObjectCodec {
+	return &compressedCodec{codec: codec, algo: algo}
+}
+
+func (c *compressedCodec) Encode(src interface{}) ([]byte, error) {
+	b, err := c.codec.Encode(src)
+	if err != nil {
+		return nil, err
+	}
+	return compress(c.algo, b)
+}
+
+func (c *compressedCodec) Decode(src []byte, dst interface{}) error {
+	b, err := decompress(c.algo, src)
+	if err != nil {
+		return err
+	}
+	return c.codec.Decode(b, dst)
+}
+
+func compress(algo Compression, b []byte) ([]byte, error) {
+	switch algo {
+	case Gzip:
+		buf := new(bytes.Buffer)
+		w := gzip.NewWriter(buf)
+		if _, err := w.Write(b); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		enc, _, err := zstdCodec()
+		if err != nil {
+			return nil, err
+		}
+		return enc.EncodeAll(b, nil), nil
+	case Snappy:
+		return snappy.Encode(nil, b), nil
+	default:
+		return nil, fmt.Errorf("the %s compression is not supported", algo)
+	}
+}
+
+func decompress(algo Compression, b []byte) ([]byte, error) {
+	switch algo {
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		out, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(out) > maxDecompressedSize {
+			return nil, ErrDecompressedTooLarge
+		}
+		return out, nil
+	case Zstd:
+		_, dec, err := zstdCodec()
+		if err != nil {
+			return nil, err
+		}
+		out, err := dec.DecodeAll(b, nil)
+		// 和其他算法一致，超过限制时统一返回ErrDecompressedTooLarge
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, ErrDecompressedTooLarge
+		}
+		return out, err
+	case Snappy:
+		n, err := snappy.DecodedLen(b)
+		if err != nil {
+			return nil, err
+		}
+		if n > maxDecompressedSize {
+			return nil, ErrDecompressedTooLarge
+		}
+		return snappy.Decode(nil, b)
+	default:
+		return nil, fmt.Errorf("the %s compression is not supported", algo)
+	}
+}
@@ -0,0 +1,104 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+/*
+自描述信封: 版本(1字节) | 名称长度(1字节) | 编解码器名称 | 数据
+名称为注册的编解码器，可以带压缩算法，例如 "msgpack+zstd"，
+切换编解码器后按信封中的名称解码，已保存的数据不需要迁移.
+*/
+
+const objectEnvelopeVersion1 byte = 1
+
+var (
+	// ErrObjectEnvelope 信封格式不正确
+	ErrObjectEnvelope = errors.New("codec: malformed object envelope")
+	// ErrObjectCodecUnknown 编解码器没有注册
+	ErrObjectCodecUnknown = errors.New("codec: unknown object codec")
+)
+
+var (
+	objectCodecsMu sync.RWMutex
+	objectCodecs   = map[string]ObjectCodec{
+		"gob":      GobEncoder{},
+		"json":     JSONEncoder{},
+		"msgpack":  MsgpackEncoder{},
+		"cbor":     CborEncoder{},
+		"protobuf": ProtobufEncoder{},
+	}
+)
+
+// RegisterObjectCodec 注册或替换编解码器，名称不能包含 "+"
+func RegisterObjectCodec(name string, c ObjectCodec) {
+	objectCodecsMu.Lock()
+	defer objectCodecsMu.Unlock()
+	objectCodecs[name] = c
+}
+
+// LookupObjectCodec 按名称查找编解码器，"<name>+<compression>" 返回压缩的编解码器
+func LookupObjectCodec(name string) (ObjectCodec, error) {
+	base, algo, compressed := strings.Cut(name, "+")
+	objectCodecsMu.RLock()
+	c, ok := objectCodecs[base]
+	objectCodecsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrObjectCodecUnknown, name)
+	}
+	if !compressed {
+		return c, nil
+	}
+	switch Compression(algo) {
+	case Gzip, Zstd, Snappy:
+		return Compressed(c, Compression(algo)), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrObjectCodecUnknown, name)
+	}
+}
+
+type envelopeCodec struct {
+	name  string
+	codec ObjectCodec
+	err   error
+}
+
+// NewEnvelopeCodec 使用name编码并记录在信封中，解码时使用信封记录的编解码器
+func NewEnvelopeCodec(name string) ObjectCodec {
+	e := &envelopeCodec{name: name}
+	if len(name) > 0xff {
+		e.err = fmt.Errorf("%w: %s", ErrObjectCodecUnknown, name)
+		return e
+	}
+	e.codec, e.err = LookupObjectCodec(name)
+	return e
+}
+
+func (e *envelopeCodec) Encode(src interface{}) ([]byte, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	b, err := e.codec.Encode(src)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, 2+len(e.name)+len(b))
+	out = append(out, objectEnvelopeVersion1, byte(len(e.name)))
+	out = append(out, e.name...)
+	return append(out, b...), nil
+}
+
+func (e *envelopeCodec) Decode(src []byte, dst interface{}) error {
+	if len(src) < 2 || src[0] != objectEnvelopeVersion1 || len(src) < 2+int(src[1]) {
+		return ErrObjectEnvelope
+	}
+	n := int(src[1])
+	c, err := LookupObjectCodec(string(src[2 : 2+n]))
+	if err != nil {
+		return err
+	}
+	return c.Decode(src[2+n:], dst)
+}
@@ -0,0 +1,123 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type objectCodecValue struct {
+	Name  string            `json:"name"`
+	Count int               `json:"count"`
+	Tags  []string          `json:"tags"`
+	Attrs map[string]string `json:"attrs"`
+}
+
+func TestObjectCodecs(t *testing.T) {
+	value := objectCodecValue{
+		Name:  "gone",
+		Count: 3,
+		Tags:  []string{"a", "b"},
+		Attrs: map[string]string{"k": "v"},
+	}
+	for _, name := range []string{"gob", "json", "msgpack", "cbor", "json+gzip", "msgpack+zstd", "cbor+snappy"} {
+		c, err := LookupObjectCodec(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := c.Encode(value)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var got objectCodecValue
+		if err = c.Decode(b, &got); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(value, got) {
+			t.Fatalf("%s: expected %v, got %v", name, value, got)
+		}
+	}
+}
+
+func TestMsgpackDecodeInterface(t *testing.T) {
+	b, err := MsgpackEncoder{}.Encode(map[string]interface{}{"sub": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err = (MsgpackEncoder{}).Decode(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["sub"] != "1" {
+		t.Fatalf("got %#v", got["sub"])
+	}
+}
+
+func TestProtobufEncoder(t *testing.T) {
+	b, err := Compressed(ProtobufEncoder{}, Zstd).Encode(wrapperspb.String("gone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &wrapperspb.StringValue{}
+	if err = Compressed(ProtobufEncoder{}, Zstd).Decode(b, got); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, wrapperspb.String("gone")) {
+		t.Fatalf("got %v", got)
+	}
+	if _, err = (ProtobufEncoder{}).Encode("gone"); err != ErrNotProtoMessage {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestEnvelopeCodec(t *testing.T) {
+	value := map[string]string{"foo": "bar"}
+	old, err := NewEnvelopeCodec("json").Encode(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 切换编解码器后仍然可以解码旧数据
+	c := NewEnvelopeCodec("msgpack+zstd")
+	current, err := c.Encode(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range [][]byte{old, current} {
+		var got map[string]string
+		if err = c.Decode(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(value, got) {
+			t.Fatalf("expected %v, got %v", value, got)
+		}
+	}
+	if _, err = NewEnvelopeCodec("xml").Encode(value); !errors.Is(err, ErrObjectCodecUnknown) {
+		t.Fatalf("got %v", err)
+	}
+	if err = c.Decode([]byte("{}"), &value); err != ErrObjectEnvelope {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	big := bytes.Repeat([]byte{0}, maxDecompressedSize+1)
+	for _, algo := range []Compression{Gzip, Zstd, Snappy} {
+		b, err := compress(algo, big)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = decompress(algo, b); err != ErrDecompressedTooLarge {
+			t.Fatalf("%s: got %v", algo, err)
+		}
+	}
+}
+
+func TestGobEncoderError(t *testing.T) {
+	if _, err := (GobEncoder{}).Encode(make(chan int)); err == nil || err.Error() == "" {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -1,11 +1,35 @@
 package cookie
 
 import (
+	"errors"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Prefix cookie名称前缀, 参考 RFC 6265bis 4.1.3
+type Prefix string
+
+const (
+	PrefixNone   Prefix = ""
+	PrefixSecure Prefix = "__Secure-" // 必须Secure
+	PrefixHost   Prefix = "__Host-"   // 必须Secure, Path=/, 不能设置Domain
+)
+
+const (
+	// ChunkSize 单个cookie值的最大长度，给名称和属性预留空间，保证整条Set-Cookie不超过4096字节
+	ChunkSize = 3800
+	// MaxChunks 最多分块数量
+	MaxChunks = 16
+	// chunkMarker 分块后主cookie的值为 chunks!<n>, 各分块名称为 <name>_<i>,
+	// cookie值都经过url.QueryEscape, "!"会被转义, 普通值不会与标记混淆
+	chunkMarker = "chunks!"
+)
+
+var ErrValueTooLong = errors.New("cookie value too long")
+
 var optional = &Optionals{
 	Path:     "/",
 	HTTPOnly: true,
@@ -21,40 +45,126 @@ type Optionals struct {
 	// MaxAge=0 means no 'Max-Age' attribute specified.
 	// MaxAge<0 means delete cookie now, equivalently 'Max-Age: 0'
 	// MaxAge>0 means Max-Age attribute present and given in seconds
-	MaxAge   int
-	Secure   bool
-	HTTPOnly bool
-	SameSite http.SameSite
+	MaxAge      int
+	Secure      bool
+	HTTPOnly    bool
+	SameSite    http.SameSite
+	Partitioned bool   // CHIPS 分区cookie，必须Secure
+	Prefix      Prefix // 名称前缀
+}
+
+// DefaultOptionals 返回默认选项的副本
+func DefaultOptionals() *Optionals {
+	o := *optional
+	return &o
+}
+
+// SetDefaultOptionals 修改包级默认选项，影响 Set、Delete、SetCryptoCookie 等函数
+func SetDefaultOptionals(o Optionals) {
+	optional = &o
+}
+
+// Name 返回带前缀的cookie名称
+func (o *Optionals) Name(name string) string {
+	if o.Prefix == PrefixNone || strings.HasPrefix(name, string(o.Prefix)) {
+		return name
+	}
+	return string(o.Prefix) + name
+}
+
+// Cookie 根据选项生成cookie，maxAge单位为秒，0表示使用选项中的MaxAge/Expires，小于0表示删除.
+// 前缀、分区和SameSite=None要求的属性会被强制设置.
+func (o *Optionals) Cookie(name, value string, maxAge int) *http.Cookie {
+	c := &http.Cookie{
+		Name:       o.Name(name),
+		Value:      value,
+		Path:       o.Path,
+		Domain:     o.Domain,
+		Expires:    o.Expires,
+		RawExpires: o.RawExpires,
+		MaxAge:     o.MaxAge,
+		Secure:     o.Secure,
+		HttpOnly:   o.HTTPOnly,
+		SameSite:   o.SameSite,
+	}
+	switch {
+	case maxAge > 0:
+		c.MaxAge = maxAge
+		c.Expires = time.Now().Add(time.Duration(maxAge) * time.Second).UTC()
+	case maxAge < 0:
+		c.MaxAge = -1
+		c.Expires = time.Unix(0, 0)
+	}
+	if o.Prefix == PrefixSecure || o.Partitioned || c.SameSite == http.SameSiteNoneMode {
+		c.Secure = true
+	}
+	if o.Prefix == PrefixHost {
+		c.Secure = true
+		c.Path = "/"
+		c.Domain = ""
+	}
+	return c
+}
+
+// SetWith 使用指定选项写入cookie，值超过ChunkSize时自动分块
+func SetWith(w http.ResponseWriter, name, value string, maxAge int, o *Optionals) error {
+	if o == nil {
+		o = optional
+	}
+	escaped := url.QueryEscape(value)
+	if len(escaped) <= ChunkSize {
+		writeCookie(w, o, o.Cookie(name, escaped, maxAge))
+		return nil
+	}
+	n := (len(escaped) + ChunkSize - 1) / ChunkSize
+	if n > MaxChunks {
+		return ErrValueTooLong
+	}
+	writeCookie(w, o, o.Cookie(name, chunkMarker+strconv.Itoa(n), maxAge))
+	for i := 0; i < n; i++ {
+		end := (i + 1) * ChunkSize
+		if end > len(escaped) {
+			end = len(escaped)
+		}
+		writeCookie(w, o, o.Cookie(chunkName(name, i+1), escaped[i*ChunkSize:end], maxAge))
+	}
+	return nil
+}
+
+// GetValueWith 使用指定选项读取cookie值，自动合并分块
+func GetValueWith(r *http.Request, name string, o *Optionals) string {
+	if o == nil {
+		o = optional
+	}
+	raw := getRawValue(r, o.Name(name))
+	if raw == "" {
+		return ""
+	}
+	v, _ := url.QueryUnescape(raw) // nolint
+	return v
+}
+
+// DeleteWith 使用指定选项删除cookie及其分块
+func DeleteWith(w http.ResponseWriter, r *http.Request, name string, o *Optionals) {
+	if o == nil {
+		o = optional
+	}
+	if n := chunkCount(Get(r, o.Name(name))); n > 0 {
+		for i := 1; i <= n; i++ {
+			writeCookie(w, o, o.Cookie(chunkName(name, i), "", -1))
+		}
+	}
+	writeCookie(w, o, o.Cookie(name, "", -1))
 }
 
 func Set(w http.ResponseWriter, name, value string) {
-	http.SetCookie(w, &http.Cookie{
-		Name:       name,
-		Value:      url.QueryEscape(value),
-		Path:       optional.Path,
-		Domain:     optional.Domain,
-		Expires:    optional.Expires,
-		RawExpires: optional.RawExpires,
-		MaxAge:     optional.MaxAge,
-		Secure:     optional.Secure,
-		HttpOnly:   optional.HTTPOnly,
-		SameSite:   optional.SameSite,
-	})
+	_ = SetWith(w, name, value, 0, optional) // nolint
 }
 
 func SetWithExpires(w http.ResponseWriter, name, value string, expires int64) {
-	http.SetCookie(w, &http.Cookie{
-		Name:       name,
-		Value:      url.QueryEscape(value),
-		Path:       optional.Path,
-		Domain:     optional.Domain,
-		Expires:    time.Unix(expires, 0),
-		RawExpires: optional.RawExpires,
-		MaxAge:     optional.MaxAge,
-		Secure:     optional.Secure,
-		HttpOnly:   optional.HTTPOnly,
-		SameSite:   optional.SameSite,
-	})
+	o := *optional
+	o.Expires = time.Unix(expires, 0)
+	_ = SetWith(w, name, value, 0, &o) // nolint
 }
 
 func Get(r *http.Request, key string) *http.Cookie {
@@ -68,29 +178,57 @@ func Get(r *http.Request, key string) *http.Cookie {
 }
 
 func GetValue(r *http.Request, key string) string {
-	cookies := r.Cookies()
-	for i := range cookies {
-		if cookies[i].Name == key {
-			if cookies[i].Value != "" {
-				v, _ := url.QueryUnescape(cookies[i].Value)
-				return v
-			}
+	return GetValueWith(r, key, optional)
+}
+
+func Delete(w http.ResponseWriter, name string) {
+	writeCookie(w, optional, optional.Cookie(name, "", -1))
+}
+
+// getRawValue 读取未解码的cookie值，主cookie为分块标记时按顺序拼接各分块
+func getRawValue(r *http.Request, name string) string {
+	c := Get(r, name)
+	if c == nil {
+		return ""
+	}
+	n := chunkCount(c)
+	if n == 0 {
+		return c.Value
+	}
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		chunk := Get(r, chunkName(name, i))
+		if chunk == nil {
+			return ""
 		}
+		b.WriteString(chunk.Value)
 	}
-	return ""
+	return b.String()
 }
 
-func Delete(w http.ResponseWriter, name string) {
-	http.SetCookie(w, &http.Cookie{
-		Name:       name,
-		Value:      "",
-		Path:       optional.Path,
-		Domain:     optional.Domain,
-		Expires:    optional.Expires,
-		RawExpires: optional.RawExpires,
-		MaxAge:     0,
-		Secure:     optional.Secure,
-		HttpOnly:   optional.HTTPOnly,
-		SameSite:   optional.SameSite,
-	})
+func chunkCount(c *http.Cookie) int {
+	if c == nil || !strings.HasPrefix(c.Value, chunkMarker) {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(c.Value, chunkMarker))
+	if err != nil || n <= 0 || n > MaxChunks {
+		return 0
+	}
+	return n
+}
+
+func chunkName(name string, i int) string {
+	return name + "_" + strconv.Itoa(i)
+}
+
+// writeCookie net/http 在go1.23之前不支持Partitioned属性，这里手动追加
+func writeCookie(w http.ResponseWriter, o *Optionals, c *http.Cookie) {
+	v := c.String()
+	if v == "" {
+		return
+	}
+	if o.Partitioned {
+		v += "; Partitioned"
+	}
+	w.Header().Add("Set-Cookie", v)
 }
@@ -3,8 +3,6 @@ package cookie
 import (
 	"github.com/gorpher/gone/codec"
 	"net/http"
-	"net/url"
-	"time"
 )
 
 var (
@@ -22,42 +20,39 @@ var (
 		0xf4, 0xde, 0x16, 0x2b, 0x8f, 0xaa, 0xf3, 0x98,
 	}
 )
-var cryptoCodec = codec.NewCookieCodec(hashKey, blockKey)
+
+// 加密后的值超过单个cookie长度时会分块保存
+var cryptoCodec = codec.NewCookieCodec(hashKey, blockKey, codec.WithCookieMaxLength(ChunkSize*MaxChunks))
 
 func SetCodec(ck, hashKey, blockKey []byte) {
-	cryptoCodec = codec.NewCookieCodec(hashKey, blockKey)
+	cryptoCodec = codec.NewCookieCodec(hashKey, blockKey, codec.WithCookieMaxLength(ChunkSize*MaxChunks))
 	cryptoKey = ck
 }
 
 func SetCryptoCookie(w http.ResponseWriter, key, value string, maxAge int) (err error) {
+	return SetCryptoCookieWith(w, key, value, maxAge, optional)
+}
+
+// SetCryptoCookieWith 使用指定选项写入加密cookie
+func SetCryptoCookieWith(w http.ResponseWriter, key, value string, maxAge int, o *Optionals) (err error) {
 	var cryptoBytes []byte
 	cryptoBytes, err = cryptoCodec.Encode(cryptoKey, []byte(value))
 	if err != nil {
 		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     key,
-		Value:    url.QueryEscape(string(cryptoBytes)),
-		Path:     "/",
-		Domain:   "",
-		Expires:  time.Now().Add(time.Duration(maxAge)).UTC(),
-		MaxAge:   maxAge,
-		Secure:   false,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	})
-	return err
+	return SetWith(w, key, string(cryptoBytes), maxAge, o)
 }
 
 func GetCryptoCookie(req *http.Request, k string) string {
+	return GetCryptoCookieWith(req, k, optional)
+}
+
+// GetCryptoCookieWith 使用指定选项读取加密cookie，优先读取同名请求头
+func GetCryptoCookieWith(req *http.Request, k string, o *Optionals) string {
 	var value []byte
 	value = []byte(req.Header.Get(k))
 	if len(value) == 0 {
-		c, err := req.Cookie(k)
-		if err != nil {
-			return ""
-		}
-		value = []byte(c.Value)
+		value = []byte(GetValueWith(req, k, o))
 	}
 	if len(value) == 0 {
 		return ""
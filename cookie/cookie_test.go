@@ -0,0 +1,81 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func replay(w *httptest.ResponseRecorder) *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	return req
+}
+
+func TestOptionalsCookie(t *testing.T) {
+	o := &Optionals{Path: "/app", Domain: "example.com", Prefix: PrefixHost, SameSite: http.SameSiteStrictMode}
+	c := o.Cookie("sid", "v", 3600)
+	if c.Name != "__Host-sid" || !c.Secure || c.Path != "/" || c.Domain != "" {
+		t.Fatalf("host prefix not enforced: %+v", c)
+	}
+	if d := time.Until(c.Expires); d < 59*time.Minute || d > time.Hour {
+		t.Fatalf("expires should be maxAge seconds, got %s", d)
+	}
+	w := httptest.NewRecorder()
+	writeCookie(w, &Optionals{Partitioned: true}, (&Optionals{Partitioned: true}).Cookie("sid", "v", 0))
+	if v := w.Header().Get("Set-Cookie"); !strings.HasSuffix(v, "; Partitioned") || !strings.Contains(v, "Secure") {
+		t.Fatalf("unexpected partitioned cookie %s", v)
+	}
+}
+
+func TestChunkedCookie(t *testing.T) {
+	o := &Optionals{Path: "/", HTTPOnly: true, Prefix: PrefixSecure}
+	value := strings.Repeat("0123456789abcdef", 1000)
+	w := httptest.NewRecorder()
+	if err := SetWith(w, "big", value, 60, o); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 6 {
+		t.Fatalf("expect 1 marker and 5 chunks, got %d", len(cookies))
+	}
+	for _, c := range cookies {
+		if len(c.String()) > 4096 {
+			t.Fatalf("cookie %s too large", c.Name)
+		}
+	}
+	if got := GetValueWith(replay(w), "big", o); got != value {
+		t.Fatalf("reassembled value mismatch, length %d", len(got))
+	}
+
+	w = httptest.NewRecorder()
+	if err := SetWith(w, "big", strings.Repeat("x", ChunkSize*MaxChunks+1), 60, o); err != ErrValueTooLong {
+		t.Fatalf("expect too long, got %v", err)
+	}
+
+	// 与分块标记相同的普通值
+	for _, v := range []string{"chunks-2", chunkMarker + "2"} {
+		w = httptest.NewRecorder()
+		if err := SetWith(w, "small", v, 60, o); err != nil {
+			t.Fatal(err)
+		}
+		if got := GetValueWith(replay(w), "small", o); got != v {
+			t.Fatalf("value %q read as %q", v, got)
+		}
+	}
+}
+
+func TestChunkedCryptoCookie(t *testing.T) {
+	value := strings.Repeat("session-data;", 600)
+	w := httptest.NewRecorder()
+	if err := SetCryptoCookie(w, "enc", value, 60); err != nil {
+		t.Fatal(err)
+	}
+	if got := GetCryptoCookie(replay(w), "enc"); got != value {
+		t.Fatal("crypto cookie mismatch")
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"crypto/hmac"
 	"fmt"
 	"hash"
+
+	"github.com/tjfoc/gmsm/sm3"
 )
 
+// JwtHS 返回HMAC算法，HMAC-SM3为国密HMAC
 func JwtHS(alg string) (func(key []byte) hash.Hash, error) {
 	switch alg {
 	case "HS256":
@@ -21,6 +24,10 @@ func JwtHS(alg string) (func(key []byte) hash.Hash, error) {
 		return func(key []byte) hash.Hash {
 			return hmac.New(crypto.SHA512.New, key)
 		}, nil
+	case "HMAC-SM3":
+		return func(key []byte) hash.Hash {
+			return hmac.New(sm3.New, key)
+		}, nil
 	default:
 		return nil, fmt.Errorf("the %s algorithm is not supported", alg)
 	}
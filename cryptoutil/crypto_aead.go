@@ -0,0 +1,112 @@
+package cryptoutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+/*
+AEAD 认证加密，加密的同时校验完整性，密文被篡改时解密失败:
+1. AES-GCM 密钥长度16、24、32字节，nonce 12字节
+2. ChaCha20-Poly1305 密钥32字节，nonce 12字节，没有AES硬件指令时更快
+3. XChaCha20-Poly1305 密钥32字节，nonce 24字节，随机nonce不用担心碰撞
+*/
+
+type AEADMode string
+
+const (
+	AESGCM            AEADMode = "AES-GCM"
+	ChaCha20Poly1305  AEADMode = "ChaCha20-Poly1305"
+	XChaCha20Poly1305 AEADMode = "XChaCha20-Poly1305"
+)
+
+var (
+	// ErrAEADDecryption 密文被篡改、密钥或附加数据不正确
+	ErrAEADDecryption = errors.New("cryptoutil: message authentication failed")
+	// ErrAEADCiphertextShort 密文短于nonce和认证标签
+	ErrAEADCiphertextShort = errors.New("cryptoutil: ciphertext too short")
+)
+
+// NewAEAD 根据模式创建AEAD.
+func NewAEAD(mode AEADMode, key []byte) (cipher.AEAD, error) {
+	switch mode {
+	case AESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case ChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	case XChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	default:
+		return nil, fmt.Errorf("%s aead unsupported", mode)
+	}
+}
+
+// AEADEncrypt 使用随机nonce加密，返回 nonce||密文||认证标签，additionalData参与认证但不加密.
+func AEADEncrypt(mode AEADMode, key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := NewAEAD(mode, key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// AEADDecrypt 解密AEADEncrypt的结果.
+func AEADDecrypt(mode AEADMode, key, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := NewAEAD(mode, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrAEADCiphertextShort
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrAEADDecryption
+	}
+	return plaintext, nil
+}
+
+// EncryptByAesGCM AES-GCM加密，key长度：16, 24, 32 bytes.
+func EncryptByAesGCM(origData, key, additionalData []byte) ([]byte, error) {
+	return AEADEncrypt(AESGCM, key, origData, additionalData)
+}
+
+// DecryptByAesGCM AES-GCM解密.
+func DecryptByAesGCM(encrypted, key, additionalData []byte) ([]byte, error) {
+	return AEADDecrypt(AESGCM, key, encrypted, additionalData)
+}
+
+// EncryptByChaCha20Poly1305 ChaCha20-Poly1305加密，key长度32 bytes.
+func EncryptByChaCha20Poly1305(origData, key, additionalData []byte) ([]byte, error) {
+	return AEADEncrypt(ChaCha20Poly1305, key, origData, additionalData)
+}
+
+// DecryptByChaCha20Poly1305 ChaCha20-Poly1305解密.
+func DecryptByChaCha20Poly1305(encrypted, key, additionalData []byte) ([]byte, error) {
+	return AEADDecrypt(ChaCha20Poly1305, key, encrypted, additionalData)
+}
+
+// EncryptByXChaCha20Poly1305 XChaCha20-Poly1305加密，key长度32 bytes.
+func EncryptByXChaCha20Poly1305(origData, key, additionalData []byte) ([]byte, error) {
+	return AEADEncrypt(XChaCha20Poly1305, key, origData, additionalData)
+}
+
+// DecryptByXChaCha20Poly1305 XChaCha20-Poly1305解密.
+func DecryptByXChaCha20Poly1305(encrypted, key, additionalData []byte) ([]byte, error) {
+	return AEADDecrypt(XChaCha20Poly1305, key, encrypted, additionalData)
+}
@@ -0,0 +1,161 @@
+package cryptoutil
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/gorpher/gone/osutil"
+)
+
+func TestAEADEncrypt(t *testing.T) {
+	for _, mode := range []AEADMode{AESGCM, ChaCha20Poly1305, XChaCha20Poly1305} {
+		key := osutil.RandBytes(32)
+		txt := osutil.RandBytes(1024)
+		aad := []byte("user:1")
+		encrypted, err := AEADEncrypt(mode, key, txt, aad)
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		decrypted, err := AEADDecrypt(mode, key, encrypted, aad)
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if !bytes.Equal(txt, decrypted) {
+			t.Fatalf("%s: 原文和解密后的原文不匹配", mode)
+		}
+		if _, err = AEADDecrypt(mode, key, encrypted, []byte("user:2")); err != ErrAEADDecryption {
+			t.Fatalf("%s: aad mismatch: %v", mode, err)
+		}
+		encrypted[len(encrypted)-1] ^= 1
+		if _, err = AEADDecrypt(mode, key, encrypted, aad); err != ErrAEADDecryption {
+			t.Fatalf("%s: tampered: %v", mode, err)
+		}
+		if _, err = AEADDecrypt(mode, key, encrypted[:10], aad); err != ErrAEADCiphertextShort {
+			t.Fatalf("%s: short: %v", mode, err)
+		}
+	}
+	if _, err := EncryptByChaCha20Poly1305([]byte("txt"), osutil.RandBytes(16), nil); err == nil {
+		t.Fatal("16 byte chacha20 key accepted")
+	}
+	encrypted, err := EncryptByAesGCM([]byte("txt"), osutil.RandBytes(16), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = DecryptByAesGCM(encrypted, osutil.RandBytes(16), nil); err != ErrAEADDecryption {
+		t.Fatalf("wrong key: %v", err)
+	}
+}
+
+func encryptStream(t *testing.T, mode AEADMode, key, txt []byte, chunkSize int) []byte {
+	var buf bytes.Buffer
+	w, err := NewStreamWriter(&buf, mode, key, WithStreamChunkSize(chunkSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 分多次写入，覆盖缓冲区边界
+	for len(txt) > 0 {
+		n := 37
+		if n > len(txt) {
+			n = len(txt)
+		}
+		if _, err = w.Write(txt[:n]); err != nil {
+			t.Fatal(err)
+		}
+		txt = txt[n:]
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decryptStream(key, encrypted []byte) ([]byte, error) {
+	r, err := NewStreamReader(bytes.NewReader(encrypted), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestStream(t *testing.T) {
+	const chunkSize = 64
+	key := osutil.RandBytes(32)
+	for _, mode := range []AEADMode{AESGCM, ChaCha20Poly1305, XChaCha20Poly1305} {
+		for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3 * chunkSize, 1000} {
+			txt := osutil.RandBytes(size)
+			encrypted := encryptStream(t, mode, key, txt, chunkSize)
+			decrypted, err := decryptStream(key, encrypted)
+			if err != nil {
+				t.Fatalf("%s %d: %v", mode, size, err)
+			}
+			if !bytes.Equal(txt, decrypted) {
+				t.Fatalf("%s %d: 原文和解密后的原文不匹配", mode, size)
+			}
+		}
+	}
+}
+
+func TestStreamTamper(t *testing.T) {
+	const chunkSize = 64
+	key := osutil.RandBytes(32)
+	txt := osutil.RandBytes(3 * chunkSize)
+	encrypted := encryptStream(t, AESGCM, key, txt, chunkSize)
+	sealed := chunkSize + 16
+	chunks := encrypted[streamHeaderSize:]
+
+	// 在分块边界截断
+	if _, err := decryptStream(key, encrypted[:streamHeaderSize+2*sealed]); err != ErrAEADDecryption {
+		t.Fatalf("truncated at boundary: %v", err)
+	}
+	if _, err := decryptStream(key, encrypted[:streamHeaderSize]); err != ErrStreamTruncated {
+		t.Fatalf("header only: %v", err)
+	}
+	if _, err := decryptStream(key, encrypted[:len(encrypted)-3]); err != ErrAEADDecryption {
+		t.Fatalf("truncated: %v", err)
+	}
+	// 交换前两块
+	swapped := append(append(append(append([]byte(nil), encrypted[:streamHeaderSize]...),
+		chunks[sealed:2*sealed]...), chunks[:sealed]...), chunks[2*sealed:]...)
+	if _, err := decryptStream(key, swapped); err != ErrAEADDecryption {
+		t.Fatalf("reordered: %v", err)
+	}
+	// 追加数据
+	if _, err := decryptStream(key, append(append([]byte(nil), encrypted...), 0)); err != ErrAEADDecryption {
+		t.Fatalf("appended: %v", err)
+	}
+	// 修改头部的分块大小
+	header := append([]byte(nil), encrypted...)
+	header[5] ^= 1
+	if _, err := decryptStream(key, header); err == nil {
+		t.Fatal("tampered header accepted")
+	}
+	version := append([]byte(nil), encrypted...)
+	version[0] = 2
+	if _, err := decryptStream(key, version); !errors.Is(err, ErrStreamVersion) {
+		t.Fatalf("version: %v", err)
+	}
+	if _, err := decryptStream(osutil.RandBytes(32), encrypted); err != ErrAEADDecryption {
+		t.Fatalf("wrong key: %v", err)
+	}
+}
+
+func TestDecryptByAesCBCInvalidPadding(t *testing.T) {
+	key := osutil.RandBytes(16)
+	iv := osutil.RandBytes(16)
+	for _, encrypted := range [][]byte{nil, osutil.RandBytes(15), osutil.RandBytes(32)} {
+		if _, err := DecryptByAesCBC(encrypted, key, iv); err == nil {
+			t.Fatalf("invalid ciphertext of %d bytes accepted", len(encrypted))
+		}
+	}
+	for _, padded := range [][]byte{
+		append(bytes.Repeat([]byte{'a'}, 15), 0),
+		append(bytes.Repeat([]byte{'a'}, 15), 17),
+		append(bytes.Repeat([]byte{'a'}, 14), 1, 2),
+	} {
+		if _, err := pkcs7UnPadding(padded, 16); err != ErrInvalidPadding {
+			t.Fatalf("padding %v: %v", padded[14:], err)
+		}
+	}
+}
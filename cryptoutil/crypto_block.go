@@ -11,6 +11,9 @@ import (
 	"io"
 )
 
+// ErrInvalidPadding 密文长度或者PKCS7填充不正确.
+var ErrInvalidPadding = errors.New("cryptoutil: invalid pkcs7 padding")
+
 /*
 常用五种分组模式：ECB/CBC/CFB/OFB/CTR
 1.电码本模式 Electronic Codebook Book (ECB)
@@ -50,11 +53,13 @@ func DecryptByAesCBC(encrypted, key, iv []byte) (decrypted []byte, err error) {
 	if err != nil {
 		return nil, err
 	}
-	blockMode := cipher.NewCBCDecrypter(block, iv) // 加密模式
-	decrypted = make([]byte, len(encrypted))       // 创建数组
-	blockMode.CryptBlocks(decrypted, encrypted)    // 解密
-	decrypted = pkcs7UnPadding(decrypted)          // 去除补全码
-	return decrypted, err
+	if len(encrypted) == 0 || len(encrypted)%block.BlockSize() != 0 {
+		return nil, ErrInvalidPadding
+	}
+	blockMode := cipher.NewCBCDecrypter(block, iv)      // 加密模式
+	decrypted = make([]byte, len(encrypted))            // 创建数组
+	blockMode.CryptBlocks(decrypted, encrypted)         // 解密
+	return pkcs7UnPadding(decrypted, block.BlockSize()) // 去除补全码
 }
 
 // pkcs7Padding 填充明文.
@@ -64,11 +69,24 @@ func pkcs7Padding(plainText []byte, blockSize int) []byte {
 	return append(plainText, padtext...)
 }
 
-// pkcs7UnPadding 去除填充.
-func pkcs7UnPadding(origData []byte) []byte {
+// pkcs7UnPadding 去除填充，填充长度和填充字节都要校验.
+func pkcs7UnPadding(origData []byte, blockSize int) ([]byte, error) {
 	length := len(origData)
+	if length == 0 || length%blockSize != 0 {
+		return nil, ErrInvalidPadding
+	}
 	unpadding := int(origData[length-1])
-	return origData[:(length - unpadding)]
+	if unpadding == 0 || unpadding > blockSize {
+		return nil, ErrInvalidPadding
+	}
+	var diff byte
+	for _, b := range origData[length-unpadding:] {
+		diff |= b ^ byte(unpadding)
+	}
+	if diff != 0 {
+		return nil, ErrInvalidPadding
+	}
+	return origData[:(length - unpadding)], nil
 }
 
 /*
@@ -87,12 +105,14 @@ const (
 	CTR BlockStreamMode = "CTR"
 	CFB BlockStreamMode = "CFB"
 	OFB BlockStreamMode = "OFB"
+	// Deprecated: RC4以明文传输的IV作为密钥，没有使用分组密码，不提供机密性，请使用AEAD.
 	RC4 BlockStreamMode = "RC4"
 )
 
+// BlockEncrypt 流模式加密，返回 IV||密文，密文没有认证，需要防篡改时使用AEADEncrypt.
 func BlockEncrypt(block cipher.Block, mode BlockStreamMode, value []byte) ([]byte, error) {
 	size := block.BlockSize()
-	iv := make([]byte, size, len(value))
+	iv := make([]byte, size, size+len(value))
 	_, err := io.ReadFull(rand.Reader, iv)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,283 @@
+package cryptoutil
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+/*
+流式认证加密，参考 STREAM 构造(Hoang, Reyhanitabar, Rogaway, Vizár 2015)，适合加密大文件:
+1. 头部: 版本(1字节) | 模式(1字节) | 分块大小(4字节，大端) | 随机盐(32字节)
+2. 每个流使用 HKDF-SHA256(key, 盐, 头部) 派生独立的32字节密钥，头部被篡改时派生的密钥不同，解密失败
+3. 明文按分块大小切分，每块单独加密，nonce为 块序号(4字节，大端) | 是否最后一块(1字节)，前面补0
+4. 删除、重排、截断分块都会导致解密失败，最后一块的标记防止在分块边界截断
+*/
+
+// StreamVersion1 当前的流格式版本
+const StreamVersion1 byte = 1
+
+const (
+	streamSaltSize         = 32
+	streamHeaderSize       = 2 + 4 + streamSaltSize
+	streamMinChunkSize     = 64
+	streamMaxChunkSize     = 16 << 20
+	streamDefaultChunkSize = 64 << 10
+)
+
+var (
+	// ErrStreamVersion 不支持的流格式版本
+	ErrStreamVersion = errors.New("cryptoutil: unsupported stream version")
+	// ErrStreamHeader 流头部不正确
+	ErrStreamHeader = errors.New("cryptoutil: invalid stream header")
+	// ErrStreamKey 流加密的密钥不能短于16字节
+	ErrStreamKey = errors.New("cryptoutil: stream key must be at least 16 bytes")
+	// ErrStreamTruncated 流缺少最后一块
+	ErrStreamTruncated = errors.New("cryptoutil: stream truncated")
+	// ErrStreamTooLarge 分块数量超过了nonce的计数范围
+	ErrStreamTooLarge = errors.New("cryptoutil: stream too large")
+	// ErrStreamClosed 流已经关闭
+	ErrStreamClosed = errors.New("cryptoutil: stream closed")
+)
+
+var streamModes = []AEADMode{1: AESGCM, 2: ChaCha20Poly1305, 3: XChaCha20Poly1305}
+
+type streamOptions struct {
+	chunkSize int
+}
+
+type StreamOptFunc func(o *streamOptions)
+
+// WithStreamChunkSize 设置明文分块大小，默认64KiB，范围64B~16MiB
+func WithStreamChunkSize(size int) StreamOptFunc {
+	return func(o *streamOptions) {
+		o.chunkSize = size
+	}
+}
+
+// streamAEAD 使用头部派生流密钥
+func streamAEAD(mode AEADMode, key, header []byte) (cipher.AEAD, error) {
+	if len(key) < 16 {
+		return nil, ErrStreamKey
+	}
+	streamKey := make([]byte, 32)
+	salt := header[streamHeaderSize-streamSaltSize:]
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, header), streamKey); err != nil {
+		return nil, err
+	}
+	return NewAEAD(mode, streamKey)
+}
+
+type streamNonce struct {
+	nonce   []byte
+	counter uint32
+	done    bool
+}
+
+// next 返回当前分块的nonce并递增序号
+func (n *streamNonce) next(last bool) ([]byte, error) {
+	if n.done {
+		return nil, ErrStreamTooLarge
+	}
+	size := len(n.nonce)
+	binary.BigEndian.PutUint32(n.nonce[size-5:], n.counter)
+	n.nonce[size-1] = 0
+	if last {
+		n.nonce[size-1] = 1
+	}
+	if n.counter == math.MaxUint32 {
+		n.done = true
+	}
+	n.counter++
+	return n.nonce, nil
+}
+
+type streamWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce streamNonce
+	buf   []byte
+	out   []byte
+	err   error
+}
+
+// NewStreamWriter 返回加密写入器，写入的明文分块加密后写入w，
+// 必须调用Close写入最后一块，Close不会关闭w
+func NewStreamWriter(w io.Writer, mode AEADMode, key []byte, opts ...StreamOptFunc) (io.WriteCloser, error) {
+	o := &streamOptions{chunkSize: streamDefaultChunkSize}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.chunkSize < streamMinChunkSize || o.chunkSize > streamMaxChunkSize {
+		return nil, ErrStreamHeader
+	}
+	var id byte
+	for i := range streamModes {
+		if streamModes[i] == mode && mode != "" {
+			id = byte(i)
+		}
+	}
+	if id == 0 {
+		return nil, ErrStreamHeader
+	}
+	header := make([]byte, streamHeaderSize)
+	header[0] = StreamVersion1
+	header[1] = id
+	binary.BigEndian.PutUint32(header[2:6], uint32(o.chunkSize))
+	if _, err := io.ReadFull(rand.Reader, header[6:]); err != nil {
+		return nil, err
+	}
+	aead, err := streamAEAD(mode, key, header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(header); err != nil {
+		return nil, err
+	}
+	return &streamWriter{
+		w:     w,
+		aead:  aead,
+		nonce: streamNonce{nonce: make([]byte, aead.NonceSize())},
+		buf:   make([]byte, 0, o.chunkSize),
+		out:   make([]byte, 0, o.chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (s *streamWriter) Write(p []byte) (n int, err error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	for len(p) > 0 {
+		// 缓冲区满了且还有数据时才写出，保证最后一块在Close时写出
+		if len(s.buf) == cap(s.buf) {
+			if err = s.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(s.buf[len(s.buf):cap(s.buf)], p)
+		s.buf = s.buf[:len(s.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (s *streamWriter) flush(last bool) error {
+	nonce, err := s.nonce.next(last)
+	if err != nil {
+		s.err = err
+		return err
+	}
+	s.out = s.aead.Seal(s.out[:0], nonce, s.buf, nil)
+	s.buf = s.buf[:0]
+	if _, err = s.w.Write(s.out); err != nil {
+		s.err = err
+	}
+	return err
+}
+
+// Close 写入最后一块
+func (s *streamWriter) Close() error {
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.flush(true); err != nil {
+		return err
+	}
+	s.err = ErrStreamClosed
+	return nil
+}
+
+type streamReader struct {
+	r         *bufio.Reader
+	aead      cipher.AEAD
+	nonce     streamNonce
+	buf       []byte
+	plaintext []byte
+	last      bool
+	err       error
+}
+
+// NewStreamReader 返回解密读取器，模式和分块大小从头部读取，
+// 读取到io.EOF时整个流已经通过认证，之前返回的明文在出错时不可信
+func NewStreamReader(r io.Reader, key []byte) (io.Reader, error) {
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrStreamHeader
+		}
+		return nil, err
+	}
+	if header[0] != StreamVersion1 {
+		return nil, ErrStreamVersion
+	}
+	if int(header[1]) >= len(streamModes) || streamModes[header[1]] == "" {
+		return nil, ErrStreamHeader
+	}
+	chunkSize := binary.BigEndian.Uint32(header[2:6])
+	if chunkSize < streamMinChunkSize || chunkSize > streamMaxChunkSize {
+		return nil, ErrStreamHeader
+	}
+	aead, err := streamAEAD(streamModes[header[1]], key, header)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{
+		r:     bufio.NewReader(r),
+		aead:  aead,
+		nonce: streamNonce{nonce: make([]byte, aead.NonceSize())},
+		buf:   make([]byte, int(chunkSize)+aead.Overhead()),
+	}, nil
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.plaintext) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.last {
+			return 0, io.EOF
+		}
+		s.err = s.readChunk()
+	}
+	n := copy(p, s.plaintext)
+	s.plaintext = s.plaintext[n:]
+	return n, nil
+}
+
+func (s *streamReader) readChunk() error {
+	n, err := io.ReadFull(s.r, s.buf)
+	switch err {
+	case nil:
+		// 整块后面没有数据时是最后一块
+		if _, err = s.r.Peek(1); err == io.EOF {
+			s.last = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		s.last = true
+	case io.EOF:
+		return ErrStreamTruncated
+	default:
+		return err
+	}
+	if n < s.aead.Overhead() {
+		return ErrStreamTruncated
+	}
+	nonce, err := s.nonce.next(s.last)
+	if err != nil {
+		return err
+	}
+	if s.plaintext, err = s.aead.Open(s.buf[:0], nonce, s.buf[:n], nil); err != nil {
+		return ErrAEADDecryption
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package cryptoutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+/*
+信封加密:
+1. 每个对象使用随机的32字节数据密钥(DEK)，以AES-256-GCM加密数据
+2. 数据密钥由密钥加密密钥(KEK)包装后与密文保存在一起，KEK不离开KMS
+3. KEK有多个版本，包装时使用主版本，解包时按信封中的kid选择版本
+4. 轮换KEK后调用Rewrap用新版本重新包装数据密钥，密文不需要重新加密
+
+信封格式: 版本(1字节) | kid长度(1字节) | kid | 包装密钥长度(2字节，大端) | 包装密钥 | nonce||密文||认证标签
+*/
+
+// EnvelopeVersion1 当前的信封格式版本
+const EnvelopeVersion1 byte = 1
+
+const dataKeySize = 32
+
+var (
+	// ErrKeyNotFound KEK中没有该版本的密钥
+	ErrKeyNotFound = errors.New("kms: key version not found")
+	// ErrKeyPrimary 不能销毁主版本
+	ErrKeyPrimary = errors.New("kms: cannot destroy primary key version")
+	// ErrEnvelopeMalformed 信封格式不正确
+	ErrEnvelopeMalformed = errors.New("kms: malformed envelope")
+	// ErrKeyRingFile 密钥环文件格式不正确
+	ErrKeyRingFile = errors.New("kms: invalid key ring file")
+)
+
+// KeyEncryptionKey 密钥加密密钥，只用于包装和解包数据密钥，可以由本地密钥环或者云KMS实现
+type KeyEncryptionKey interface {
+	// WrapKey 使用主版本包装数据密钥，返回主版本的kid
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey 使用kid对应的版本解包数据密钥
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// GenerateDataKey 生成数据密钥，返回明文和包装后的密钥，
+// 适合需要原始密钥的场景，例如authed.WithWrappedCryptoKey，只保存包装后的密钥，启动时用UnwrapKey还原
+func GenerateDataKey(ctx context.Context, kek KeyEncryptionKey) (dataKey []byte, keyID string, wrapped []byte, err error) {
+	dataKey = make([]byte, dataKeySize)
+	if _, err = io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, "", nil, err
+	}
+	keyID, wrapped, err = kek.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return dataKey, keyID, wrapped, nil
+}
+
+// EnvelopeEncrypt 信封加密，additionalData参与认证但不加密，解密时必须一致
+func EnvelopeEncrypt(ctx context.Context, kek KeyEncryptionKey, plaintext, additionalData []byte) ([]byte, error) {
+	dataKey, keyID, wrapped, err := GenerateDataKey(ctx, kek)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := AEADEncrypt(AESGCM, dataKey, plaintext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	return marshalEnvelope(keyID, wrapped, ciphertext)
+}
+
+// EnvelopeDecrypt 解密EnvelopeEncrypt的结果
+func EnvelopeDecrypt(ctx context.Context, kek KeyEncryptionKey, envelope, additionalData []byte) ([]byte, error) {
+	keyID, wrapped, ciphertext, err := unmarshalEnvelope(envelope)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := kek.UnwrapKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return AEADDecrypt(AESGCM, dataKey, ciphertext, additionalData)
+}
+
+// EnvelopeKeyID 返回信封使用的kid，可以用来判断是否需要Rewrap
+func EnvelopeKeyID(envelope []byte) (string, error) {
+	keyID, _, _, err := unmarshalEnvelope(envelope)
+	return keyID, err
+}
+
+// Rewrap 使用KEK的主版本重新包装数据密钥，密文保持不变
+func Rewrap(ctx context.Context, kek KeyEncryptionKey, envelope []byte) ([]byte, error) {
+	keyID, wrapped, ciphertext, err := unmarshalEnvelope(envelope)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := kek.UnwrapKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err = kek.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return marshalEnvelope(keyID, wrapped, ciphertext)
+}
+
+func marshalEnvelope(keyID string, wrapped, ciphertext []byte) ([]byte, error) {
+	if len(keyID) > 0xff || len(wrapped) > 0xffff {
+		return nil, ErrEnvelopeMalformed
+	}
+	b := make([]byte, 0, 4+len(keyID)+len(wrapped)+len(ciphertext))
+	b = append(b, EnvelopeVersion1, byte(len(keyID)))
+	b = append(b, keyID...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(wrapped)))
+	b = append(b, wrapped...)
+	return append(b, ciphertext...), nil
+}
+
+func unmarshalEnvelope(b []byte) (keyID string, wrapped, ciphertext []byte, err error) {
+	if len(b) < 2 || b[0] != EnvelopeVersion1 {
+		return "", nil, nil, ErrEnvelopeMalformed
+	}
+	n := int(b[1])
+	b = b[2:]
+	if len(b) < n+2 {
+		return "", nil, nil, ErrEnvelopeMalformed
+	}
+	keyID, b = string(b[:n]), b[n:]
+	n = int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < n {
+		return "", nil, nil, ErrEnvelopeMalformed
+	}
+	return keyID, b[:n], b[n:], nil
+}
+
+// LocalKeyRing 本地密钥环，每个版本是32字节的AES-256-GCM密钥，kid格式为 "<name>/<version>"
+type LocalKeyRing struct {
+	mu       sync.RWMutex
+	name     string
+	primary  int
+	versions map[int][]byte
+}
+
+// NewLocalKeyRing 使用32字节密钥创建版本1
+func NewLocalKeyRing(name string, key []byte) (*LocalKeyRing, error) {
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("kms: key must be %d bytes", dataKeySize)
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("kms: invalid key ring name %q", name)
+	}
+	return &LocalKeyRing{name: name, primary: 1, versions: map[int][]byte{1: key}}, nil
+}
+
+// NewPassphraseKeyRing 使用argon2id从口令派生版本1，salt至少16字节且需要与口令一起保存
+func NewPassphraseKeyRing(name string, passphrase, salt []byte) (*LocalKeyRing, error) {
+	if len(salt) < 16 {
+		return nil, errors.New("kms: salt must be at least 16 bytes")
+	}
+	return NewLocalKeyRing(name, passphraseKey(passphrase, salt))
+}
+
+func passphraseKey(passphrase, salt []byte) []byte {
+	return argon2.IDKey(passphrase, salt, 3, 64*1024, 4, dataKeySize)
+}
+
+func (r *LocalKeyRing) keyID(version int) string {
+	return r.name + "/" + strconv.Itoa(version)
+}
+
+// Primary 返回主版本的kid
+func (r *LocalKeyRing) Primary() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keyID(r.primary)
+}
+
+// KeyIDs 返回所有版本的kid，按版本排序
+func (r *LocalKeyRing) KeyIDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := make([]int, 0, len(r.versions))
+	for v := range r.versions {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	ids := make([]string, len(versions))
+	for i, v := range versions {
+		ids[i] = r.keyID(v)
+	}
+	return ids
+}
+
+// Rotate 生成新版本并设为主版本，旧版本仍可解包
+func (r *LocalKeyRing) Rotate() (string, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next := 0
+	for v := range r.versions {
+		if v > next {
+			next = v
+		}
+	}
+	next++
+	r.versions[next] = key
+	r.primary = next
+	return r.keyID(next), nil
+}
+
+// Destroy 销毁旧版本，销毁前需要Rewrap使用该版本的信封
+func (r *LocalKeyRing) Destroy(keyID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	version, err := r.parseKeyID(keyID)
+	if err != nil {
+		return err
+	}
+	if version == r.primary {
+		return ErrKeyPrimary
+	}
+	delete(r.versions, version)
+	return nil
+}
+
+func (r *LocalKeyRing) parseKeyID(keyID string) (int, error) {
+	name, v, ok := strings.Cut(keyID, "/")
+	if !ok || name != r.name {
+		return 0, ErrKeyNotFound
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, ErrKeyNotFound
+	}
+	if _, ok = r.versions[version]; !ok {
+		return 0, ErrKeyNotFound
+	}
+	return version, nil
+}
+
+// WrapKey 包装时kid作为附加数据，包装结果不能换到其他版本下使用
+func (r *LocalKeyRing) WrapKey(_ context.Context, dataKey []byte) (string, []byte, error) {
+	r.mu.RLock()
+	keyID, key := r.keyID(r.primary), r.versions[r.primary]
+	r.mu.RUnlock()
+	wrapped, err := AEADEncrypt(AESGCM, key, dataKey, []byte(keyID))
+	if err != nil {
+		return "", nil, err
+	}
+	return keyID, wrapped, nil
+}
+
+func (r *LocalKeyRing) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	r.mu.RLock()
+	version, err := r.parseKeyID(keyID)
+	key := r.versions[version]
+	r.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return AEADDecrypt(AESGCM, key, wrapped, []byte(keyID))
+}
+
+type keyRingFile struct {
+	Name    string            `json:"name,omitempty"`
+	Primary int               `json:"primary,omitempty"`
+	Keys    map[string][]byte `json:"keys,omitempty"`
+	// 使用口令保护时只有以下字段，Data是加密后的密钥环
+	Salt []byte `json:"salt,omitempty"`
+	Data []byte `json:"data,omitempty"`
+}
+
+// SaveFile 保存密钥环，passphrase不为空时使用argon2id派生的密钥加密，文件权限为0600
+func (r *LocalKeyRing) SaveFile(path string, passphrase []byte) error {
+	r.mu.RLock()
+	f := keyRingFile{Name: r.name, Primary: r.primary, Keys: make(map[string][]byte, len(r.versions))}
+	for v, key := range r.versions {
+		f.Keys[strconv.Itoa(v)] = key
+	}
+	r.mu.RUnlock()
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if len(passphrase) > 0 {
+		salt := make([]byte, 16)
+		if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+			return err
+		}
+		sealed, err := AEADEncrypt(AESGCM, passphraseKey(passphrase, salt), data, salt)
+		if err != nil {
+			return err
+		}
+		if data, err = json.Marshal(keyRingFile{Salt: salt, Data: sealed}); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// LoadKeyRingFile 读取SaveFile保存的密钥环
+func LoadKeyRingFile(path string, passphrase []byte) (*LocalKeyRing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f keyRingFile
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, ErrKeyRingFile
+	}
+	if f.Data != nil {
+		if len(passphrase) == 0 {
+			return nil, errors.New("kms: key ring file is protected by passphrase")
+		}
+		// 盐太短时派生的密钥强度不够
+		if len(f.Salt) < 16 {
+			return nil, ErrKeyRingFile
+		}
+		if data, err = AEADDecrypt(AESGCM, passphraseKey(passphrase, f.Salt), f.Data, f.Salt); err != nil {
+			return nil, err
+		}
+		f = keyRingFile{}
+		if err = json.Unmarshal(data, &f); err != nil {
+			return nil, ErrKeyRingFile
+		}
+	}
+	r := &LocalKeyRing{name: f.Name, primary: f.Primary, versions: make(map[int][]byte, len(f.Keys))}
+	for v, key := range f.Keys {
+		version, err := strconv.Atoi(v)
+		if err != nil || len(key) != dataKeySize {
+			return nil, ErrKeyRingFile
+		}
+		r.versions[version] = key
+	}
+	if r.name == "" || r.versions[r.primary] == nil {
+		return nil, ErrKeyRingFile
+	}
+	return r, nil
+}
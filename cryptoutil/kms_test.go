@@ -0,0 +1,133 @@
+package cryptoutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorpher/gone/osutil"
+)
+
+func TestEnvelopeEncrypt(t *testing.T) {
+	ctx := context.Background()
+	ring, err := NewLocalKeyRing("app", osutil.RandBytes(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt := []byte("database password")
+	aad := []byte("secret:db")
+	envelope, err := EnvelopeEncrypt(ctx, ring, txt, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := EnvelopeDecrypt(ctx, ring, envelope, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(txt, decrypted) {
+		t.Fatalf("原文和解密后的原文不匹配 %s", decrypted)
+	}
+	if _, err = EnvelopeDecrypt(ctx, ring, envelope, []byte("secret:other")); err != ErrAEADDecryption {
+		t.Fatalf("aad mismatch: %v", err)
+	}
+	other, _ := NewLocalKeyRing("app", osutil.RandBytes(32)) // nolint
+	if _, err = EnvelopeDecrypt(ctx, other, envelope, aad); err != ErrAEADDecryption {
+		t.Fatalf("wrong kek: %v", err)
+	}
+	if _, err = EnvelopeDecrypt(ctx, ring, envelope[:3], aad); err != ErrEnvelopeMalformed {
+		t.Fatalf("malformed: %v", err)
+	}
+}
+
+func TestKeyRingRotate(t *testing.T) {
+	ctx := context.Background()
+	ring, err := NewPassphraseKeyRing("app", []byte("correct horse"), osutil.RandBytes(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := EnvelopeEncrypt(ctx, ring, []byte("v1 secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, err := ring.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid != "app/2" || ring.Primary() != kid {
+		t.Fatalf("unexpected primary %s", ring.Primary())
+	}
+	// 旧版本仍然可以解密
+	if _, err = EnvelopeDecrypt(ctx, ring, envelope, nil); err != nil {
+		t.Fatal(err)
+	}
+	rewrapped, err := Rewrap(ctx, ring, envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := EnvelopeKeyID(rewrapped); got != kid { // nolint
+		t.Fatalf("rewrapped with %s", got)
+	}
+	if err = ring.Destroy(kid); err != ErrKeyPrimary {
+		t.Fatalf("destroy primary: %v", err)
+	}
+	if err = ring.Destroy("app/1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = EnvelopeDecrypt(ctx, ring, envelope, nil); err != ErrKeyNotFound {
+		t.Fatalf("destroyed version: %v", err)
+	}
+	decrypted, err := EnvelopeDecrypt(ctx, ring, rewrapped, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != "v1 secret" {
+		t.Fatalf("got %s", decrypted)
+	}
+}
+
+func TestKeyRingFile(t *testing.T) {
+	ctx := context.Background()
+	ring, err := NewLocalKeyRing("app", osutil.RandBytes(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ring.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := EnvelopeEncrypt(ctx, ring, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, passphrase := range [][]byte{nil, []byte("correct horse")} {
+		path := filepath.Join(dir, "keyring.json")
+		if err = ring.SaveFile(path, passphrase); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadKeyRingFile(path, passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Primary() != ring.Primary() || len(loaded.KeyIDs()) != 2 {
+			t.Fatalf("unexpected key ring %v", loaded.KeyIDs())
+		}
+		if _, err = EnvelopeDecrypt(ctx, loaded, envelope, nil); err != nil {
+			t.Fatal(err)
+		}
+		if passphrase != nil {
+			if _, err = LoadKeyRingFile(path, []byte("wrong")); err == nil {
+				t.Fatal("wrong passphrase accepted")
+			}
+		}
+	}
+	path := filepath.Join(dir, "short-salt.json")
+	if err = os.WriteFile(path, []byte(`{"salt":"AQID","data":"AQIDBA=="}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadKeyRingFile(path, []byte("correct horse")); !errors.Is(err, ErrKeyRingFile) {
+		t.Fatalf("short salt accepted: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package cryptoutil
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 附录D测试向量
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	h := NewHOTP([]byte("12345678901234567890"))
+	for i, code := range want {
+		got, err := h.Generate(uint64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != code {
+			t.Fatalf("counter %d: want %s got %s", i, code, got)
+		}
+	}
+	counter, ok := h.Validate("969429", 1, 3)
+	if !ok || counter != 3 {
+		t.Fatalf("lookahead validate failed: %d %v", counter, ok)
+	}
+	if _, ok = h.Validate("969429", 4, 3); ok {
+		t.Fatal("old counter accepted")
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 附录B测试向量
+	secrets := map[OTPAlgorithm]string{
+		OTPSHA1:   "12345678901234567890",
+		OTPSHA256: "12345678901234567890123456789012",
+		OTPSHA512: "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	testCases := []struct {
+		at   int64
+		alg  OTPAlgorithm
+		want string
+	}{
+		{59, OTPSHA1, "94287082"},
+		{59, OTPSHA256, "46119246"},
+		{59, OTPSHA512, "90693936"},
+		{1111111109, OTPSHA1, "07081804"},
+		{1111111109, OTPSHA256, "68084774"},
+		{1111111109, OTPSHA512, "25091201"},
+		{20000000000, OTPSHA1, "65353130"},
+		{20000000000, OTPSHA256, "77737706"},
+		{20000000000, OTPSHA512, "47863826"},
+	}
+	for _, tc := range testCases {
+		totp := NewTOTP([]byte(secrets[tc.alg]))
+		totp.Digits = 8
+		totp.Algorithm = tc.alg
+		got, err := totp.Generate(time.Unix(tc.at, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Fatalf("%s@%d: want %s got %s", tc.alg, tc.at, tc.want, got)
+		}
+	}
+
+	totp := NewTOTP([]byte(secrets[OTPSHA1]))
+	now := time.Unix(1111111109, 0)
+	prev, _ := totp.Generate(now.Add(-totp.Period)) // nolint
+	if _, ok := totp.Validate(prev, now); !ok {
+		t.Fatal("drift window not applied")
+	}
+	old, _ := totp.Generate(now.Add(-3 * totp.Period)) // nolint
+	if _, ok := totp.Validate(old, now); ok {
+		t.Fatal("code outside window accepted")
+	}
+
+	current, _ := totp.Generate(now) // nolint
+	totp.Skew = -1
+	if _, ok := totp.Validate(current, now); ok {
+		t.Fatal("negative skew accepted")
+	}
+	if _, ok := totp.Validate(old, now); ok {
+		t.Fatal("negative skew widened the window")
+	}
+	totp.Skew = 1
+
+	totp.Period = 500 * time.Millisecond
+	if _, err := totp.Generate(now); err != ErrOTPPeriod {
+		t.Fatalf("sub-second period: %v", err)
+	}
+	if _, ok := totp.Validate(prev, now); ok {
+		t.Fatal("sub-second period accepted")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	secret, err := GenerateOTPSecret(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, err := url.Parse(NewTOTP(secret).ProvisioningURI("Gone App", "tom@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Gone App:tom@example.com" {
+		t.Fatalf("unexpected uri %s", uri)
+	}
+	decoded, err := DecodeOTPSecret(uri.Query().Get("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != string(secret) {
+		t.Fatal("secret mismatch")
+	}
+}
@@ -0,0 +1,477 @@
+package cryptoutil
+
+import (
+	"crypto/rand"
+	"crypto/sha1" // #nosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+/*
+密码摘要使用PHC字符串格式保存: $<id>[$v=<version>][$<param>=<value>(,<param>=<value>)*][$<salt>[$<hash>]]
+1. argon2id: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+2. scrypt:   $scrypt$ln=15,r=8,p=1$<salt>$<hash>
+3. pbkdf2:   $pbkdf2-sha256$i=600000,l=32$<salt>$<hash>
+4. bcrypt:   使用bcrypt自身的 $2a$10$... 格式
+salt和hash使用不带填充的标准base64编码.
+*/
+
+var (
+	ErrPasswordMismatch      = errors.New("password: hashed password does not match")
+	ErrPasswordHashMalformed = errors.New("password: malformed hash")
+	ErrPasswordHashUnknown   = errors.New("password: unknown hash algorithm")
+)
+
+var phcEncoding = base64.RawStdEncoding
+
+// PasswordHasher 密码摘要算法.
+type PasswordHasher interface {
+	// ID 算法标识，对应PHC格式中的<id>
+	ID() string
+	// Hash 生成PHC格式的密码摘要
+	Hash(password []byte) (string, error)
+	// Verify 校验密码，不匹配时返回ErrPasswordMismatch
+	Verify(password []byte, encoded string) error
+	// NeedsRehash 摘要参数与当前参数不一致时返回true
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idHasher argon2id算法，推荐使用.
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32 // 单位KiB
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+// NewArgon2idHasher 使用 RFC 9106 第二推荐参数.
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{Time: 3, Memory: 64 * 1024, Threads: 4, KeyLen: 32, SaltLen: 16}
+}
+
+func (h *Argon2idHasher) ID() string {
+	return "argon2id"
+}
+
+func (h *Argon2idHasher) Hash(password []byte) (string, error) {
+	salt, err := randomSalt(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey(password, salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Time, h.Threads,
+		phcEncoding.EncodeToString(salt), phcEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(password []byte, encoded string) error {
+	p, err := h.decode(encoded)
+	if err != nil {
+		return err
+	}
+	key := argon2.IDKey(password, p.salt, p.Time, p.Memory, p.Threads, uint32(len(p.hash)))
+	return compareHash(key, p.hash)
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	p, err := h.decode(encoded)
+	if err != nil {
+		return true
+	}
+	return p.Time != h.Time || p.Memory != h.Memory || p.Threads != h.Threads ||
+		uint32(len(p.hash)) != h.KeyLen || uint32(len(p.salt)) != h.SaltLen
+}
+
+type argon2idParams struct {
+	Argon2idHasher
+	salt []byte
+	hash []byte
+}
+
+func (h *Argon2idHasher) decode(encoded string) (*argon2idParams, error) {
+	phc, err := parsePHC(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if phc.id != h.ID() {
+		return nil, ErrPasswordHashUnknown
+	}
+	if phc.version != strconv.Itoa(argon2.Version) {
+		return nil, fmt.Errorf("password: unsupported argon2 version %s", phc.version)
+	}
+	var p argon2idParams
+	m, err1 := phc.uint("m")
+	t, err2 := phc.uint("t")
+	threads, err3 := phc.uint("p")
+	if err = errors.Join(err1, err2, err3); err != nil {
+		return nil, err
+	}
+	if threads > 255 || t == 0 || threads == 0 {
+		return nil, ErrPasswordHashMalformed
+	}
+	p.Memory, p.Time, p.Threads = uint32(m), uint32(t), uint8(threads)
+	p.salt, p.hash = phc.salt, phc.hash
+	return &p, nil
+}
+
+// BcryptHasher bcrypt算法，密码超过72字节的部分会被忽略.
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher() *BcryptHasher {
+	return &BcryptHasher{Cost: bcrypt.DefaultCost}
+}
+
+func (h *BcryptHasher) ID() string {
+	return "bcrypt"
+}
+
+func (h *BcryptHasher) Hash(password []byte) (string, error) {
+	b, err := bcrypt.GenerateFromPassword(password, h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (h *BcryptHasher) Verify(password []byte, encoded string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), password)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+// ScryptHasher scrypt算法，N必须是2的幂.
+type ScryptHasher struct {
+	N       int
+	R       int
+	P       int
+	KeyLen  int
+	SaltLen uint32
+}
+
+func NewScryptHasher() *ScryptHasher {
+	return &ScryptHasher{N: 1 << 15, R: 8, P: 1, KeyLen: 32, SaltLen: 16}
+}
+
+func (h *ScryptHasher) ID() string {
+	return "scrypt"
+}
+
+func (h *ScryptHasher) Hash(password []byte) (string, error) {
+	salt, err := randomSalt(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key(password, salt, h.N, h.R, h.P, h.KeyLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", log2(h.N), h.R, h.P,
+		phcEncoding.EncodeToString(salt), phcEncoding.EncodeToString(key)), nil
+}
+
+func (h *ScryptHasher) Verify(password []byte, encoded string) error {
+	p, salt, want, err := h.decode(encoded)
+	if err != nil {
+		return err
+	}
+	key, err := scrypt.Key(password, salt, p.N, p.R, p.P, len(want))
+	if err != nil {
+		return err
+	}
+	return compareHash(key, want)
+}
+
+func (h *ScryptHasher) NeedsRehash(encoded string) bool {
+	p, salt, key, err := h.decode(encoded)
+	if err != nil {
+		return true
+	}
+	return p.N != h.N || p.R != h.R || p.P != h.P || len(key) != h.KeyLen || uint32(len(salt)) != h.SaltLen
+}
+
+func (h *ScryptHasher) decode(encoded string) (p ScryptHasher, salt, key []byte, err error) {
+	phc, err := parsePHC(encoded)
+	if err != nil {
+		return p, nil, nil, err
+	}
+	if phc.id != h.ID() {
+		return p, nil, nil, ErrPasswordHashUnknown
+	}
+	ln, err1 := phc.uint("ln")
+	r, err2 := phc.uint("r")
+	pp, err3 := phc.uint("p")
+	if err = errors.Join(err1, err2, err3); err != nil {
+		return p, nil, nil, err
+	}
+	if ln == 0 || ln > 30 {
+		return p, nil, nil, ErrPasswordHashMalformed
+	}
+	p.N, p.R, p.P = 1<<ln, int(r), int(pp)
+	return p, phc.salt, phc.hash, nil
+}
+
+// PBKDF2Hasher pbkdf2算法，Digest支持sha1、sha256、sha512.
+type PBKDF2Hasher struct {
+	Digest     string
+	Iterations int
+	KeyLen     int
+	SaltLen    uint32
+}
+
+// NewPBKDF2Hasher 迭代次数参考 OWASP Password Storage Cheat Sheet.
+func NewPBKDF2Hasher() *PBKDF2Hasher {
+	return &PBKDF2Hasher{Digest: "sha256", Iterations: 600000, KeyLen: 32, SaltLen: 16}
+}
+
+func (h *PBKDF2Hasher) ID() string {
+	return "pbkdf2-" + h.Digest
+}
+
+func (h *PBKDF2Hasher) Hash(password []byte) (string, error) {
+	hf, err := pbkdf2HashFunc(h.Digest)
+	if err != nil {
+		return "", err
+	}
+	salt, err := randomSalt(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	key := pbkdf2.Key(password, salt, h.Iterations, h.KeyLen, hf)
+	return fmt.Sprintf("$%s$i=%d,l=%d$%s$%s", h.ID(), h.Iterations, h.KeyLen,
+		phcEncoding.EncodeToString(salt), phcEncoding.EncodeToString(key)), nil
+}
+
+func (h *PBKDF2Hasher) Verify(password []byte, encoded string) error {
+	p, salt, want, err := h.decode(encoded)
+	if err != nil {
+		return err
+	}
+	hf, err := pbkdf2HashFunc(p.Digest)
+	if err != nil {
+		return err
+	}
+	return compareHash(pbkdf2.Key(password, salt, p.Iterations, len(want), hf), want)
+}
+
+func (h *PBKDF2Hasher) NeedsRehash(encoded string) bool {
+	p, salt, key, err := h.decode(encoded)
+	if err != nil {
+		return true
+	}
+	return p.Digest != h.Digest || p.Iterations != h.Iterations || len(key) != h.KeyLen || uint32(len(salt)) != h.SaltLen
+}
+
+func (h *PBKDF2Hasher) decode(encoded string) (p PBKDF2Hasher, salt, key []byte, err error) {
+	phc, err := parsePHC(encoded)
+	if err != nil {
+		return p, nil, nil, err
+	}
+	if !strings.HasPrefix(phc.id, "pbkdf2-") {
+		return p, nil, nil, ErrPasswordHashUnknown
+	}
+	i, err := phc.uint("i")
+	if err != nil {
+		return p, nil, nil, err
+	}
+	if i == 0 {
+		return p, nil, nil, ErrPasswordHashMalformed
+	}
+	p.Digest, p.Iterations = strings.TrimPrefix(phc.id, "pbkdf2-"), int(i)
+	return p, phc.salt, phc.hash, nil
+}
+
+func pbkdf2HashFunc(name string) (func() hash.Hash, error) {
+	switch name {
+	case "sha1":
+		return sha1.New, nil
+	case "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("password: unsupported pbkdf2 hash %s", name)
+	}
+}
+
+// PasswordEncoder 使用首选算法生成摘要，根据摘要前缀识别算法进行校验.
+type PasswordEncoder struct {
+	preferred PasswordHasher
+	hashers   []PasswordHasher
+}
+
+// NewPasswordEncoder preferred用于生成新摘要，others用于校验旧算法生成的摘要.
+func NewPasswordEncoder(preferred PasswordHasher, others ...PasswordHasher) *PasswordEncoder {
+	return &PasswordEncoder{
+		preferred: preferred,
+		hashers:   append([]PasswordHasher{preferred}, others...),
+	}
+}
+
+// DefaultPasswordEncoder 默认使用argon2id，可以校验bcrypt、scrypt和pbkdf2摘要.
+var DefaultPasswordEncoder = NewPasswordEncoder(NewArgon2idHasher(),
+	NewBcryptHasher(), NewScryptHasher(), NewPBKDF2Hasher())
+
+func (e *PasswordEncoder) Hash(password string) (string, error) {
+	return e.preferred.Hash([]byte(password))
+}
+
+// Verify 根据摘要识别算法并校验密码.
+func (e *PasswordEncoder) Verify(password, encoded string) error {
+	h, err := e.detect(encoded)
+	if err != nil {
+		return err
+	}
+	return h.Verify([]byte(password), encoded)
+}
+
+// NeedsRehash 摘要不是首选算法或者参数不一致时返回true，应在登录成功后重新生成摘要.
+func (e *PasswordEncoder) NeedsRehash(encoded string) bool {
+	h, err := e.detect(encoded)
+	if err != nil || h.ID() != e.preferred.ID() {
+		return true
+	}
+	return e.preferred.NeedsRehash(encoded)
+}
+
+func (e *PasswordEncoder) detect(encoded string) (PasswordHasher, error) {
+	id := passwordHashID(encoded)
+	if id == "" {
+		return nil, ErrPasswordHashMalformed
+	}
+	for _, h := range e.hashers {
+		if h.ID() == id {
+			return h, nil
+		}
+	}
+	// pbkdf2不同摘要算法共用一个实现
+	if strings.HasPrefix(id, "pbkdf2-") {
+		for _, h := range e.hashers {
+			if strings.HasPrefix(h.ID(), "pbkdf2-") {
+				return h, nil
+			}
+		}
+	}
+	return nil, ErrPasswordHashUnknown
+}
+
+// HashPassword 使用默认算法生成密码摘要.
+func HashPassword(password string) (string, error) {
+	return DefaultPasswordEncoder.Hash(password)
+}
+
+// VerifyPassword 校验密码，不匹配时返回ErrPasswordMismatch.
+func VerifyPassword(password, encoded string) error {
+	return DefaultPasswordEncoder.Verify(password, encoded)
+}
+
+// PasswordNeedsRehash 判断摘要是否需要使用默认算法重新生成.
+func PasswordNeedsRehash(encoded string) bool {
+	return DefaultPasswordEncoder.NeedsRehash(encoded)
+}
+
+// passwordHashID 返回摘要的算法标识，bcrypt的$2a$/$2b$/$2y$统一识别为bcrypt.
+func passwordHashID(encoded string) string {
+	if !strings.HasPrefix(encoded, "$") {
+		return ""
+	}
+	id := strings.SplitN(encoded[1:], "$", 2)[0]
+	switch id {
+	case "2a", "2b", "2y":
+		return "bcrypt"
+	}
+	return id
+}
+
+type phcString struct {
+	id      string
+	version string
+	params  map[string]string
+	salt    []byte
+	hash    []byte
+}
+
+func (p *phcString) uint(name string) (uint64, error) {
+	v, ok := p.params[name]
+	if !ok {
+		return 0, fmt.Errorf("password: missing parameter %s", name)
+	}
+	return strconv.ParseUint(v, 10, 32)
+}
+
+func parsePHC(encoded string) (*phcString, error) {
+	parts := strings.Split(encoded, "$")
+	// "", id, [v=], params, salt, hash
+	if len(parts) < 5 || parts[0] != "" {
+		return nil, ErrPasswordHashMalformed
+	}
+	p := &phcString{id: parts[1], params: map[string]string{}}
+	parts = parts[2:]
+	if strings.HasPrefix(parts[0], "v=") {
+		p.version = strings.TrimPrefix(parts[0], "v=")
+		parts = parts[1:]
+	}
+	if len(parts) != 3 {
+		return nil, ErrPasswordHashMalformed
+	}
+	for _, kv := range strings.Split(parts[0], ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, ErrPasswordHashMalformed
+		}
+		p.params[k] = v
+	}
+	var err error
+	if p.salt, err = phcEncoding.DecodeString(parts[1]); err != nil {
+		return nil, ErrPasswordHashMalformed
+	}
+	if p.hash, err = phcEncoding.DecodeString(parts[2]); err != nil || len(p.hash) == 0 {
+		return nil, ErrPasswordHashMalformed
+	}
+	return p, nil
+}
+
+func compareHash(got, want []byte) error {
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func randomSalt(n uint32) ([]byte, error) {
+	salt := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func log2(n int) int {
+	var l int
+	for n > 1 {
+		n >>= 1
+		l++
+	}
+	return l
+}
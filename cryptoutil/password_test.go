@@ -0,0 +1,88 @@
+package cryptoutil
+
+import (
+	"errors"
+	"testing"
+)
+
+func testHashers() []PasswordHasher {
+	return []PasswordHasher{
+		&Argon2idHasher{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16},
+		&BcryptHasher{Cost: 4},
+		&ScryptHasher{N: 1 << 10, R: 8, P: 1, KeyLen: 32, SaltLen: 16},
+		&PBKDF2Hasher{Digest: "sha512", Iterations: 1000, KeyLen: 64, SaltLen: 16},
+	}
+}
+
+func TestPasswordHasher(t *testing.T) {
+	for _, h := range testHashers() {
+		h := h
+		t.Run(h.ID(), func(t *testing.T) {
+			encoded, err := h.Hash([]byte("correct horse"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = h.Verify([]byte("correct horse"), encoded); err != nil {
+				t.Fatalf("%s: %v", encoded, err)
+			}
+			if err = h.Verify([]byte("wrong horse"), encoded); !errors.Is(err, ErrPasswordMismatch) {
+				t.Fatalf("expect mismatch, got %v", err)
+			}
+			if h.NeedsRehash(encoded) {
+				t.Fatalf("%s should not need rehash", encoded)
+			}
+			again, err := h.Hash([]byte("correct horse"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again == encoded {
+				t.Fatal("salt is not random")
+			}
+		})
+	}
+}
+
+func TestPasswordEncoder(t *testing.T) {
+	hashers := testHashers()
+	encoder := NewPasswordEncoder(hashers[0], hashers[1:]...)
+	for _, h := range hashers {
+		encoded, err := h.Hash([]byte("p@ssw0rd"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = encoder.Verify("p@ssw0rd", encoded); err != nil {
+			t.Fatalf("%s: %v", encoded, err)
+		}
+		if err = encoder.Verify("p@ssw0rD", encoded); !errors.Is(err, ErrPasswordMismatch) {
+			t.Fatalf("%s: expect mismatch, got %v", encoded, err)
+		}
+		if needs := encoder.NeedsRehash(encoded); needs != (h != hashers[0]) {
+			t.Fatalf("%s: unexpected NeedsRehash %v", encoded, needs)
+		}
+	}
+	stronger := NewPasswordEncoder(&Argon2idHasher{Time: 2, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16})
+	encoded, err := encoder.Hash("p@ssw0rd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stronger.NeedsRehash(encoded) {
+		t.Fatal("parameter upgrade should need rehash")
+	}
+	for _, bad := range []string{"", "plain", "$unknown$x$y$z", "$argon2id$v=19$m=1024$c2FsdA$aGFzaA"} {
+		if err = encoder.Verify("p@ssw0rd", bad); err == nil {
+			t.Fatalf("%q should not verify", bad)
+		}
+	}
+}
+
+func TestPBKDF2Vector(t *testing.T) {
+	// RFC 6070 测试向量: P="password" S="salt" c=4096 dkLen=20
+	encoded := "$pbkdf2-sha1$i=4096,l=20$" + phcEncoding.EncodeToString([]byte("salt")) +
+		"$" + phcEncoding.EncodeToString([]byte{
+		0x4b, 0x00, 0x79, 0x01, 0xb7, 0x65, 0x48, 0x9a, 0xbe, 0xad,
+		0x49, 0xd9, 0x26, 0xf7, 0x21, 0xd0, 0x65, 0xa4, 0x29, 0xc1,
+	})
+	if err := NewPBKDF2Hasher().Verify([]byte("password"), encoded); err != nil {
+		t.Fatal(err)
+	}
+}
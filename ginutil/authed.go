@@ -0,0 +1,41 @@
+package ginutil
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gorpher/gone/authed"
+	"net/http"
+)
+
+const sessionKey = "gone/session"
+
+// Authed gin中间件，要求请求已认证，会话写入gin.Context和请求上下文
+func Authed(a *authed.Authed) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		se := a.GetHTTPSession(c.Request)
+		if se == nil {
+			BadError(c, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+		c.Set(sessionKey, se)
+		c.Request = c.Request.WithContext(authed.ContextWithSession(c.Request.Context(), se))
+		c.Next()
+	}
+}
+
+// GetSession 返回Authed中间件写入的会话
+func GetSession(c *gin.Context) *authed.UserSession {
+	v, ok := c.Get(sessionKey)
+	if !ok {
+		return nil
+	}
+	se, _ := v.(*authed.UserSession) // nolint
+	return se
+}
+
+// GetActor 代理登录时返回实际操作的管理员
+func GetActor(c *gin.Context) *authed.Actor {
+	if se := GetSession(c); se != nil {
+		return se.Act
+	}
+	return nil
+}
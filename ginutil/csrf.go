@@ -0,0 +1,27 @@
+package ginutil
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gorpher/gone/authed"
+	"net/http"
+)
+
+const csrfTokenKey = "gone/csrf_token"
+
+// CSRF gin中间件，校验失败返回403
+func CSRF(c *authed.CSRF) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token, err := c.Check(ctx.Writer, ctx.Request)
+		if err != nil {
+			BadError(ctx, http.StatusForbidden, err)
+			return
+		}
+		ctx.Set(csrfTokenKey, token)
+		ctx.Next()
+	}
+}
+
+// CSRFToken 返回CSRF中间件生成的令牌
+func CSRFToken(ctx *gin.Context) string {
+	return ctx.GetString(csrfTokenKey)
+}
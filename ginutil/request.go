@@ -1,7 +1,11 @@
 package ginutil
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gorpher/gone/codec"
+	"io"
 	"net"
 	"net/http"
 	"strconv"
@@ -60,8 +64,36 @@ func GetPathInt64(c *gin.Context, key string, defaultValue int64) int64 {
 	return defaultValue
 }
 
+// MaxBodySize ShouldJson按MIME解码时读取请求体的最大字节数
+var MaxBodySize int64 = 10 << 20
+
+var ErrBodyTooLarge = errors.New("ginutil: request body too large")
+
+// ShouldJson 解码请求体并校验，默认JSON，其他Content-Type使用codec中按MIME注册的编解码器，
+// GET请求和表单交给gin绑定，请求体超过MaxBodySize时返回ErrBodyTooLarge
 func ShouldJson(c *gin.Context, v any) error {
-	return c.ShouldBindJSON(v)
+	contentType := c.ContentType()
+	if contentType == "" {
+		return c.ShouldBindJSON(v)
+	}
+	if c.Request.Method == http.MethodGet || contentType == binding.MIMEPOSTForm || contentType == binding.MIMEMultipartPOSTForm {
+		return c.ShouldBind(v)
+	}
+	cc, ok := codec.LookupMIME(contentType)
+	if !ok {
+		return c.ShouldBind(v)
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, MaxBodySize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > MaxBodySize {
+		return ErrBodyTooLarge
+	}
+	if err = cc.Decode(body, v); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(v)
 }
 func GetClientIP(c *gin.Context) string {
 	ip := c.GetHeader("X-Forwarded-For")
@@ -0,0 +1,38 @@
+package ginutil
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func bindContext(contentType, body string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", contentType)
+	return c
+}
+
+func TestShouldJson(t *testing.T) {
+	var dst negotiateItem
+	if err := ShouldJson(bindContext("application/x-yaml", "name: gone\ncount: 3\n"), &dst); err != nil || dst.Name != "gone" || dst.Count != 3 {
+		t.Fatalf("got %+v %v", dst, err)
+	}
+	dst = negotiateItem{}
+	if err := ShouldJson(bindContext("application/json", `{"name":"gone"}`), &dst); err != nil || dst.Name != "gone" {
+		t.Fatalf("got %+v %v", dst, err)
+	}
+}
+
+func TestShouldJsonBodyTooLarge(t *testing.T) {
+	defer func(n int64) { MaxBodySize = n }(MaxBodySize)
+	MaxBodySize = 16
+	var dst negotiateItem
+	if err := ShouldJson(bindContext("application/json", `{"name":"`+strings.Repeat("x", 32)+`"}`), &dst); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("expect body too large, got %v", err)
+	}
+}
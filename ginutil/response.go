@@ -2,19 +2,44 @@ package ginutil
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/gorpher/gone/codec"
 	"github.com/gorpher/gone/core"
 	"github.com/rs/zerolog/log"
 	"net/http"
 )
 
-// OkList 返回成功列表
+// OkList 返回成功列表，根据Accept协商响应格式
 func OkList(c *gin.Context, list interface{}, total int64) {
-	c.JSON(http.StatusOK, gin.H{
+	negotiate(c, http.StatusOK, gin.H{
 		"list":  list,
 		"total": total,
 	})
 }
 
+// negotiate 根据Accept选择codec中按MIME注册的编解码器，默认或者编码失败时响应JSON
+func negotiate(c *gin.Context, status int, data interface{}) {
+	mime, cc, ok := codec.Negotiate(c.GetHeader("Accept"), codec.MIMEJSON)
+	if !ok || mime == codec.MIMEJSON {
+		c.AbortWithStatusJSON(status, data)
+		return
+	}
+	if m, isMap := data.(gin.H); isMap && (mime == codec.MIMEXML || mime == codec.MIMEXML2) {
+		// encoding/xml 不支持map，使用gin.H的XML编码
+		c.Header("Vary", "Accept")
+		c.Abort()
+		c.XML(status, m)
+		return
+	}
+	body, err := cc.Encode(data)
+	if err != nil {
+		c.AbortWithStatusJSON(status, data)
+		return
+	}
+	c.Header("Vary", "Accept")
+	c.Abort()
+	c.Data(status, codec.ContentType(mime), body)
+}
+
 // Ok 返回成功信息, params作为动态参数，默认没有参数则返回204
 func Ok(c *gin.Context, params ...interface{}) {
 	if len(params) == 0 || params[0] == nil {
@@ -43,7 +68,7 @@ func Ok(c *gin.Context, params ...interface{}) {
 		}
 		return
 	}
-	c.AbortWithStatusJSON(http.StatusOK, data)
+	negotiate(c, http.StatusOK, data)
 }
 
 // Bad 错误的请求
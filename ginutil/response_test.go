@@ -0,0 +1,75 @@
+package ginutil
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorpher/gone/codec"
+)
+
+type negotiateItem struct {
+	Name  string `json:"name" xml:"name" yaml:"name"`
+	Count int    `json:"count" xml:"count" yaml:"count"`
+}
+
+func serveGin(accept string, h gin.HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", h)
+	req := httptest.NewRequest("GET", "/", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestOkNegotiate(t *testing.T) {
+	src := negotiateItem{Name: "gone", Count: 3}
+	for _, c := range []struct {
+		accept string
+		mime   string
+	}{
+		{"", codec.MIMEJSON},
+		{"application/x-yaml", codec.MIMEYAML},
+		{"application/xml", codec.MIMEXML},
+	} {
+		w := serveGin(c.accept, func(ctx *gin.Context) { Ok(ctx, src) })
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), c.mime) {
+			t.Fatalf("%q: got %d %s", c.accept, w.Code, w.Header().Get("Content-Type"))
+		}
+		cc, _ := codec.LookupMIME(c.mime)
+		var dst negotiateItem
+		if err := cc.Decode(w.Body.Bytes(), &dst); err != nil || dst != src {
+			t.Fatalf("%q: got %+v %v", c.accept, dst, err)
+		}
+	}
+}
+
+func TestOkListXML(t *testing.T) {
+	// gin.H不能使用encoding/xml直接编码
+	w := serveGin("application/xml", func(ctx *gin.Context) { OkList(ctx, []string{"a", "b"}, 2) })
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), codec.MIMEXML) {
+		t.Fatalf("got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	var dst struct {
+		Total int64 `xml:"total"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &dst); err != nil || dst.Total != 2 {
+		t.Fatalf("got %s %v", w.Body.String(), err)
+	}
+}
+
+func TestOkNegotiateFallback(t *testing.T) {
+	// 普通结构体不能编码为protobuf，退回JSON
+	w := serveGin("application/x-protobuf", func(ctx *gin.Context) { Ok(ctx, negotiateItem{Name: "gone"}) })
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), codec.MIMEJSON) ||
+		!strings.Contains(w.Body.String(), `"name":"gone"`) {
+		t.Fatalf("got %d %s %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
@@ -0,0 +1,47 @@
+package gormutil
+
+import (
+	"gorm.io/gorm"
+)
+
+// APIKeyStore 使用数据库表保存API Key，T为模型类型，例如 authed.APIKey，
+// 模型需要有id、uid、created_at、last_used_at字段:
+//
+//	store := gormutil.NewAPIKeyStore[authed.APIKey](db)
+//	a := authed.NewAuthed(authed.WithAPIKeyStore(store))
+type APIKeyStore[T any] struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyStore[T any](db *gorm.DB) *APIKeyStore[T] {
+	return &APIKeyStore[T]{db: db}
+}
+
+func (s *APIKeyStore[T]) AutoMigrate() error {
+	return s.db.AutoMigrate(new(T))
+}
+
+func (s *APIKeyStore[T]) SaveAPIKey(key *T) error {
+	return s.db.Save(key).Error
+}
+
+// GetAPIKey 记录不存在时返回gorm.ErrRecordNotFound
+func (s *APIKeyStore[T]) GetAPIKey(id string) (*T, error) {
+	key := new(T)
+	if err := s.db.Where("id = ?", id).Take(key).Error; err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// TouchAPIKey 只更新last_used_at，不会覆盖并发的撤销
+func (s *APIKeyStore[T]) TouchAPIKey(id string, lastUsedAt int64) error {
+	return s.db.Model(new(T)).Where("id = ?", id).Update("last_used_at", lastUsedAt).Error
+}
+
+// ListAPIKeys 查询用户的全部API Key
+func (s *APIKeyStore[T]) ListAPIKeys(uid string) ([]T, error) {
+	var keys []T
+	err := s.db.Where("uid = ?", uid).Order("created_at desc").Find(&keys).Error
+	return keys, err
+}
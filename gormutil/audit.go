@@ -0,0 +1,25 @@
+package gormutil
+
+import (
+	"gorm.io/gorm"
+)
+
+// AuditSink 将审计事件写入数据库表，T为事件类型，例如 authed.AuditEvent:
+//
+//	sink := gormutil.NewAuditSink[authed.AuditEvent](db)
+//	a := authed.NewAuthed(authed.WithAuditSink(sink))
+type AuditSink[T any] struct {
+	db *gorm.DB
+}
+
+func NewAuditSink[T any](db *gorm.DB) *AuditSink[T] {
+	return &AuditSink[T]{db: db}
+}
+
+func (s *AuditSink[T]) AutoMigrate() error {
+	return s.db.AutoMigrate(new(T))
+}
+
+func (s *AuditSink[T]) WriteAudit(e *T) error {
+	return s.db.Create(e).Error
+}
@@ -1,9 +1,11 @@
 package httputil
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/gorpher/gone/codec"
 	"github.com/gorpher/gone/httputil/binding"
+	"io"
 	"net"
 	"net/http"
 	"strings"
@@ -32,6 +34,10 @@ func GetOrigin(r *http.Request) string {
 	if forwardedHost != "" {
 		host = forwardedHost
 	}
+	// 服务自己终止TLS时没有X-Forwarded-Proto
+	if r.TLS != nil {
+		scheme = "https"
+	}
 	forwardedProto := r.Header.Get("X-Forwarded-Proto")
 	if forwardedProto == "https" {
 		scheme = forwardedProto
@@ -68,6 +74,13 @@ func GetClientIP(r *http.Request) string {
 	return ip
 }
 
+// MaxBodySize ShouldJson读取请求体的最大字节数
+var MaxBodySize int64 = 10 << 20
+
+var ErrBodyTooLarge = errors.New("httputil: request body too large")
+
+// ShouldJson 根据Content-Type解码请求体并校验，GET请求和表单使用表单解码，
+// 其他类型使用codec中按MIME注册的编解码器，未注册的类型不解码，请求体超过MaxBodySize时返回ErrBodyTooLarge
 func ShouldJson(r *http.Request, obj any) error {
 	contentType := r.Header.Get("Content-Type")
 	splitN := strings.SplitN(contentType, ";", 2)
@@ -90,8 +103,20 @@ func ShouldJson(r *http.Request, obj any) error {
 		if err := MapStructDecode(m, obj); err != nil {
 			return err
 		}
-	case binding.JSON:
-		if err := json.NewDecoder(r.Body).Decode(obj); err != nil {
+	case binding.FormMultipart:
+	default:
+		c, ok := codec.LookupMIME(contentType)
+		if !ok {
+			break
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, MaxBodySize+1))
+		if err != nil {
+			return err
+		}
+		if int64(len(body)) > MaxBodySize {
+			return ErrBodyTooLarge
+		}
+		if err = c.Decode(body, obj); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,35 @@
+package httputil
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestShouldJson(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader("name: gone\ncount: 3\n"))
+	req.Header.Set("Content-Type", "application/x-yaml; charset=UTF-8")
+	var dst negotiateItem
+	if err := ShouldJson(req, &dst); err != nil || dst.Name != "gone" || dst.Count != 3 {
+		t.Fatalf("got %+v %v", dst, err)
+	}
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`<negotiateItem><name>gone</name></negotiateItem>`))
+	req.Header.Set("Content-Type", "application/xml")
+	dst = negotiateItem{}
+	if err := ShouldJson(req, &dst); err != nil || dst.Name != "gone" {
+		t.Fatalf("got %+v %v", dst, err)
+	}
+}
+
+func TestShouldJsonBodyTooLarge(t *testing.T) {
+	defer func(n int64) { MaxBodySize = n }(MaxBodySize)
+	MaxBodySize = 16
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"`+strings.Repeat("x", 32)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	var dst negotiateItem
+	if err := ShouldJson(req, &dst); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("expect body too large, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package httputil
+
+import (
+	"net/http"
+
+	"github.com/gorpher/gone/codec"
+)
+
+// negotiateWriter 记录根据Accept协商出的响应格式，Ok和OkList使用
+type negotiateWriter struct {
+	http.ResponseWriter
+	mime  string
+	codec codec.ObjectCodec
+}
+
+func (w *negotiateWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Negotiate 中间件，根据请求头Accept选择Ok和OkList的响应格式，
+// 没有使用该中间件或者Accept不支持时响应JSON
+func Negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mime, c, ok := codec.Negotiate(r.Header.Get("Accept"), codec.MIMEJSON)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&negotiateWriter{ResponseWriter: w, mime: mime, codec: c}, r)
+	})
+}
+
+// negotiated 返回协商的格式，从外层依次查找被包装的ResponseWriter
+func negotiated(w http.ResponseWriter) (string, codec.ObjectCodec) {
+	for {
+		switch v := w.(type) {
+		case *negotiateWriter:
+			return v.mime, v.codec
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return codec.MIMEJSON, codec.JSONEncoder{}
+		}
+	}
+}
+
+// writeNegotiated 按协商的格式编码，编码失败时退回JSON
+func writeNegotiated(w http.ResponseWriter, status int, data any) {
+	mime, c := negotiated(w)
+	body, err := c.Encode(data)
+	if err != nil && mime != codec.MIMEJSON {
+		mime = codec.MIMEJSON
+		body, err = codec.JSONEncoder{}.Encode(data)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", codec.ContentType(mime))
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	w.Write(body) // nolint
+}
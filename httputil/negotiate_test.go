@@ -0,0 +1,84 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorpher/gone/codec"
+)
+
+type negotiateItem struct {
+	Name  string `json:"name" xml:"name" yaml:"name"`
+	Count int    `json:"count" xml:"count" yaml:"count"`
+}
+
+func serveNegotiated(accept string, h http.HandlerFunc) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	Negotiate(h).ServeHTTP(w, req)
+	return w
+}
+
+func TestNegotiateOk(t *testing.T) {
+	src := negotiateItem{Name: "gone", Count: 3}
+	for _, c := range []struct {
+		accept string
+		mime   string
+	}{
+		{"", codec.MIMEJSON},
+		{"application/xml", codec.MIMEXML},
+		{"application/x-yaml", codec.MIMEYAML},
+		{"application/x-msgpack", codec.MIMEMSGPACK},
+	} {
+		w := serveNegotiated(c.accept, func(w http.ResponseWriter, r *http.Request) {
+			Ok(w, src)
+		})
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != codec.ContentType(c.mime) {
+			t.Fatalf("%q: got %d %s", c.accept, w.Code, w.Header().Get("Content-Type"))
+		}
+		cc, _ := codec.LookupMIME(c.mime)
+		var dst negotiateItem
+		if err := cc.Decode(w.Body.Bytes(), &dst); err != nil || dst != src {
+			t.Fatalf("%q: got %+v %v", c.accept, dst, err)
+		}
+	}
+}
+
+func TestNegotiateOkList(t *testing.T) {
+	w := serveNegotiated("application/x-yaml", func(w http.ResponseWriter, r *http.Request) {
+		OkList(w, []negotiateItem{{Name: "a", Count: 1}}, 1)
+	})
+	if w.Header().Get("Content-Type") != codec.ContentType(codec.MIMEYAML) || w.Header().Get("Vary") != "Accept" {
+		t.Fatalf("unexpected headers %v", w.Header())
+	}
+	var dst struct {
+		List  []negotiateItem `yaml:"list"`
+		Total int64           `yaml:"total"`
+	}
+	if err := (codec.YAMLEncoder{}).Decode(w.Body.Bytes(), &dst); err != nil || dst.Total != 1 || len(dst.List) != 1 || dst.List[0].Name != "a" {
+		t.Fatalf("got %+v %v", dst, err)
+	}
+}
+
+func TestNegotiateFallback(t *testing.T) {
+	// 普通结构体不能编码为protobuf，退回JSON
+	w := serveNegotiated("application/x-protobuf", func(w http.ResponseWriter, r *http.Request) {
+		Ok(w, negotiateItem{Name: "gone"})
+	})
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != codec.ContentType(codec.MIMEJSON) ||
+		!strings.Contains(w.Body.String(), `"name":"gone"`) {
+		t.Fatalf("got %d %s %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	// 没有使用中间件时响应JSON
+	rec := httptest.NewRecorder()
+	Ok(rec, negotiateItem{Name: "gone"})
+	if rec.Header().Get("Content-Type") != codec.ContentType(codec.MIMEJSON) {
+		t.Fatalf("got %s", rec.Header().Get("Content-Type"))
+	}
+}
@@ -15,10 +15,10 @@ type JsonRawBody map[string]any
 
 // JsonListBody 分页响应体
 type JsonListBody struct {
-	List  any    `json:"list"`
-	Total int64  `json:"total"`
-	Code  int    `json:"code,omitempty"`
-	Msg   string `json:"msg,omitempty"`
+	List  any    `json:"list" xml:"list" yaml:"list"`
+	Total int64  `json:"total" xml:"total" yaml:"total"`
+	Code  int    `json:"code,omitempty" xml:"code,omitempty" yaml:"code,omitempty"`
+	Msg   string `json:"msg,omitempty" xml:"msg,omitempty" yaml:"msg,omitempty"`
 }
 
 // JsonDataBody json响应体
@@ -28,7 +28,8 @@ type JsonDataBody struct {
 	Data any    `json:"data,omitempty"`
 }
 
-// Ok 返回成功信息, params作为动态参数，默认没有参数则返回204
+// Ok 返回成功信息, params作为动态参数，默认没有参数则返回204，
+// 字符串和字节切片原样返回，其他类型按Negotiate协商的格式编码，默认JSON
 func Ok(w http.ResponseWriter, params ...any) {
 	if len(params) == 0 || params[0] == nil {
 		w.WriteHeader(http.StatusNoContent)
@@ -49,19 +50,12 @@ func Ok(w http.ResponseWriter, params ...any) {
 		w.Write(by) // nolint
 		return
 	}
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(data) // nolint
+	writeNegotiated(w, http.StatusOK, data)
 }
 
-// OkList 返回成功列表
+// OkList 返回成功列表，按Negotiate协商的格式编码
 func OkList(w http.ResponseWriter, list any, total int64) {
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(JsonRawBody{ // nolint
-		"list":  list,
-		"total": total,
-	})
+	writeNegotiated(w, http.StatusOK, JsonListBody{List: list, Total: total})
 }
 
 // Bad 错误的请求
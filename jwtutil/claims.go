@@ -0,0 +1,226 @@
+package jwtutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorpher/gone/codec"
+)
+
+var (
+	ErrTokenExpired     = errors.New("jwt: token is expired")
+	ErrTokenNotYetValid = errors.New("jwt: token is not valid yet")
+	ErrTokenUsedEarly   = errors.New("jwt: token used before issued")
+	ErrMissingExpiry    = errors.New("jwt: token has no exp claim")
+	ErrInvalidIssuer    = errors.New("jwt: invalid issuer")
+	ErrInvalidAudience  = errors.New("jwt: invalid audience")
+	ErrInvalidSubject   = errors.New("jwt: invalid subject")
+	ErrInvalidType      = errors.New("jwt: invalid typ header")
+)
+
+// Claims 自定义声明嵌入codec.Payload即可满足该接口，例如:
+//
+//	type MyClaims struct {
+//		codec.Payload
+//		Roles []string `json:"roles"`
+//	}
+type Claims interface {
+	RegisteredClaims() codec.Payload
+}
+
+// Keyfunc 根据header的kid、alg选择校验器，返回的校验器算法必须与header一致
+type Keyfunc func(header *codec.Header) (Verifier, error)
+
+// Verifiers 从固定的校验器中按alg选择，同一算法有多个校验器时依次尝试
+func Verifiers(verifiers ...Verifier) Keyfunc {
+	return func(header *codec.Header) (Verifier, error) {
+		var matched multiVerifier
+		for _, v := range verifiers {
+			if v.Algorithm() == header.Algorithm {
+				matched = append(matched, v)
+			}
+		}
+		if len(matched) == 0 {
+			return nil, ErrAlgorithmNotAllowed
+		}
+		return matched, nil
+	}
+}
+
+// KeySetKeyfunc 按kid从JWKSet查找密钥，只接受algs中的算法，JWK声明了alg时必须一致
+func KeySetKeyfunc(set *JWKSet, algs ...string) Keyfunc {
+	return func(header *codec.Header) (Verifier, error) {
+		if !containsString(algs, header.Algorithm) {
+			return nil, ErrAlgorithmNotAllowed
+		}
+		jwk, err := set.Lookup(header.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Algorithm != "" && jwk.Algorithm != header.Algorithm || jwk.Use != "" && jwk.Use != "sig" {
+			return nil, ErrAlgorithmNotAllowed
+		}
+		key, err := jwk.Key()
+		if err != nil {
+			return nil, err
+		}
+		return NewVerifier(header.Algorithm, key)
+	}
+}
+
+type multiVerifier []Verifier
+
+func (m multiVerifier) Algorithm() string {
+	return m[0].Algorithm()
+}
+
+func (m multiVerifier) Verify(signingInput, signature []byte) (err error) {
+	for _, v := range m {
+		if err = v.Verify(signingInput, signature); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+type parseOptions struct {
+	issuer        string
+	audience      string
+	subject       string
+	typ           string
+	leeway        time.Duration
+	now           func() time.Time
+	requireExpiry bool
+}
+
+type ParseOption func(o *parseOptions)
+
+func WithIssuer(iss string) ParseOption {
+	return func(o *parseOptions) {
+		o.issuer = iss
+	}
+}
+
+// WithAudience aud声明必须包含该受众
+func WithAudience(aud string) ParseOption {
+	return func(o *parseOptions) {
+		o.audience = aud
+	}
+}
+
+func WithSubject(sub string) ParseOption {
+	return func(o *parseOptions) {
+		o.subject = sub
+	}
+}
+
+// WithType header的typ必须一致，例如 "JWT"、"at+jwt"
+func WithType(typ string) ParseOption {
+	return func(o *parseOptions) {
+		o.typ = typ
+	}
+}
+
+// WithLeeway 校验exp、nbf、iat时允许的时钟误差
+func WithLeeway(d time.Duration) ParseOption {
+	return func(o *parseOptions) {
+		o.leeway = d
+	}
+}
+
+func WithTimeFunc(now func() time.Time) ParseOption {
+	return func(o *parseOptions) {
+		o.now = now
+	}
+}
+
+// WithRequireExpiry 没有exp声明时拒绝
+func WithRequireExpiry() ParseOption {
+	return func(o *parseOptions) {
+		o.requireExpiry = true
+	}
+}
+
+// Parse 校验签名和注册声明，返回类型化的声明
+func Parse[C Claims](token []byte, keyfunc Keyfunc, opts ...ParseOption) (claims C, err error) {
+	o := &parseOptions{now: time.Now}
+	for _, opt := range opts {
+		opt(o)
+	}
+	header, signingInput, payload, sig, err := splitCompact(token)
+	if err != nil {
+		return
+	}
+	if header.Algorithm == "" || header.Algorithm == "none" {
+		err = ErrAlgorithmNone
+		return
+	}
+	if o.typ != "" && header.Type != o.typ {
+		err = ErrInvalidType
+		return
+	}
+	v, err := keyfunc(header)
+	if err != nil {
+		return
+	}
+	if v.Algorithm() != header.Algorithm {
+		err = ErrAlgorithmNotAllowed
+		return
+	}
+	if err = v.Verify(signingInput, sig); err != nil {
+		return
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return
+	}
+	err = o.validate(claims.RegisteredClaims())
+	return
+}
+
+// ParseInsecure 不校验签名和声明直接解析，只能用于调试和日志
+func ParseInsecure[C Claims](token []byte) (claims C, header *codec.Header, err error) {
+	header, _, payload, _, err := splitCompact(token)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(payload, &claims)
+	return
+}
+
+func (o *parseOptions) validate(p codec.Payload) error {
+	now := o.now()
+	if p.ExpirationTime == nil {
+		if o.requireExpiry {
+			return ErrMissingExpiry
+		}
+	} else if now.After(p.ExpirationTime.Add(o.leeway)) {
+		return ErrTokenExpired
+	}
+	if p.NotBefore != nil && now.Add(o.leeway).Before(p.NotBefore.Time) {
+		return ErrTokenNotYetValid
+	}
+	if p.IssuedAt != nil && now.Add(o.leeway).Before(p.IssuedAt.Time) {
+		return ErrTokenUsedEarly
+	}
+	if o.issuer != "" && p.Issuer != o.issuer {
+		return fmt.Errorf("%w: %s", ErrInvalidIssuer, p.Issuer)
+	}
+	if o.audience != "" && !p.Audience.Contains(o.audience) {
+		return ErrInvalidAudience
+	}
+	if o.subject != "" && p.Subject != o.subject {
+		return ErrInvalidSubject
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for i := range list {
+		if list[i] == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package jwtutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorpher/gone/codec"
+	"github.com/gorpher/gone/core"
+)
+
+type testClaims struct {
+	codec.Payload
+	Roles []string `json:"roles"`
+}
+
+func signClaims(t *testing.T, s Signer, kid string, claims interface{}) []byte {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := Sign(s, codec.Header{Type: "JWT", KeyID: kid}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestParse(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	s, _ := NewSigner("HS256", key)   // nolint
+	v, _ := NewVerifier("HS256", key) // nolint
+	now := time.Now()
+	token := signClaims(t, s, "", testClaims{
+		Payload: codec.Payload{
+			Issuer:         "gone",
+			Subject:        "u1",
+			Audience:       codec.Audience{"app", "admin"},
+			ExpirationTime: core.NumericDate(now.Add(time.Hour)),
+			IssuedAt:       core.NumericDate(now),
+		},
+		Roles: []string{"admin"},
+	})
+	claims, err := Parse[testClaims](token, Verifiers(v), WithIssuer("gone"), WithAudience("admin"), WithType("JWT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "u1" || len(claims.Roles) != 1 || claims.Roles[0] != "admin" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	tests := []struct {
+		name string
+		opts []ParseOption
+		want error
+	}{
+		{"issuer", []ParseOption{WithIssuer("other")}, ErrInvalidIssuer},
+		{"audience", []ParseOption{WithAudience("api")}, ErrInvalidAudience},
+		{"subject", []ParseOption{WithSubject("u2")}, ErrInvalidSubject},
+		{"type", []ParseOption{WithType("at+jwt")}, ErrInvalidType},
+		{"expired", []ParseOption{WithTimeFunc(func() time.Time { return now.Add(2 * time.Hour) })}, ErrTokenExpired},
+		{"leeway", []ParseOption{WithTimeFunc(func() time.Time { return now.Add(time.Hour + time.Second) }), WithLeeway(time.Minute)}, nil},
+		{"issued in future", []ParseOption{WithTimeFunc(func() time.Time { return now.Add(-time.Hour) })}, ErrTokenUsedEarly},
+	}
+	for _, tt := range tests {
+		if _, err = Parse[testClaims](token, Verifiers(v), tt.opts...); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: got %v want %v", tt.name, err, tt.want)
+		}
+	}
+
+	noExp := signClaims(t, s, "", codec.Payload{Subject: "u1"})
+	if _, err = Parse[codec.Payload](noExp, Verifiers(v), WithRequireExpiry()); !errors.Is(err, ErrMissingExpiry) {
+		t.Fatalf("missing exp: %v", err)
+	}
+	nbf := signClaims(t, s, "", codec.Payload{NotBefore: core.NumericDate(now.Add(time.Hour))})
+	if _, err = Parse[codec.Payload](nbf, Verifiers(v)); !errors.Is(err, ErrTokenNotYetValid) {
+		t.Fatalf("nbf: %v", err)
+	}
+}
+
+func TestParseKeySet(t *testing.T) {
+	k1, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader) // nolint
+	k2, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader) // nolint
+	set, err := NewJWKSet(&k1.PublicKey, &k2.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, _ := NewSigner("ES256", k2) // nolint
+	token := signClaims(t, s2, set.Keys[1].KID, codec.Payload{Subject: "u2"})
+	claims, err := Parse[codec.Payload](token, KeySetKeyfunc(set, "ES256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "u2" {
+		t.Fatalf("got %+v", claims)
+	}
+	// kid指向另一个密钥
+	wrongKid := signClaims(t, s2, set.Keys[0].KID, codec.Payload{Subject: "u2"})
+	if _, err = Parse[codec.Payload](wrongKid, KeySetKeyfunc(set, "ES256")); !errors.Is(err, ErrECDSAVerification) {
+		t.Fatalf("wrong kid: %v", err)
+	}
+	if _, err = Parse[codec.Payload](token, KeySetKeyfunc(set, "RS256")); !errors.Is(err, ErrAlgorithmNotAllowed) {
+		t.Fatalf("unpinned alg: %v", err)
+	}
+	unknown := signClaims(t, s2, "missing", codec.Payload{})
+	if _, err = Parse[codec.Payload](unknown, KeySetKeyfunc(set, "ES256")); !errors.Is(err, ErrJWKNotFound) {
+		t.Fatalf("unknown kid: %v", err)
+	}
+}
+
+func TestParseInsecure(t *testing.T) {
+	token := []byte("eyJhbGciOiJub25lIn0.eyJzdWIiOiIxIiwiYXVkIjpbImEiLCJiIl19.")
+	claims, header, err := ParseInsecure[codec.Payload](token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Algorithm != "none" || claims.Subject != "1" || len(claims.Audience) != 2 {
+		t.Fatalf("unexpected %+v %+v", header, claims)
+	}
+	if _, err = Parse[codec.Payload](token, Verifiers()); !errors.Is(err, ErrAlgorithmNone) {
+		t.Fatalf("alg none: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package jwtutil
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/gorpher/gone/codec"
+	"github.com/gorpher/gone/cryptoutil"
+)
+
+// RFC 7638 3.1
+func TestJWKThumbprintRFC7638(t *testing.T) {
+	jwk := &JWK{
+		KTY: "RSA",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn" +
+			"64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91C" +
+			"bOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:         "AQAB",
+		Algorithm: "RS256",
+		KID:       "2011-04-29",
+	}
+	sum, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := base64.RawURLEncoding.EncodeToString(sum); got != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+// RFC 8037 A.3
+func TestJWKThumbprintRFC8037(t *testing.T) {
+	jwk := &JWK{KTY: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	sum, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := base64.RawURLEncoding.EncodeToString(sum); got != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestJWKRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []interface{}{rsaKey, &rsaKey.PublicKey}
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		k, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, k, &k.PublicKey)
+	}
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = append(keys, edPriv, edPub, x25519, x25519.PublicKey(), []byte("0123456789abcdef0123456789abcdef"))
+
+	for _, key := range keys {
+		jwk, err := NewJWK(key)
+		if err != nil {
+			t.Fatalf("%T: %v", key, err)
+		}
+		data, err := json.Marshal(jwk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var parsed JWK
+		if err = json.Unmarshal(data, &parsed); err != nil {
+			t.Fatal(err)
+		}
+		got, err := parsed.Key()
+		if err != nil {
+			t.Fatalf("%T: %v", key, err)
+		}
+		if e, ok := key.(interface{ Equal(crypto.PrivateKey) bool }); ok && !e.Equal(got) {
+			t.Fatalf("%T: key mismatch", key)
+		}
+		if e, ok := key.(interface{ Equal(crypto.PublicKey) bool }); ok && !e.Equal(got) {
+			t.Fatalf("%T: key mismatch", key)
+		}
+		if b, ok := key.([]byte); ok && !reflect.DeepEqual(b, got) {
+			t.Fatalf("oct key mismatch")
+		}
+		// 公钥和私钥的kid相同
+		if parsed.KTY != "oct" {
+			pub, err := NewJWK(mustPublic(t, got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pub.KID != jwk.KID || pub.IsPrivate() {
+				t.Fatalf("%T: kid %s != %s", key, pub.KID, jwk.KID)
+			}
+		}
+	}
+}
+
+func mustPublic(t *testing.T, key interface{}) crypto.PublicKey {
+	if p, ok := key.(interface{ Public() crypto.PublicKey }); ok {
+		return p.Public()
+	}
+	if p, ok := key.(*ecdh.PrivateKey); ok {
+		return p.PublicKey()
+	}
+	return key
+}
+
+func TestJWKInvalidPrivateKey(t *testing.T) {
+	a, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader) // nolint
+	b, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader) // nolint
+	jwk, err := NewJWK(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewJWK(b) // nolint
+	jwk.D = other.D
+	if _, err = jwk.Key(); err == nil {
+		t.Fatal("mismatched d accepted")
+	}
+}
+
+func TestJWKFromCryptoutilPEM(t *testing.T) {
+	rsaPriv, rsaPub, err := cryptoutil.GenerateRSAKeyToMemory(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPriv, ecPub, err := cryptoutil.GenerateECDSAKeyToMemory(elliptic.P256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pair := range [][2][]byte{{rsaPriv, rsaPub}, {ecPriv, ecPub}} {
+		priv, err := ParseJWKFromPEM(pair[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := ParseJWKFromPEM(pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !priv.IsPrivate() || pub.IsPrivate() || priv.KID != pub.KID {
+			t.Fatalf("unexpected jwk %s %s", priv.KID, pub.KID)
+		}
+		// 转回PEM后仍能签名和校验
+		privPEM, err := priv.MarshalPEM()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubPEM, err := pub.MarshalPEM()
+		if err != nil {
+			t.Fatal(err)
+		}
+		privKey, err := ParseKeyPEM(privPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKey, err := ParseKeyPEM(pubPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		alg := "RS256"
+		if priv.KTY == "EC" {
+			alg = "ES256"
+		}
+		s, err := NewSigner(alg, privKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := NewVerifier(alg, pubKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := Sign(s, codec.Header{KeyID: priv.KID}, []byte(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err = Verify(token, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestJWKSetPublic(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := NewJWKSet(rsaKey, edKey, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := set.Public()
+	if len(pub.Keys) != 2 {
+		t.Fatalf("got %d keys", len(pub.Keys))
+	}
+	for _, k := range pub.Keys {
+		if k.IsPrivate() {
+			t.Fatalf("private member leaked in %s", k.KID)
+		}
+		found, err := set.Lookup(k.KID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.KTY != k.KTY {
+			t.Fatalf("lookup %s returned %s", k.KID, found.KTY)
+		}
+	}
+	if _, err = set.Lookup("missing"); err != ErrJWKNotFound {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,392 @@
+package jwtutil
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+
+	"github.com/gorpher/gone/core"
+	"github.com/gorpher/gone/cryptoutil"
+)
+
+// ErrJWKNotFound 在JWKSet中找不到对应kid的密钥
+var ErrJWKNotFound = errors.New("jwt: jwk not found")
+
+// ErrUnsupportedKey 不支持的密钥类型
+var ErrUnsupportedKey = errors.New("jwt: unsupported key type")
+
+// JWKSet JSON Web Key Set，参考 RFC 7517 5
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// ParseJWKSet 解析JWKS
+func ParseJWKSet(jsonBytes []byte) (*JWKSet, error) {
+	var set JWKSet
+	if err := json.Unmarshal(jsonBytes, &set); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// Lookup 根据kid查找密钥，kid为空且只有一个密钥时返回该密钥
+func (s *JWKSet) Lookup(kid string) (*JWK, error) {
+	if kid == "" && len(s.Keys) == 1 {
+		return &s.Keys[0], nil
+	}
+	for i := range s.Keys {
+		if s.Keys[i].KID == kid {
+			return &s.Keys[i], nil
+		}
+	}
+	return nil, ErrJWKNotFound
+}
+
+// NewJWKSet 将密钥转换为JWKSet，key的类型参考NewJWK
+func NewJWKSet(keys ...interface{}) (*JWKSet, error) {
+	set := &JWKSet{}
+	for _, key := range keys {
+		jwk, err := NewJWK(key)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, *jwk)
+	}
+	return set, nil
+}
+
+// Public 去掉私钥和对称密钥，用于发布jwks_uri
+func (s *JWKSet) Public() *JWKSet {
+	set := &JWKSet{}
+	for i := range s.Keys {
+		if s.Keys[i].KTY == "oct" {
+			continue
+		}
+		set.Keys = append(set.Keys, *s.Keys[i].Public())
+	}
+	return set
+}
+
+// NewJWK 将密钥转换为JWK，kid为RFC 7638指纹，支持:
+// *rsa.PublicKey、*rsa.PrivateKey、*ecdsa.PublicKey、*ecdsa.PrivateKey、
+// ed25519.PublicKey、ed25519.PrivateKey、*ecdh.PublicKey、*ecdh.PrivateKey(X25519)、[]byte(oct)
+func NewJWK(key interface{}) (*JWK, error) {
+	enc := func(b []byte) string {
+		return string(core.Base64RawURLEncode(b))
+	}
+	var jwk *JWK
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		jwk = &JWK{KTY: "RSA", N: enc(k.N.Bytes()), E: enc(big.NewInt(int64(k.E)).Bytes())}
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, ErrUnsupportedKey
+		}
+		k.Precompute()
+		jwk, _ = NewJWK(&k.PublicKey) // nolint
+		jwk.D = enc(k.D.Bytes())
+		jwk.P = enc(k.Primes[0].Bytes())
+		jwk.Q = enc(k.Primes[1].Bytes())
+		jwk.DP = enc(k.Precomputed.Dp.Bytes())
+		jwk.DQ = enc(k.Precomputed.Dq.Bytes())
+		jwk.QI = enc(k.Precomputed.Qinv.Bytes())
+	case *ecdsa.PublicKey:
+		size := byteSize(k.Params().BitSize)
+		jwk = &JWK{KTY: "EC", Crv: k.Params().Name, X: enc(k.X.FillBytes(make([]byte, size))), Y: enc(k.Y.FillBytes(make([]byte, size)))}
+	case *ecdsa.PrivateKey:
+		jwk, _ = NewJWK(&k.PublicKey) // nolint
+		jwk.D = enc(k.D.FillBytes(make([]byte, byteSize(k.Params().BitSize))))
+	case ed25519.PublicKey:
+		jwk = &JWK{KTY: "OKP", Crv: "Ed25519", X: enc(k)}
+	case ed25519.PrivateKey:
+		jwk = &JWK{KTY: "OKP", Crv: "Ed25519", X: enc(k.Public().(ed25519.PublicKey)), D: enc(k.Seed())}
+	case *ecdh.PublicKey:
+		if k.Curve() != ecdh.X25519() {
+			return nil, ErrUnsupportedKey
+		}
+		jwk = &JWK{KTY: "OKP", Crv: "X25519", X: enc(k.Bytes())}
+	case *ecdh.PrivateKey:
+		if k.Curve() != ecdh.X25519() {
+			return nil, ErrUnsupportedKey
+		}
+		jwk = &JWK{KTY: "OKP", Crv: "X25519", X: enc(k.PublicKey().Bytes()), D: enc(k.Bytes())}
+	case []byte:
+		jwk = &JWK{KTY: "oct", K: enc(k)}
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	kid, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	jwk.KID = string(core.Base64RawURLEncode(kid))
+	return jwk, nil
+}
+
+// Thumbprint 计算JWK指纹，参考 RFC 7638，只使用必需成员并按字典序排列
+func (k *JWK) Thumbprint(h crypto.Hash) ([]byte, error) {
+	var members map[string]string
+	switch k.KTY {
+	case "RSA":
+		members = map[string]string{"e": k.E, "kty": k.KTY, "n": k.N}
+	case "EC":
+		members = map[string]string{"crv": k.Crv, "kty": k.KTY, "x": k.X, "y": k.Y}
+	case "OKP":
+		members = map[string]string{"crv": k.Crv, "kty": k.KTY, "x": k.X}
+	case "oct":
+		members = map[string]string{"k": k.K, "kty": k.KTY}
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	// encoding/json按键名排序输出map，base64url和曲线名称中没有需要转义的字符
+	data, err := json.Marshal(members)
+	if err != nil {
+		return nil, err
+	}
+	d := h.New()
+	d.Write(data)
+	return d.Sum(nil), nil
+}
+
+// IsPrivate 是否包含私钥或对称密钥
+func (k *JWK) IsPrivate() bool {
+	return k.D != "" || k.KTY == "oct"
+}
+
+// Public 返回去掉私钥成员的副本
+func (k *JWK) Public() *JWK {
+	pub := *k
+	pub.D, pub.P, pub.Q, pub.DP, pub.DQ, pub.QI, pub.K = "", "", "", "", "", "", ""
+	return &pub
+}
+
+// PublicKey 返回JWK对应的公钥，私钥JWK返回其公钥部分
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.KTY {
+	case "RSA":
+		data, err := json.Marshal(k.Public())
+		if err != nil {
+			return nil, err
+		}
+		return ParseRsaPublicKeyByJWK(data)
+	case "EC":
+		return k.ecdsaPublicKey()
+	case "OKP":
+		x, err := core.Base64RawURLDecode([]byte(k.X))
+		if err != nil {
+			return nil, err
+		}
+		switch k.Crv {
+		case "Ed25519":
+			if len(x) != ed25519.PublicKeySize {
+				return nil, ErrUnsupportedKey
+			}
+			return ed25519.PublicKey(x), nil
+		case "X25519":
+			return ecdh.X25519().NewPublicKey(x)
+		}
+		return nil, errors.New("Unknown curve: '" + k.Crv + "'")
+	default:
+		return nil, errors.New("Unknown key type algorithm: '" + k.KTY + "'")
+	}
+}
+
+// Key 返回私钥，没有私钥时返回公钥，oct返回[]byte
+func (k *JWK) Key() (interface{}, error) {
+	if k.KTY == "oct" {
+		return core.Base64RawURLDecode([]byte(k.K))
+	}
+	if k.D == "" {
+		return k.PublicKey()
+	}
+	d, err := core.Base64RawURLDecode([]byte(k.D))
+	if err != nil {
+		return nil, err
+	}
+	switch k.KTY {
+	case "RSA":
+		return k.rsaPrivateKey(d)
+	case "EC":
+		pub, err := k.ecdsaPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		priv := &ecdsa.PrivateKey{PublicKey: *pub, D: new(big.Int).SetBytes(d)}
+		// 校验d与x、y是否匹配
+		ecdhKey, err := priv.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		ecdhPub, err := pub.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		if !ecdhKey.PublicKey().Equal(ecdhPub) {
+			return nil, ErrInvalidKey
+		}
+		return priv, nil
+	case "OKP":
+		pub, err := k.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		switch p := pub.(type) {
+		case ed25519.PublicKey:
+			if len(d) != ed25519.SeedSize {
+				return nil, ErrInvalidKey
+			}
+			priv := ed25519.NewKeyFromSeed(d)
+			if !p.Equal(priv.Public()) {
+				return nil, ErrInvalidKey
+			}
+			return priv, nil
+		case *ecdh.PublicKey:
+			priv, err := ecdh.X25519().NewPrivateKey(d)
+			if err != nil {
+				return nil, err
+			}
+			if !p.Equal(priv.PublicKey()) {
+				return nil, ErrInvalidKey
+			}
+			return priv, nil
+		}
+	}
+	return nil, ErrUnsupportedKey
+}
+
+func (k *JWK) rsaPrivateKey(d []byte) (*rsa.PrivateKey, error) {
+	pub, err := k.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	p, err := core.Base64RawURLDecode([]byte(k.P))
+	if err != nil {
+		return nil, err
+	}
+	q, err := core.Base64RawURLDecode([]byte(k.Q))
+	if err != nil {
+		return nil, err
+	}
+	if len(p) == 0 || len(q) == 0 {
+		// 不支持只有n、e、d的私钥
+		return nil, ErrUnsupportedKey
+	}
+	priv := &rsa.PrivateKey{
+		PublicKey: *pub.(*rsa.PublicKey),
+		D:         new(big.Int).SetBytes(d),
+		Primes:    []*big.Int{new(big.Int).SetBytes(p), new(big.Int).SetBytes(q)},
+	}
+	if err = priv.Validate(); err != nil {
+		return nil, err
+	}
+	priv.Precompute()
+	return priv, nil
+}
+
+func (k *JWK) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, errors.New("Unknown curve: '" + k.Crv + "'")
+	}
+	x, err := core.Base64RawURLDecode([]byte(k.X))
+	if err != nil {
+		return nil, err
+	}
+	y, err := core.Base64RawURLDecode([]byte(k.Y))
+	if err != nil {
+		return nil, err
+	}
+	pub := &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+	if !curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, errors.New("jwt: EC point is not on curve")
+	}
+	return pub, nil
+}
+
+// EcdsaPublicKeyToJWK 将ECDSA公钥转换为JWK，kid为RFC 7638指纹
+func EcdsaPublicKeyToJWK(pub *ecdsa.PublicKey) ([]byte, error) {
+	jwk, err := NewJWK(pub)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jwk)
+}
+
+// ParseKeyPEM 解析PEM、hex或base64编码的DER密钥，兼容cryptoutil.GenerateRSAKey、GenerateECDSAKey生成的密钥
+func ParseKeyPEM(data []byte) (interface{}, error) {
+	der, err := cryptoutil.DecodePemHexBase64(data)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyDER(der)
+}
+
+// ParseKeyDER 依次尝试PKCS1、PKCS8、SEC1私钥和PKCS1、PKIX公钥，不依赖PEM的类型
+func ParseKeyDER(der []byte) (interface{}, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return key, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// ParseJWKFromPEM 将PEM密钥转换为JWK
+func ParseJWKFromPEM(data []byte) (*JWK, error) {
+	key, err := ParseKeyPEM(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewJWK(key)
+}
+
+// MarshalPEM 私钥输出为PKCS8 "PRIVATE KEY"，公钥输出为PKIX "PUBLIC KEY"，oct不支持
+func (k *JWK) MarshalPEM() ([]byte, error) {
+	if k.KTY == "oct" {
+		return nil, ErrUnsupportedKey
+	}
+	key, err := k.Key()
+	if err != nil {
+		return nil, err
+	}
+	block := &pem.Block{Type: "PUBLIC KEY"}
+	if k.D != "" {
+		block.Type = "PRIVATE KEY"
+		block.Bytes, err = x509.MarshalPKCS8PrivateKey(key)
+	} else {
+		block.Bytes, err = x509.MarshalPKIXPublicKey(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
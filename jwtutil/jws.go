@@ -0,0 +1,457 @@
+package jwtutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/gorpher/gone/codec"
+)
+
+/*
+JWS签名与校验，参考 RFC 7515、RFC 7518 3、RFC 8037:
+1. 算法注册表按alg名称保存签名器和校验器的构造函数，内置HS/RS/PS/ES 256/384/512、EdDSA和国密SM2SM3、HMAC-SM3
+2. Signer、Verifier在构造时绑定算法和密钥，密钥类型与算法不匹配时直接报错
+3. Verify只接受调用方传入的校验器的算法，"none"和未固定的算法一律拒绝，防止算法混淆攻击
+*/
+
+var (
+	// ErrAlgorithmNone 拒绝不签名的 "none" 算法
+	ErrAlgorithmNone = errors.New("jwt: alg none is not allowed")
+	// ErrAlgorithmNotAllowed 令牌的算法不在调用方固定的算法中
+	ErrAlgorithmNotAllowed = errors.New("jwt: algorithm not allowed")
+	// ErrUnsupportedAlgorithm 算法没有注册
+	ErrUnsupportedAlgorithm = errors.New("jwt: unsupported algorithm")
+	// ErrInvalidKey 密钥类型与算法不匹配
+	ErrInvalidKey = errors.New("jwt: invalid key for algorithm")
+	// ErrHmacKeyTooShort HMAC密钥不能短于hash输出长度，参考 RFC 7518 3.2
+	ErrHmacKeyTooShort = errors.New("jwt: hmac key is shorter than hash size")
+	// ErrRSAKeyTooShort RSA密钥不能小于2048位，参考 RFC 7518 3.3
+	ErrRSAKeyTooShort = errors.New("jwt: rsa key must be at least 2048 bits")
+	// ErrEdDSAVerification is the error for an invalid EdDSA signature.
+	ErrEdDSAVerification = errors.New("jwt: EdDSA verification failed")
+)
+
+// Signer 使用绑定的算法和私钥签名
+type Signer interface {
+	Algorithm() string
+	Sign(signingInput []byte) ([]byte, error)
+}
+
+// Verifier 使用绑定的算法和公钥校验签名
+type Verifier interface {
+	Algorithm() string
+	Verify(signingInput, signature []byte) error
+}
+
+// SignerConstructor 根据密钥创建签名器，key的类型由算法决定
+type SignerConstructor func(key interface{}) (Signer, error)
+
+// VerifierConstructor 根据密钥创建校验器，key的类型由算法决定
+type VerifierConstructor func(key interface{}) (Verifier, error)
+
+type algorithm struct {
+	newSigner   SignerConstructor
+	newVerifier VerifierConstructor
+}
+
+var (
+	algorithmsMu sync.RWMutex
+	algorithms   = map[string]algorithm{}
+)
+
+func init() {
+	for _, a := range []struct {
+		name  string
+		hash  crypto.Hash
+		curve elliptic.Curve
+	}{
+		{"HS256", crypto.SHA256, nil},
+		{"HS384", crypto.SHA384, nil},
+		{"HS512", crypto.SHA512, nil},
+		{"RS256", crypto.SHA256, nil},
+		{"RS384", crypto.SHA384, nil},
+		{"RS512", crypto.SHA512, nil},
+		{"PS256", crypto.SHA256, nil},
+		{"PS384", crypto.SHA384, nil},
+		{"PS512", crypto.SHA512, nil},
+		{"ES256", crypto.SHA256, elliptic.P256()},
+		{"ES384", crypto.SHA384, elliptic.P384()},
+		{"ES512", crypto.SHA512, elliptic.P521()},
+		{"EdDSA", 0, nil},
+	} {
+		var s SignerConstructor
+		var v VerifierConstructor
+		switch a.name[:2] {
+		case "HS":
+			s, v = hmacAlgorithm(a.name, a.hash.New)
+		case "RS":
+			s, v = rsaAlgorithm(a.name, a.hash, false)
+		case "PS":
+			s, v = rsaAlgorithm(a.name, a.hash, true)
+		case "ES":
+			s, v = ecdsaAlgorithm(a.name, a.hash, a.curve)
+		default:
+			s, v = eddsaAlgorithm(a.name)
+		}
+		RegisterAlgorithm(a.name, s, v)
+	}
+}
+
+// RegisterAlgorithm 注册或替换算法
+func RegisterAlgorithm(alg string, newSigner SignerConstructor, newVerifier VerifierConstructor) {
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+	algorithms[alg] = algorithm{newSigner: newSigner, newVerifier: newVerifier}
+}
+
+// Algorithms 返回已注册的算法名称
+func Algorithms() []string {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupAlgorithm(alg string) (algorithm, error) {
+	if alg == "" || alg == "none" {
+		return algorithm{}, ErrAlgorithmNone
+	}
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	a, ok := algorithms[alg]
+	if !ok {
+		return algorithm{}, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, alg)
+	}
+	return a, nil
+}
+
+// NewSigner 创建签名器，HS为[]byte，RS/PS为*rsa.PrivateKey，ES为*ecdsa.PrivateKey，EdDSA为ed25519.PrivateKey
+func NewSigner(alg string, key interface{}) (Signer, error) {
+	a, err := lookupAlgorithm(alg)
+	if err != nil {
+		return nil, err
+	}
+	return a.newSigner(key)
+}
+
+// NewVerifier 创建校验器，HS为[]byte，其他算法为对应的公钥或私钥
+func NewVerifier(alg string, key interface{}) (Verifier, error) {
+	a, err := lookupAlgorithm(alg)
+	if err != nil {
+		return nil, err
+	}
+	return a.newVerifier(key)
+}
+
+// Sign 生成JWS紧凑序列化，header的alg由signer决定
+func Sign(signer Signer, header codec.Header, payload []byte) ([]byte, error) {
+	header.Algorithm = signer.Algorithm()
+	hb, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	enc := base64.RawURLEncoding
+	token := make([]byte, enc.EncodedLen(len(hb))+1+enc.EncodedLen(len(payload)))
+	enc.Encode(token, hb)
+	n := enc.EncodedLen(len(hb))
+	token[n] = '.'
+	enc.Encode(token[n+1:], payload)
+	sig, err := signer.Sign(token)
+	if err != nil {
+		return nil, err
+	}
+	token = append(token, '.')
+	return append(token, enc.EncodeToString(sig)...), nil
+}
+
+// Verify 校验JWS紧凑序列化并返回header和payload，
+// 只接受verifiers中的算法，同一算法有多个校验器时(密钥轮换)依次尝试
+func Verify(token []byte, verifiers ...Verifier) (*codec.Header, json.RawMessage, error) {
+	header, signingInput, payload, sig, err := splitCompact(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.Algorithm == "" || header.Algorithm == "none" {
+		return nil, nil, ErrAlgorithmNone
+	}
+	err = ErrAlgorithmNotAllowed
+	for _, v := range verifiers {
+		if v.Algorithm() != header.Algorithm {
+			continue
+		}
+		if err = v.Verify(signingInput, sig); err == nil {
+			return header, payload, nil
+		}
+	}
+	return nil, nil, err
+}
+
+// splitCompact 拆分 header.payload.signature 并解码
+func splitCompact(token []byte) (header *codec.Header, signingInput, payload, sig []byte, err error) {
+	sep1 := bytes.IndexByte(token, '.')
+	if sep1 < 0 {
+		return nil, nil, nil, nil, codec.ErrMalformed
+	}
+	sep2 := bytes.IndexByte(token[sep1+1:], '.')
+	if sep2 < 0 {
+		return nil, nil, nil, nil, codec.ErrMalformed
+	}
+	sep2 += sep1 + 1
+	if bytes.IndexByte(token[sep2+1:], '.') >= 0 {
+		return nil, nil, nil, nil, codec.ErrMalformed
+	}
+	hb, err := base64.RawURLEncoding.DecodeString(string(token[:sep1]))
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	header = &codec.Header{}
+	if err = json.Unmarshal(hb, header); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if payload, err = base64.RawURLEncoding.DecodeString(string(token[sep1+1 : sep2])); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if sig, err = base64.RawURLEncoding.DecodeString(string(token[sep2+1:])); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return header, token[:sep2], payload, sig, nil
+}
+
+type hmacSigner struct {
+	alg     string
+	newHash func() hash.Hash
+	key     []byte
+}
+
+func (h *hmacSigner) Algorithm() string {
+	return h.alg
+}
+
+func (h *hmacSigner) Sign(signingInput []byte) ([]byte, error) {
+	m := hmac.New(h.newHash, h.key)
+	m.Write(signingInput)
+	return m.Sum(nil), nil
+}
+
+func (h *hmacSigner) Verify(signingInput, signature []byte) error {
+	sig, _ := h.Sign(signingInput) // nolint
+	if !hmac.Equal(sig, signature) {
+		return ErrHmacVerification
+	}
+	return nil
+}
+
+func hmacAlgorithm(alg string, newHash func() hash.Hash) (SignerConstructor, VerifierConstructor) {
+	size := newHash().Size()
+	newHmac := func(key interface{}) (*hmacSigner, error) {
+		k, ok := key.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s requires []byte", ErrInvalidKey, alg)
+		}
+		if len(k) < size {
+			return nil, ErrHmacKeyTooShort
+		}
+		return &hmacSigner{alg: alg, newHash: newHash, key: k}, nil
+	}
+	return func(key interface{}) (Signer, error) {
+			return newHmac(key)
+		}, func(key interface{}) (Verifier, error) {
+			return newHmac(key)
+		}
+}
+
+type rsaSigner struct {
+	alg  string
+	hash crypto.Hash
+	pss  bool
+	priv *rsa.PrivateKey
+	pub  *rsa.PublicKey
+}
+
+func (r *rsaSigner) Algorithm() string {
+	return r.alg
+}
+
+func (r *rsaSigner) Sign(signingInput []byte) ([]byte, error) {
+	h := r.hash.New()
+	h.Write(signingInput)
+	if r.pss {
+		return rsa.SignPSS(rand.Reader, r.priv, r.hash, h.Sum(nil), &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+			Hash:       r.hash,
+		})
+	}
+	return rsa.SignPKCS1v15(rand.Reader, r.priv, r.hash, h.Sum(nil))
+}
+
+func (r *rsaSigner) Verify(signingInput, signature []byte) error {
+	h := r.hash.New()
+	h.Write(signingInput)
+	var err error
+	if r.pss {
+		err = rsa.VerifyPSS(r.pub, r.hash, h.Sum(nil), signature, &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthAuto,
+			Hash:       r.hash,
+		})
+	} else {
+		err = rsa.VerifyPKCS1v15(r.pub, r.hash, h.Sum(nil), signature)
+	}
+	if err != nil {
+		return ErrRSAVerification
+	}
+	return nil
+}
+
+func rsaAlgorithm(alg string, hash crypto.Hash, pss bool) (SignerConstructor, VerifierConstructor) {
+	return func(key interface{}) (Signer, error) {
+			priv, ok := key.(*rsa.PrivateKey)
+			if !ok || priv == nil {
+				return nil, fmt.Errorf("%w: %s requires *rsa.PrivateKey", ErrInvalidKey, alg)
+			}
+			if priv.N.BitLen() < 2048 {
+				return nil, ErrRSAKeyTooShort
+			}
+			return &rsaSigner{alg: alg, hash: hash, pss: pss, priv: priv, pub: &priv.PublicKey}, nil
+		}, func(key interface{}) (Verifier, error) {
+			var pub *rsa.PublicKey
+			switch k := key.(type) {
+			case *rsa.PublicKey:
+				pub = k
+			case *rsa.PrivateKey:
+				pub = &k.PublicKey
+			}
+			if pub == nil || pub.N == nil {
+				return nil, fmt.Errorf("%w: %s requires *rsa.PublicKey", ErrInvalidKey, alg)
+			}
+			if pub.N.BitLen() < 2048 {
+				return nil, ErrRSAKeyTooShort
+			}
+			return &rsaSigner{alg: alg, hash: hash, pss: pss, pub: pub}, nil
+		}
+}
+
+type ecdsaSigner struct {
+	alg  string
+	hash crypto.Hash
+	priv *ecdsa.PrivateKey
+	pub  *ecdsa.PublicKey
+}
+
+func (e *ecdsaSigner) Algorithm() string {
+	return e.alg
+}
+
+// Sign 签名为定长的 R||S，参考 RFC 7518 3.4
+func (e *ecdsaSigner) Sign(signingInput []byte) ([]byte, error) {
+	h := e.hash.New()
+	h.Write(signingInput)
+	r, s, err := ecdsa.Sign(rand.Reader, e.priv, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	size := byteSize(e.priv.Params().BitSize)
+	sig := make([]byte, size*2)
+	r.FillBytes(sig[:size])
+	s.FillBytes(sig[size:])
+	return sig, nil
+}
+
+func (e *ecdsaSigner) Verify(signingInput, signature []byte) error {
+	size := byteSize(e.pub.Params().BitSize)
+	if len(signature) != size*2 {
+		return ErrECDSAVerification
+	}
+	h := e.hash.New()
+	h.Write(signingInput)
+	r := new(big.Int).SetBytes(signature[:size])
+	s := new(big.Int).SetBytes(signature[size:])
+	if !ecdsa.Verify(e.pub, h.Sum(nil), r, s) {
+		return ErrECDSAVerification
+	}
+	return nil
+}
+
+func ecdsaAlgorithm(alg string, hash crypto.Hash, curve elliptic.Curve) (SignerConstructor, VerifierConstructor) {
+	return func(key interface{}) (Signer, error) {
+			priv, ok := key.(*ecdsa.PrivateKey)
+			if !ok || priv == nil || priv.Curve != curve {
+				return nil, fmt.Errorf("%w: %s requires *ecdsa.PrivateKey on %s", ErrInvalidKey, alg, curve.Params().Name)
+			}
+			return &ecdsaSigner{alg: alg, hash: hash, priv: priv, pub: &priv.PublicKey}, nil
+		}, func(key interface{}) (Verifier, error) {
+			var pub *ecdsa.PublicKey
+			switch k := key.(type) {
+			case *ecdsa.PublicKey:
+				pub = k
+			case *ecdsa.PrivateKey:
+				pub = &k.PublicKey
+			}
+			if pub == nil || pub.Curve != curve {
+				return nil, fmt.Errorf("%w: %s requires *ecdsa.PublicKey on %s", ErrInvalidKey, alg, curve.Params().Name)
+			}
+			return &ecdsaSigner{alg: alg, hash: hash, pub: pub}, nil
+		}
+}
+
+type eddsaSigner struct {
+	alg  string
+	priv ed25519.PrivateKey
+	pub  ed25519.PublicKey
+}
+
+func (e *eddsaSigner) Algorithm() string {
+	return e.alg
+}
+
+func (e *eddsaSigner) Sign(signingInput []byte) ([]byte, error) {
+	return ed25519.Sign(e.priv, signingInput), nil
+}
+
+func (e *eddsaSigner) Verify(signingInput, signature []byte) error {
+	if !ed25519.Verify(e.pub, signingInput, signature) {
+		return ErrEdDSAVerification
+	}
+	return nil
+}
+
+func eddsaAlgorithm(alg string) (SignerConstructor, VerifierConstructor) {
+	return func(key interface{}) (Signer, error) {
+			priv, ok := key.(ed25519.PrivateKey)
+			if !ok || len(priv) != ed25519.PrivateKeySize {
+				return nil, fmt.Errorf("%w: %s requires ed25519.PrivateKey", ErrInvalidKey, alg)
+			}
+			return &eddsaSigner{alg: alg, priv: priv, pub: priv.Public().(ed25519.PublicKey)}, nil
+		}, func(key interface{}) (Verifier, error) {
+			var pub ed25519.PublicKey
+			switch k := key.(type) {
+			case ed25519.PublicKey:
+				pub = k
+			case ed25519.PrivateKey:
+				if len(k) == ed25519.PrivateKeySize {
+					pub = k.Public().(ed25519.PublicKey)
+				}
+			}
+			if len(pub) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("%w: %s requires ed25519.PublicKey", ErrInvalidKey, alg)
+			}
+			return &eddsaSigner{alg: alg, pub: pub}, nil
+		}
+}
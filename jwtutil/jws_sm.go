@@ -0,0 +1,85 @@
+package jwtutil
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+)
+
+/*
+国密算法，参考 GM/T 0003、GM/T 0004:
+1. SM2SM3 使用SM2签名，SM3摘要和默认用户ID "1234567812345678"，签名为定长的 R||S
+2. HMAC-SM3 使用SM3的HMAC，密钥不能短于32字节
+*/
+
+// ErrSM2Verification is the error for an invalid SM2 signature.
+var ErrSM2Verification = errors.New("jwt: SM2 verification failed")
+
+// sm2SignatureSize SM2曲线的 R||S 长度
+const sm2SignatureSize = 64
+
+func init() {
+	s, v := hmacAlgorithm("HMAC-SM3", sm3.New)
+	RegisterAlgorithm("HMAC-SM3", s, v)
+	s, v = sm2Algorithm("SM2SM3")
+	RegisterAlgorithm("SM2SM3", s, v)
+}
+
+type sm2Signer struct {
+	alg  string
+	priv *sm2.PrivateKey
+	pub  *sm2.PublicKey
+}
+
+func (e *sm2Signer) Algorithm() string {
+	return e.alg
+}
+
+func (e *sm2Signer) Sign(signingInput []byte) ([]byte, error) {
+	r, s, err := sm2.Sm2Sign(e.priv, signingInput, nil, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, sm2SignatureSize)
+	r.FillBytes(sig[:sm2SignatureSize/2])
+	s.FillBytes(sig[sm2SignatureSize/2:])
+	return sig, nil
+}
+
+func (e *sm2Signer) Verify(signingInput, signature []byte) error {
+	if len(signature) != sm2SignatureSize {
+		return ErrSM2Verification
+	}
+	r := new(big.Int).SetBytes(signature[:sm2SignatureSize/2])
+	s := new(big.Int).SetBytes(signature[sm2SignatureSize/2:])
+	if !sm2.Sm2Verify(e.pub, signingInput, nil, r, s) {
+		return ErrSM2Verification
+	}
+	return nil
+}
+
+func sm2Algorithm(alg string) (SignerConstructor, VerifierConstructor) {
+	return func(key interface{}) (Signer, error) {
+			priv, ok := key.(*sm2.PrivateKey)
+			if !ok || priv == nil {
+				return nil, fmt.Errorf("%w: %s requires *sm2.PrivateKey", ErrInvalidKey, alg)
+			}
+			return &sm2Signer{alg: alg, priv: priv, pub: &priv.PublicKey}, nil
+		}, func(key interface{}) (Verifier, error) {
+			var pub *sm2.PublicKey
+			switch k := key.(type) {
+			case *sm2.PublicKey:
+				pub = k
+			case *sm2.PrivateKey:
+				pub = &k.PublicKey
+			}
+			if pub == nil {
+				return nil, fmt.Errorf("%w: %s requires *sm2.PublicKey", ErrInvalidKey, alg)
+			}
+			return &sm2Signer{alg: alg, pub: pub}, nil
+		}
+}
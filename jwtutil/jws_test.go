@@ -0,0 +1,284 @@
+package jwtutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/gorpher/gone/codec"
+	"github.com/tjfoc/gmsm/sm2"
+	x509sm "github.com/tjfoc/gmsm/x509"
+)
+
+func b64(t *testing.T, s string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// RFC 7515 A.1
+func TestVerifyRFC7515HS256(t *testing.T) {
+	key := b64(t, "AyM1SysPpbyDfgZld3umj1qzKObwVMkoqQ-EstJQLr_T-1qS0gZH75aKtMN3Yj0iPS4hcgUuTwjAzZr1Z9CAow")
+	token := "eyJ0eXAiOiJKV1QiLA0KICJhbGciOiJIUzI1NiJ9." +
+		"eyJpc3MiOiJqb2UiLA0KICJleHAiOjEzMDA4MTkzODAsDQogImh0dHA6Ly9leGFtcGxlLmNvbS9pc19yb290Ijp0cnVlfQ." +
+		"dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	v, err := NewVerifier("HS256", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, payload, err := Verify([]byte(token), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Type != "JWT" || !strings.Contains(string(payload), `"iss":"joe"`) {
+		t.Fatalf("unexpected header %+v payload %s", header, payload)
+	}
+	s, err := NewSigner("HS256", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := strings.LastIndexByte(token, '.')
+	sig, _ := s.Sign([]byte(token[:i]))
+	if base64.RawURLEncoding.EncodeToString(sig) != token[i+1:] {
+		t.Fatal("HS256 signature does not match RFC 7515 A.1")
+	}
+}
+
+// RFC 7515 A.3
+func TestVerifyRFC7515ES256(t *testing.T) {
+	pub := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(b64(t, "f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU")),
+		Y:     new(big.Int).SetBytes(b64(t, "x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0")),
+	}
+	token := "eyJhbGciOiJFUzI1NiJ9." +
+		"eyJpc3MiOiJqb2UiLA0KICJleHAiOjEzMDA4MTkzODAsDQogImh0dHA6Ly9leGFtcGxlLmNvbS9pc19yb290Ijp0cnVlfQ." +
+		"DtEhU3ljbEg8L38VWAfUAqOyKAM6-Xx-F4GawxaepmXFCgfTjDxw5djxLa8ISlSApmWQxfKTUJqPP3-Kg6NU1Q"
+	v, err := NewVerifier("ES256", pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = Verify([]byte(token), v); err != nil {
+		t.Fatal(err)
+	}
+	priv := &ecdsa.PrivateKey{PublicKey: *pub, D: new(big.Int).SetBytes(b64(t, "jpsQnnGQmL-YBIffH1136cspYG6-0iY7X1fCE9-E9LI"))}
+	s, err := NewSigner("ES256", priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := Sign(s, codec.Header{}, []byte(`{"iss":"joe"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = Verify(signed, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// RFC 8037 A.4
+func TestSignRFC8037EdDSA(t *testing.T) {
+	priv := ed25519.NewKeyFromSeed(b64(t, "nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A"))
+	s, err := NewSigner("EdDSA", priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := Sign(s, codec.Header{}, []byte("Example of Ed25519 signing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "eyJhbGciOiJFZERTQSJ9.RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc." +
+		"hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg"
+	if string(token) != want {
+		t.Fatalf("got %s", token)
+	}
+	v, err := NewVerifier("EdDSA", ed25519.PublicKey(b64(t, "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = Verify(token, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignVerifyAllAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKeys := map[string]*ecdsa.PrivateKey{}
+	for alg, curve := range map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()} {
+		if ecKeys[alg], err = ecdsa.GenerateKey(curve, rand.Reader); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smKey, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacKey := make([]byte, 64)
+	rand.Read(hmacKey) // nolint
+	for _, alg := range Algorithms() {
+		var priv, pub interface{}
+		switch alg[:2] {
+		case "HS", "HM":
+			priv, pub = hmacKey, hmacKey
+		case "SM":
+			priv, pub = smKey, &smKey.PublicKey
+		case "RS", "PS":
+			priv, pub = rsaKey, &rsaKey.PublicKey
+		case "ES":
+			priv, pub = ecKeys[alg], &ecKeys[alg].PublicKey
+		default:
+			priv, pub = edKey, edKey.Public()
+		}
+		s, err := NewSigner(alg, priv)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		v, err := NewVerifier(alg, pub)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		token, err := Sign(s, codec.Header{Type: "JWT", KeyID: "k1"}, []byte(`{"sub":"1"}`))
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		header, payload, err := Verify(token, v)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if header.Algorithm != alg || header.KeyID != "k1" || string(payload) != `{"sub":"1"}` {
+			t.Fatalf("%s: unexpected header %+v payload %s", alg, header, payload)
+		}
+		tampered := append([]byte(nil), token...)
+		tampered[len(tampered)-2] ^= 1
+		if _, _, err = Verify(tampered, v); err == nil {
+			t.Fatalf("%s: tampered token verified", alg)
+		}
+	}
+}
+
+func TestVerifyRejectsNoneAndUnpinned(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifier("RS256", &rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	none := "eyJhbGciOiJub25lIn0.eyJzdWIiOiIxIn0."
+	if _, _, err = Verify([]byte(none), v); !errors.Is(err, ErrAlgorithmNone) {
+		t.Fatalf("alg none: %v", err)
+	}
+	if _, err = NewVerifier("none", nil); !errors.Is(err, ErrAlgorithmNone) {
+		t.Fatalf("NewVerifier none: %v", err)
+	}
+
+	// 用RSA公钥作为HMAC密钥伪造HS256令牌
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forger, err := NewSigner("HS256", der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := Sign(forger, codec.Header{}, []byte(`{"sub":"admin"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = Verify(forged, v); !errors.Is(err, ErrAlgorithmNotAllowed) {
+		t.Fatalf("alg confusion: %v", err)
+	}
+	if _, err = NewVerifier("HS256", &rsaKey.PublicKey); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("HS256 with rsa key: %v", err)
+	}
+}
+
+func TestNewSignerKeyChecks(t *testing.T) {
+	if _, err := NewSigner("HS512", []byte("short")); !errors.Is(err, ErrHmacKeyTooShort) {
+		t.Fatalf("short hmac key: %v", err)
+	}
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewSigner("HMAC-SM3", make([]byte, 16)); !errors.Is(err, ErrHmacKeyTooShort) {
+		t.Fatalf("short hmac-sm3 key: %v", err)
+	}
+	if _, err = NewSigner("RS256", small); !errors.Is(err, ErrRSAKeyTooShort) {
+		t.Fatalf("small rsa key: %v", err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewSigner("ES384", p256); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("curve mismatch: %v", err)
+	}
+	if _, err = NewSigner("XS256", p256); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Fatalf("unknown alg: %v", err)
+	}
+}
+
+func TestVerifyJwtSignAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, alg := range []string{"RS384", "PS256", "PS512"} {
+		s, err := NewSigner(alg, rsaKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := Sign(s, codec.Header{}, []byte(`{"sub":"1"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = VerifyJwtSign(token, der); err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+	}
+}
+
+func TestVerifySM2SM3FromCodec(t *testing.T) {
+	priv, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPEM, err := x509sm.WritePrivateKeyToPem(priv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := codec.NewJwtCodec("SM2SM3").Encode(privPEM, []byte(`{"sub":"1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifier("SM2SM3", &priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = Verify(token, v); err != nil {
+		t.Fatal(err)
+	}
+}
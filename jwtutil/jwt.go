@@ -1,20 +1,16 @@
 package jwtutil
 
 import (
-	"bytes"
 	"crypto"
 	"crypto/ecdsa"
-	"crypto/hmac"
 	"crypto/rsa"
 	"crypto/x509"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/gorpher/gone/codec"
 	"github.com/gorpher/gone/core"
-	"hash"
 	"math/big"
+	"strings"
 )
 
 var (
@@ -33,6 +29,9 @@ var (
 	ErrHmacVerification = errors.New("jwt: Hmac verification failed")
 )
 
+// JwtPayload 固定字段的声明
+//
+// Deprecated: 时间戳为int且aud只支持字符串，使用Parse和嵌入codec.Payload的自定义声明
 type JwtPayload struct {
 	JTI       string        `json:"jti"`
 	IAT       int           `json:"iat"`
@@ -48,23 +47,38 @@ type JwtPayload struct {
 	Email     string        `json:"email"`
 }
 
+// JWK JSON Web Key，参考 RFC 7517、RFC 7518 6、RFC 8037 2
 type JWK struct {
-	KTY       string `json:"kty"`
-	KID       string `json:"kid"`
-	Use       string `json:"use"`
-	Algorithm string `json:"alg"`
-	N         string `json:"n"`
-	E         string `json:"e"`
+	KTY       string   `json:"kty"`
+	KID       string   `json:"kid,omitempty"`
+	Use       string   `json:"use,omitempty"`
+	KeyOps    []string `json:"key_ops,omitempty"`
+	Algorithm string   `json:"alg,omitempty"`
+	// RSA
+	N  string `json:"n,omitempty"`
+	E  string `json:"e,omitempty"`
+	P  string `json:"p,omitempty"`
+	Q  string `json:"q,omitempty"`
+	DP string `json:"dp,omitempty"`
+	DQ string `json:"dq,omitempty"`
+	QI string `json:"qi,omitempty"`
+	// EC、OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	// RSA、EC、OKP的私钥
+	D string `json:"d,omitempty"`
+	// oct
+	K string `json:"k,omitempty"`
 }
 
+// RsaPublicKeyToJWK 将RSA公钥转换为JWK，kid为RFC 7638指纹
 func RsaPublicKeyToJWK(pub *rsa.PublicKey) ([]byte, error) {
-	return json.Marshal(JWK{
-		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
-		N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
-		KTY:       "RSA",
-		Algorithm: "RS256",
-		KID:       "0",
-	})
+	jwk, err := NewJWK(pub)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jwk)
 }
 
 func ParseRsaPublicKeyByJWK(jsonBytes []byte) (publicKey *rsa.PublicKey, err error) {
@@ -95,343 +109,134 @@ func ParseRsaPublicKeyByJWK(jsonBytes []byte) (publicKey *rsa.PublicKey, err err
 	}, nil
 }
 
-func jwtCryptoByHash(alg string) (func() hash.Hash, error) {
-	switch alg {
-	case "RS256":
-		return crypto.SHA256.New, nil
-	case "HS384":
-		return crypto.SHA384.New, nil
-	case "RS512":
-		return crypto.SHA512.New, nil
-	case "PS256":
-		return crypto.SHA512.New, nil
-	case "PS384":
-		return crypto.SHA512.New, nil
-	case "PS512":
-		return crypto.SHA512.New, nil
-	case "ES256":
-		return crypto.SHA512.New, nil
-	case "ES384":
-		return crypto.SHA512.New, nil
-	case "ES512":
-		return crypto.SHA512.New, nil
-	default:
-		return nil, fmt.Errorf("the %s algorithm is not supported", alg)
+// jwtHash 旧接口使用的算法摘要，EdDSA不需要预先摘要
+func jwtHash(alg string) (crypto.Hash, error) {
+	if alg == "EdDSA" {
+		return 0, nil
+	}
+	if len(alg) == 5 {
+		switch alg[2:] {
+		case "256":
+			return crypto.SHA256, nil
+		case "384":
+			return crypto.SHA384, nil
+		case "512":
+			return crypto.SHA512, nil
+		}
 	}
+	return 0, fmt.Errorf("the %s algorithm is not supported", alg)
 }
 
-func VerifyJwtSignByRsa(ciphertext []byte, publicKey *rsa.PublicKey) (json.RawMessage, error) {
-	sep1 := bytes.IndexByte(ciphertext, '.')
-	if sep1 < 0 {
-		return nil, codec.ErrMalformed
-	}
-	cbytes := ciphertext[sep1+1:]
-	sep2 := bytes.IndexByte(cbytes, '.')
-	if sep2 < 0 {
-		return nil, codec.ErrMalformed
-	}
-	sign := cbytes[sep2+1:]
-	sep3 := bytes.IndexByte(cbytes, '.')
-	if sep3 < 0 {
-		return nil, codec.ErrMalformed
-	}
-	hb, err := base64.RawURLEncoding.DecodeString(string(ciphertext[:sep1]))
+// verifyCompact 旧接口按令牌header中的alg选择校验器，不检查密钥长度
+func verifyCompact(ciphertext []byte, newVerifier func(alg string, hash crypto.Hash) (Verifier, error)) (json.RawMessage, error) {
+	header, signingInput, payload, sig, err := splitCompact(ciphertext)
 	if err != nil {
 		return nil, err
 	}
-	var header codec.Header
-	err = json.Unmarshal(hb, &header)
-	if err != nil {
-		return nil, err
+	if header.Algorithm == "" || header.Algorithm == "none" {
+		return nil, ErrAlgorithmNone
 	}
-	hs, err := jwtCryptoByHash(header.Algorithm)
+	hash, err := jwtHash(header.Algorithm)
 	if err != nil {
 		return nil, err
 	}
-	signBytes, err := base64.RawURLEncoding.DecodeString(string(sign))
+	v, err := newVerifier(header.Algorithm, hash)
 	if err != nil {
 		return nil, err
 	}
-	h := hs()
-	p := ciphertext[:sep1+1+sep2]
-	h.Write(p)
-	if header.Algorithm == "RS256" {
-		err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, h.Sum(nil), signBytes)
-		if err != nil {
-			return nil, err
-		}
+	if err = v.Verify(signingInput, sig); err != nil {
+		return nil, err
 	}
-	if header.Algorithm == "RS384" {
-		err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA384, h.Sum(nil), signBytes)
-		if err != nil {
-			return nil, err
+	return payload, nil
+}
+
+func legacyRsaVerifier(publicKey *rsa.PublicKey) func(alg string, hash crypto.Hash) (Verifier, error) {
+	return func(alg string, hash crypto.Hash) (Verifier, error) {
+		if publicKey == nil {
+			return nil, ErrRSANilPubKey
 		}
-	}
-	if header.Algorithm == "RS512" {
-		err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA512, h.Sum(nil), signBytes)
-		if err != nil {
-			return nil, err
+		if !strings.HasPrefix(alg, "RS") && !strings.HasPrefix(alg, "PS") {
+			return nil, fmt.Errorf("the %s algorithm is not supported", alg)
 		}
+		return &rsaSigner{alg: alg, hash: hash, pss: strings.HasPrefix(alg, "PS"), pub: publicKey}, nil
 	}
-	if header.Algorithm == "PS256" {
-		err := rsa.VerifyPSS(publicKey, crypto.SHA256, h.Sum(nil), signBytes, &rsa.PSSOptions{
-			SaltLength: rsa.PSSSaltLengthAuto,
-			Hash:       crypto.SHA256,
-		})
-		if err != nil {
-			return nil, err
+}
+
+func legacyEcdsaVerifier(publicKey *ecdsa.PublicKey) func(alg string, hash crypto.Hash) (Verifier, error) {
+	return func(alg string, hash crypto.Hash) (Verifier, error) {
+		if publicKey == nil {
+			return nil, ErrECDSANilPubKey
 		}
-	}
-	if header.Algorithm == "PS384" {
-		err := rsa.VerifyPSS(publicKey, crypto.SHA384, h.Sum(nil), signBytes, &rsa.PSSOptions{
-			SaltLength: rsa.PSSSaltLengthAuto,
-			Hash:       crypto.SHA384,
-		})
-		if err != nil {
-			return nil, err
+		if !strings.HasPrefix(alg, "ES") {
+			return nil, fmt.Errorf("the %s algorithm is not supported", alg)
 		}
+		return &ecdsaSigner{alg: alg, hash: hash, pub: publicKey}, nil
 	}
-	if header.Algorithm == "PS512" {
-		err := rsa.VerifyPSS(publicKey, crypto.SHA512, h.Sum(nil), signBytes, &rsa.PSSOptions{
-			SaltLength: rsa.PSSSaltLengthAuto,
-			Hash:       crypto.SHA512,
-		})
-		if err != nil {
-			return nil, err
+}
+
+func legacyHmacVerifier(key []byte) func(alg string, hash crypto.Hash) (Verifier, error) {
+	return func(alg string, hash crypto.Hash) (Verifier, error) {
+		if !strings.HasPrefix(alg, "HS") {
+			return nil, fmt.Errorf("the %s algorithm is not supported", alg)
 		}
+		return &hmacSigner{alg: alg, newHash: hash.New, key: key}, nil
 	}
-	return base64.RawURLEncoding.DecodeString(string(cbytes[:sep2]))
 }
 
+// VerifyJwtSignByRsa 校验RS/PS算法签名的令牌
+func VerifyJwtSignByRsa(ciphertext []byte, publicKey *rsa.PublicKey) (json.RawMessage, error) {
+	return verifyCompact(ciphertext, legacyRsaVerifier(publicKey))
+}
+
+// VerifyJwtSignByEcdsa 校验ES算法签名的令牌
 func VerifyJwtSignByEcdsa(ciphertext []byte, publicKey *ecdsa.PublicKey) (json.RawMessage, error) {
-	var body json.RawMessage
-	sep1 := bytes.IndexByte(ciphertext, '.')
-	if sep1 < 0 {
-		return nil, codec.ErrMalformed
-	}
-	cbytes := ciphertext[sep1+1:]
-	sep2 := bytes.IndexByte(cbytes, '.')
-	if sep2 < 0 {
-		return nil, codec.ErrMalformed
-	}
-	sign := cbytes[sep2+1:]
-	sep3 := bytes.IndexByte(cbytes, '.')
-	if sep3 < 0 {
-		return nil, codec.ErrMalformed
-	}
-	hb, err := base64.RawURLEncoding.DecodeString(string(ciphertext[:sep1]))
-	if err != nil {
-		return nil, err
-	}
-	var header codec.Header
-	err = json.Unmarshal(hb, &header)
-	if err != nil {
-		return nil, err
-	}
-	hs, err := jwtCryptoByHash(header.Algorithm)
-	if err != nil {
-		return nil, err
-	}
-	signBytes, err := base64.RawURLEncoding.DecodeString(string(sign))
-	if err != nil {
-		return nil, err
-	}
-	h := hs()
-	p := ciphertext[:sep1+1+sep2]
-	h.Write(p)
-	byteSize := byteSize(publicKey.Params().BitSize)
-	if len(signBytes) != byteSize*2 {
-		return nil, ErrECDSAVerification
-	}
-	r := big.NewInt(0).SetBytes(signBytes[:byteSize])
-	s := big.NewInt(0).SetBytes(signBytes[byteSize:])
-	if !ecdsa.Verify(publicKey, h.Sum(nil), r, s) {
-		return nil, ErrECDSAVerification
-	}
-	body, err = base64.RawURLEncoding.DecodeString(string(cbytes[:sep2]))
-	if err != nil {
-		return nil, err
-	}
-	return body, nil
+	return verifyCompact(ciphertext, legacyEcdsaVerifier(publicKey))
 }
 
+// VerifyJwtSignByHmacHash 校验HS算法签名的令牌
 func VerifyJwtSignByHmacHash(ciphertext, key []byte) (json.RawMessage, error) {
-	sep1 := bytes.IndexByte(ciphertext, '.')
-	if sep1 < 0 {
-		return nil, codec.ErrMalformed
-	}
-	cbytes := ciphertext[sep1+1:]
-	sep2 := bytes.IndexByte(cbytes, '.')
-	if sep2 < 0 {
-		return nil, codec.ErrMalformed
-	}
-
-	sig := cbytes[sep2+1:]
-	sep3 := bytes.IndexByte(cbytes, '.')
-	if sep3 < 0 {
-		return nil, codec.ErrMalformed
-	}
-	hb, err := base64.RawURLEncoding.DecodeString(string(ciphertext[:sep1]))
-	if err != nil {
-		return nil, err
-	}
-
-	var header codec.Header
-	err = json.Unmarshal(hb, &header)
-	if err != nil {
-		return nil, err
-	}
-
-	hs, err := core.JwtHS(header.Algorithm)
-	if err != nil {
-		return nil, err
-	}
-	h := hs(key)
-	p := ciphertext[:sep1+1+sep2]
-	h.Write(p)
-
-	sha256 := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
-	if sha256 != string(sig) {
-		return nil, errors.New("invalid jwt token")
-	}
-	return base64.RawURLEncoding.DecodeString(string(cbytes[:sep2]))
+	return verifyCompact(ciphertext, legacyHmacVerifier(key))
 }
 
-// VerifyJwtSign verify jwt sign text , key is hmac key or rsa/ecdsa public key
+// VerifyJwtSign verify jwt sign text , key is hmac key or rsa/ecdsa/ed25519 public key (PKCS1 or PKIX DER).
+// 算法取自令牌header，key能解析为公钥时拒绝HS算法，避免用公开的公钥伪造HMAC签名.
+//
+// Deprecated: 使用Verify并通过NewVerifier固定允许的算法和密钥.
 func VerifyJwtSign(ciphertext, key []byte) (json.RawMessage, error) {
-	sep1 := bytes.IndexByte(ciphertext, '.')
-	if sep1 < 0 {
-		return nil, codec.ErrMalformed
-	}
-	cbytes := ciphertext[sep1+1:]
-	sep2 := bytes.IndexByte(cbytes, '.')
-	if sep2 < 0 {
-		return nil, codec.ErrMalformed
-	}
-	sign := cbytes[sep2+1:]
-	sep3 := bytes.IndexByte(cbytes, '.')
-	if sep3 < 0 {
-		return nil, codec.ErrMalformed
-	}
-	hb, err := base64.RawURLEncoding.DecodeString(string(ciphertext[:sep1]))
-	if err != nil {
-		return nil, err
-	}
-	var header codec.Header
-	err = json.Unmarshal(hb, &header)
-	if err != nil {
-		return nil, err
-	}
-	signBytes, err := base64.RawURLEncoding.DecodeString(string(sign))
-	if err != nil {
-		return nil, err
-	}
-	if len(header.Algorithm) < 5 {
-		return nil, fmt.Errorf("the %s algorithm is not supported", header.Algorithm)
-	}
-	alg := header.Algorithm[:2]
-	size := header.Algorithm[2:]
-	if !(alg == "HS" || alg == "RS" || alg == "ES") || !(size == "256" || size == "284" || size == "512") {
-		return nil, fmt.Errorf("the %s algorithm is not supported", header.Algorithm)
-	}
-
-	var h hash.Hash
-	var cryptoHash crypto.Hash
-	if size == "256" {
-		if alg == "HS" {
-			h = hmac.New(crypto.SHA256.New, key)
-		} else {
-			h = crypto.SHA256.New()
-		}
-		cryptoHash = crypto.SHA256
-	}
-	if size == "384" {
-		if alg == "HS" {
-			h = hmac.New(crypto.SHA384.New, key)
-		} else {
-			h = crypto.SHA384.New()
-		}
-		cryptoHash = crypto.SHA384
-	}
-	if size == "512" {
-		if alg == "HS" {
-			h = hmac.New(crypto.SHA512.New, key)
-		} else {
-			h = crypto.SHA512.New()
-		}
-		cryptoHash = crypto.SHA512
-	}
-
-	p := ciphertext[:sep1+1+sep2]
-	h.Write(p)
-
-	if alg == "RS" || alg == "PS" {
-		var (
-			rsaPublicKey *rsa.PublicKey
-			pbk          interface{}
-		)
-		rsaPublicKey, err = x509.ParsePKCS1PublicKey(key)
-		if err != nil {
-			pbk, err = x509.ParsePKIXPublicKey(key)
-			if err != nil {
-				return nil, err
+	return verifyCompact(ciphertext, func(alg string, hash crypto.Hash) (Verifier, error) {
+		switch {
+		case strings.HasPrefix(alg, "HS"):
+			if isPublicKeyDER(key) {
+				return nil, ErrInvalidKey
 			}
-			var ok bool
-			rsaPublicKey, ok = pbk.(*rsa.PublicKey)
-			if !ok {
-				return nil, ErrRSANilPubKey
+			return legacyHmacVerifier(key)(alg, hash)
+		case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+			rsaPublicKey, err := x509.ParsePKCS1PublicKey(key)
+			if err != nil {
+				pbk, err := x509.ParsePKIXPublicKey(key)
+				if err != nil {
+					return nil, err
+				}
+				rsaPublicKey, _ = pbk.(*rsa.PublicKey)
 			}
-		}
-		if alg == "RS" {
-			err = rsa.VerifyPKCS1v15(rsaPublicKey, cryptoHash, h.Sum(nil), signBytes)
+			return legacyRsaVerifier(rsaPublicKey)(alg, hash)
+		case strings.HasPrefix(alg, "ES"):
+			pbk, err := x509.ParsePKIXPublicKey(key)
 			if err != nil {
 				return nil, err
 			}
-		}
-
-		if alg == "PS" {
-			err = rsa.VerifyPSS(rsaPublicKey, cryptoHash, h.Sum(nil), signBytes, &rsa.PSSOptions{
-				SaltLength: rsa.PSSSaltLengthAuto,
-				Hash:       cryptoHash,
-			})
+			ecdsaPublicKey, _ := pbk.(*ecdsa.PublicKey)
+			return legacyEcdsaVerifier(ecdsaPublicKey)(alg, hash)
+		case alg == "EdDSA":
+			pbk, err := x509.ParsePKIXPublicKey(key)
 			if err != nil {
 				return nil, err
 			}
+			return NewVerifier(alg, pbk)
+		default:
+			return nil, fmt.Errorf("the %s algorithm is not supported", alg)
 		}
-	}
-
-	if alg == "ES" {
-		var (
-			ecdsaPublicKey *ecdsa.PublicKey
-			pbk            interface{}
-		)
-		pbk, err = x509.ParsePKIXPublicKey(key)
-		if err != nil {
-			return nil, err
-		}
-		var ok bool
-		ecdsaPublicKey, ok = pbk.(*ecdsa.PublicKey)
-		if !ok {
-			return nil, ErrECDSANilPubKey
-		}
-		byteSize := byteSize(ecdsaPublicKey.Params().BitSize)
-		if len(signBytes) != byteSize*2 {
-			return nil, ErrECDSAVerification
-		}
-		r := big.NewInt(0).SetBytes(signBytes[:byteSize])
-		s := big.NewInt(0).SetBytes(signBytes[byteSize:])
-		if !ecdsa.Verify(ecdsaPublicKey, h.Sum(nil), r, s) {
-			return nil, ErrECDSAVerification
-		}
-	}
-
-	if alg == "HS" {
-		sha256 := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
-		if sha256 != string(sign) {
-			return nil, ErrHmacVerification
-		}
-	}
-	return base64.RawURLEncoding.DecodeString(string(cbytes[:sep2]))
+	})
 }
 
 func byteSize(bitSize int) int {
@@ -441,3 +246,12 @@ func byteSize(bitSize int) int {
 	}
 	return byteSize
 }
+
+// isPublicKeyDER key是否为PKIX或PKCS1格式的公钥
+func isPublicKeyDER(key []byte) bool {
+	if _, err := x509.ParsePKIXPublicKey(key); err == nil {
+		return true
+	}
+	_, err := x509.ParsePKCS1PublicKey(key)
+	return err == nil
+}
@@ -182,4 +182,15 @@ Al8G7CqwoJOsW7Kddns=
 		t.Fatal(err)
 	}
 	t.Log(string(body))
+
+	// 公钥是公开的，不能作为HMAC密钥伪造令牌
+	for _, pub := range [][]byte{publicBytes, publicKeyBlock.Bytes} {
+		forged, err := codec2.NewJwtCodec("HS256").Encode(pub, []byte(`{"sub":"1234567890","admin":true}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = VerifyJwtSign(forged, pub); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("hmac token signed with public key accepted: %v", err)
+		}
+	}
 }
@@ -0,0 +1,87 @@
+package license
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+const (
+	prefixLicense    = "v2."
+	prefixRevocation = "r2."
+)
+
+// Issuer 签发授权码和吊销列表
+type Issuer struct {
+	key crypto.PrivateKey
+	alg string
+	now func() time.Time
+}
+
+// NewIssuer 支持 *rsa.PrivateKey、*ecdsa.PrivateKey、ed25519.PrivateKey、*sm2.PrivateKey
+func NewIssuer(key crypto.PrivateKey) (*Issuer, error) {
+	alg := signAlgorithm(key)
+	if alg == algUnknown {
+		return nil, ErrUnsupportedKey
+	}
+	return &Issuer{key: key, alg: alg, now: time.Now}, nil
+}
+
+// Issue 签发v2授权码，ID和签发时间为空时自动生成
+func (i *Issuer) Issue(l License) (string, error) {
+	l.Version = Version2
+	l.Algorithm = i.alg
+	if l.ID == "" {
+		l.ID = xid.New().String()
+	}
+	if l.IssuedAt == 0 {
+		l.IssuedAt = i.now().Unix()
+	}
+	return i.sign(prefixLicense, l)
+}
+
+// IssueRevocationList 签发吊销列表，签发时间用于拒绝回滚到旧列表
+func (i *Issuer) IssueRevocationList(ids ...string) (string, error) {
+	return i.sign(prefixRevocation, RevocationList{
+		Algorithm: i.alg,
+		IssuedAt:  i.now().Unix(),
+		IDs:       ids,
+	})
+}
+
+func (i *Issuer) sign(prefix string, v any) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	input := prefix + base64.RawURLEncoding.EncodeToString(payload)
+	sig, err := sign(i.key, []byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// splitSigned 拆分 "prefix" + payload + "." + sig，返回签名内容、授权信息和签名
+func splitSigned(prefix, code string) (input string, payload, sig []byte, err error) {
+	code = strings.TrimSpace(code)
+	if !strings.HasPrefix(code, prefix) {
+		return "", nil, nil, ErrMalformed
+	}
+	i := strings.LastIndexByte(code, '.')
+	if i <= len(prefix) {
+		return "", nil, nil, ErrMalformed
+	}
+	input = code[:i]
+	if payload, err = base64.RawURLEncoding.DecodeString(input[len(prefix):]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	if sig, err = base64.RawURLEncoding.DecodeString(code[i+1:]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return input, payload, sig, nil
+}
@@ -0,0 +1,133 @@
+package license
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gorpher/gone/osutil"
+)
+
+/*
+授权码格式:
+1. v2: "v2." + base64url(授权信息json) + "." + base64url(签名)，签名内容为 "v2." + base64url(授权信息json)，
+   支持RSA(PKCS1v15 SHA256)、SM2(SM3)、ECDSA(SHA256)、Ed25519
+2. v1(旧格式): base64url(授权信息) + "." + base64url(签名)，即cryptoutil.SignByRSA、SignBySM2生成的授权码，
+   使用RSA或SM2公钥时默认仍然可以验证，使用WithRejectLegacy关闭
+吊销列表使用相同的格式签名，前缀为 "r2."
+*/
+
+const (
+	Version1 = 1
+	Version2 = 2
+)
+
+var (
+	ErrMalformed       = errors.New("license: malformed license")
+	ErrSignature       = errors.New("license: invalid signature")
+	ErrAlgorithm       = errors.New("license: algorithm mismatch")
+	ErrUnsupportedKey  = errors.New("license: unsupported key type")
+	ErrLegacy          = errors.New("license: legacy license rejected")
+	ErrNotYetValid     = errors.New("license: license not yet valid")
+	ErrExpired         = errors.New("license: license expired")
+	ErrRevoked         = errors.New("license: license revoked")
+	ErrHardware        = errors.New("license: hardware not licensed")
+	ErrProduct         = errors.New("license: product mismatch")
+	ErrFeature         = errors.New("license: feature not licensed")
+	ErrSeatsExceeded   = errors.New("license: seats exceeded")
+	ErrRevocationStale = errors.New("license: revocation list older than current")
+)
+
+// License 授权信息，时间均为unix秒，0表示不限制
+type License struct {
+	Version   int      `json:"ver"`
+	Algorithm string   `json:"alg,omitempty"`
+	ID        string   `json:"id,omitempty"`
+	Product   string   `json:"product,omitempty"`
+	Licensee  string   `json:"licensee,omitempty"`
+	Features  []string `json:"features,omitempty"`
+	// Seats 授权数量，0表示不限制
+	Seats     int   `json:"seats,omitempty"`
+	IssuedAt  int64 `json:"iat,omitempty"`
+	NotBefore int64 `json:"nbf,omitempty"`
+	ExpiresAt int64 `json:"exp,omitempty"`
+	// Grace 过期后离线宽限的秒数
+	Grace int64 `json:"grace,omitempty"`
+	// Hardware 绑定的硬件ID，见HardwareID，为空不绑定
+	Hardware []string          `json:"hw,omitempty"`
+	Extra    map[string]string `json:"extra,omitempty"`
+
+	// Raw 签名的原始授权信息，旧格式的自定义字段从这里解析
+	Raw []byte `json:"-"`
+	// InGrace 验证时处于过期宽限期
+	InGrace bool `json:"-"`
+}
+
+// HasFeature 是否授权了功能
+func (l *License) HasFeature(feature string) bool {
+	for _, f := range l.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireFeature 未授权功能时返回ErrFeature
+func (l *License) RequireFeature(feature string) error {
+	if !l.HasFeature(feature) {
+		return ErrFeature
+	}
+	return nil
+}
+
+// CheckSeats 校验已使用的数量是否超出授权
+func (l *License) CheckSeats(used int) error {
+	if l.Seats > 0 && used > l.Seats {
+		return ErrSeatsExceeded
+	}
+	return nil
+}
+
+// checkTime 校验有效期，返回是否处于宽限期
+func (l *License) checkTime(now time.Time, grace time.Duration) (bool, error) {
+	t := now.Unix()
+	if l.NotBefore != 0 && t < l.NotBefore {
+		return false, ErrNotYetValid
+	}
+	if l.ExpiresAt == 0 || t <= l.ExpiresAt {
+		return false, nil
+	}
+	if l.Grace > int64(grace/time.Second) {
+		grace = time.Duration(l.Grace) * time.Second
+	}
+	if t <= l.ExpiresAt+int64(grace/time.Second) {
+		return true, nil
+	}
+	return false, ErrExpired
+}
+
+// HardwareID 根据MAC地址生成硬件ID，授权信息中不保存原始MAC地址
+func HardwareID(mac string) string {
+	if hw, err := net.ParseMAC(mac); err == nil {
+		mac = hw.String()
+	}
+	sum := sha256.Sum256([]byte("gone/license|" + strings.ToLower(mac)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// MachineHardwareIDs 返回本机所有启用网卡的硬件ID
+func MachineHardwareIDs() ([]string, error) {
+	macs, err := osutil.MacAddr()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(macs))
+	for _, mac := range macs {
+		ids = append(ids, HardwareID(mac))
+	}
+	return ids, nil
+}
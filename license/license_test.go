@@ -0,0 +1,225 @@
+package license
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	crypto2 "github.com/gorpher/gone/cryptoutil"
+	"github.com/tjfoc/gmsm/sm2"
+	x509sm "github.com/tjfoc/gmsm/x509"
+)
+
+func testKeys(t *testing.T) map[string][2]any {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smKey, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string][2]any{
+		AlgRS256:  {rsaKey, &rsaKey.PublicKey},
+		AlgES256:  {ecKey, &ecKey.PublicKey},
+		AlgEdDSA:  {edKey, edPub},
+		AlgSM2SM3: {smKey, &smKey.PublicKey},
+	}
+}
+
+func TestIssueVerify(t *testing.T) {
+	now := time.Now()
+	for alg, pair := range testKeys(t) {
+		issuer, err := NewIssuer(pair[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := issuer.Issue(License{
+			Product:   "gone",
+			Licensee:  "example",
+			Features:  []string{"sso"},
+			Seats:     10,
+			ExpiresAt: now.Add(time.Hour).Unix(),
+		})
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		v, err := NewVerifier(pair[1], WithProduct("gone"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, err := v.Verify(code)
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		if l.Algorithm != alg || l.Version != Version2 || l.ID == "" || !l.HasFeature("sso") || l.CheckSeats(11) != ErrSeatsExceeded {
+			t.Fatalf("%s: unexpected license %+v", alg, l)
+		}
+		// 修改授权信息
+		parts := strings.Split(code, ".")
+		parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"ver":2,"alg":"` + alg + `","seats":1000}`))
+		if _, err = v.Verify(strings.Join(parts, ".")); err != ErrSignature {
+			t.Fatalf("%s: tampered license: %v", alg, err)
+		}
+	}
+}
+
+func TestVerifyKeyMismatch(t *testing.T) {
+	keys := testKeys(t)
+	issuer, _ := NewIssuer(keys[AlgEdDSA][0]) // nolint
+	code, err := issuer.Issue(License{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, alg := range []string{AlgRS256, AlgES256, AlgSM2SM3} {
+		v, _ := NewVerifier(keys[alg][1]) // nolint
+		if _, err = v.Verify(code); err != ErrSignature {
+			t.Fatalf("%s verified EdDSA license: %v", alg, err)
+		}
+	}
+}
+
+func TestVerifyLegacy(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := base64.RawURLEncoding.EncodeToString(x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey))
+	code, err := crypto2.SignByRSA(rsaKey, []byte(`{"licensee":"example","exp":4102444800,"custom":"x"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, valid, err := crypto2.VerifyByRSA(publicKey, code); err != nil || !valid {
+		t.Fatal(err)
+	}
+	pub, err := ParsePublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := NewVerifier(pub) // nolint
+	l, err := v.Verify(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Version != Version1 || l.Licensee != "example" || !strings.Contains(string(l.Raw), "custom") {
+		t.Fatalf("unexpected license %+v", l)
+	}
+	v, _ = NewVerifier(pub, WithRejectLegacy()) // nolint
+	if _, err = v.Verify(code); err != ErrLegacy {
+		t.Fatalf("legacy accepted: %v", err)
+	}
+
+	smKey, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err = crypto2.SignBySM2(smKey, []byte("plain license"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509sm.MarshalSm2PublicKey(&smKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub, err = ParsePublicKey(base64.RawURLEncoding.EncodeToString(der)); err != nil {
+		t.Fatal(err)
+	}
+	v, _ = NewVerifier(pub) // nolint
+	if l, err = v.Verify(code); err != nil || string(l.Raw) != "plain license" {
+		t.Fatalf("sm2 legacy: %v", err)
+	}
+}
+
+func TestVerifyPolicy(t *testing.T) {
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, _ := NewIssuer(edKey) // nolint
+	now := time.Now()
+	issue := func(l License) string {
+		code, err := issuer.Issue(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+	hw := HardwareID("00:11:22:33:44:55")
+	for _, c := range []struct {
+		name  string
+		code  string
+		opts  []VerifierOptFunc
+		err   error
+		grace bool
+	}{
+		{"not before", issue(License{NotBefore: now.Add(time.Hour).Unix()}), nil, ErrNotYetValid, false},
+		{"expired", issue(License{ExpiresAt: now.Add(-time.Hour).Unix()}), nil, ErrExpired, false},
+		{"verifier grace", issue(License{ExpiresAt: now.Add(-time.Hour).Unix()}),
+			[]VerifierOptFunc{WithGracePeriod(2 * time.Hour)}, nil, true},
+		{"license grace", issue(License{ExpiresAt: now.Add(-time.Hour).Unix(), Grace: 7200}), nil, nil, true},
+		{"product", issue(License{Product: "other"}), []VerifierOptFunc{WithProduct("gone")}, ErrProduct, false},
+		{"hardware", issue(License{Hardware: []string{hw}}),
+			[]VerifierOptFunc{WithHardwareIDs(HardwareID("00:11:22:33:44:66"))}, ErrHardware, false},
+		{"hardware match", issue(License{Hardware: []string{hw}}),
+			[]VerifierOptFunc{WithHardwareIDs(HardwareID("00-11-22-33-44-55"))}, nil, false},
+	} {
+		v, _ := NewVerifier(edPub, append(c.opts, WithClock(func() time.Time { return now }))...) // nolint
+		l, err := v.Verify(c.code)
+		if err != c.err {
+			t.Fatalf("%s: got %v, want %v", c.name, err, c.err)
+		}
+		if err == nil && l.InGrace != c.grace {
+			t.Fatalf("%s: in grace %v", c.name, l.InGrace)
+		}
+	}
+}
+
+func TestRevocationList(t *testing.T) {
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, _ := NewIssuer(edKey) // nolint
+	code, err := issuer.Issue(License{ID: "lic-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := NewVerifier(edPub) // nolint
+	old, err := issuer.IssueRevocationList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.now = func() time.Time { return time.Now().Add(time.Minute) }
+	list, err := issuer.IssueRevocationList("lic-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.LoadRevocationList(list); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = v.Verify(code); err != ErrRevoked {
+		t.Fatalf("revoked license accepted: %v", err)
+	}
+	if err = v.LoadRevocationList(old); err != ErrRevocationStale {
+		t.Fatalf("stale list loaded: %v", err)
+	}
+	// 吊销列表不能当作授权码使用
+	if _, err = v.Verify(list); err != ErrMalformed {
+		t.Fatalf("revocation list accepted as license: %v", err)
+	}
+}
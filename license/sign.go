@@ -0,0 +1,143 @@
+package license
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+
+	"github.com/tjfoc/gmsm/sm2"
+	x509sm "github.com/tjfoc/gmsm/x509"
+)
+
+const (
+	AlgRS256   = "RS256"
+	AlgES256   = "ES256"
+	AlgEdDSA   = "EdDSA"
+	AlgSM2SM3  = "SM2SM3"
+	algUnknown = ""
+)
+
+// signAlgorithm 返回私钥对应的算法
+func signAlgorithm(key crypto.PrivateKey) string {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return AlgRS256
+	case *ecdsa.PrivateKey:
+		return AlgES256
+	case ed25519.PrivateKey:
+		return AlgEdDSA
+	case *sm2.PrivateKey:
+		return AlgSM2SM3
+	default:
+		return algUnknown
+	}
+}
+
+// verifyAlgorithm 返回公钥对应的算法
+func verifyAlgorithm(key crypto.PublicKey) string {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return AlgRS256
+	case *ecdsa.PublicKey:
+		return AlgES256
+	case ed25519.PublicKey:
+		return AlgEdDSA
+	case *sm2.PublicKey:
+		return AlgSM2SM3
+	default:
+		return algUnknown
+	}
+}
+
+func sign(key crypto.PrivateKey, input []byte) ([]byte, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256(input)
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+	case *ecdsa.PrivateKey:
+		sum := sha256.Sum256(input)
+		return ecdsa.SignASN1(rand.Reader, k, sum[:])
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, input), nil
+	case *sm2.PrivateKey:
+		return k.Sign(rand.Reader, input, nil)
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+func verify(key crypto.PublicKey, input, sig []byte) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(input)
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(input)
+		return ecdsa.VerifyASN1(k, sum[:], sig)
+	case ed25519.PublicKey:
+		return len(k) == ed25519.PublicKeySize && ed25519.Verify(k, input, sig)
+	case *sm2.PublicKey:
+		return k.Verify(input, sig)
+	default:
+		return false
+	}
+}
+
+// decodeKey 支持PEM和base64url编码的DER，base64url是cryptoutil生成授权码时使用的密钥格式
+func decodeKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		return block.Bytes, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return b, nil
+}
+
+// ParsePublicKey 解析RSA、ECDSA、Ed25519、SM2公钥，支持PKIX、PKCS1格式
+func ParsePublicKey(s string) (crypto.PublicKey, error) {
+	der, err := decodeKey(s)
+	if err != nil {
+		return nil, err
+	}
+	if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return pub, nil
+	}
+	if pub, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return pub, nil
+	}
+	if pub, err := x509sm.ParseSm2PublicKey(der); err == nil {
+		return pub, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// ParsePrivateKey 解析RSA、ECDSA、Ed25519、SM2私钥，支持PKCS8、PKCS1、SEC1格式
+func ParsePrivateKey(s string) (crypto.PrivateKey, error) {
+	der, err := decodeKey(s)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509sm.ParsePKCS8PrivateKey(der, nil); err == nil {
+		return key, nil
+	}
+	return nil, ErrUnsupportedKey
+}
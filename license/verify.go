@@ -0,0 +1,219 @@
+package license
+
+import (
+	"crypto"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RevocationList 吊销列表
+type RevocationList struct {
+	Algorithm string   `json:"alg"`
+	IssuedAt  int64    `json:"iat"`
+	IDs       []string `json:"ids"`
+}
+
+type VerifierOptFunc func(v *Verifier)
+
+// WithRejectLegacy 不再验证cryptoutil.SignByRSA、SignBySM2生成的旧授权码
+func WithRejectLegacy() VerifierOptFunc {
+	return func(v *Verifier) {
+		v.legacy = false
+	}
+}
+
+// WithGracePeriod 过期后离线宽限时间，授权信息中的Grace更长时使用Grace
+func WithGracePeriod(d time.Duration) VerifierOptFunc {
+	return func(v *Verifier) {
+		v.grace = d
+	}
+}
+
+// WithProduct 只接受指定产品的授权码
+func WithProduct(product string) VerifierOptFunc {
+	return func(v *Verifier) {
+		v.product = product
+	}
+}
+
+// WithHardwareIDs 设置本机硬件ID，默认使用MachineHardwareIDs
+func WithHardwareIDs(ids ...string) VerifierOptFunc {
+	return func(v *Verifier) {
+		v.hardware = func() ([]string, error) { return ids, nil }
+	}
+}
+
+// WithClock 设置当前时间，用于离线环境使用可信时间源
+func WithClock(now func() time.Time) VerifierOptFunc {
+	return func(v *Verifier) {
+		v.now = now
+	}
+}
+
+// Verifier 验证授权码，可以并发使用
+type Verifier struct {
+	key      crypto.PublicKey
+	alg      string
+	legacy   bool
+	grace    time.Duration
+	product  string
+	hardware func() ([]string, error)
+	now      func() time.Time
+
+	mu      sync.RWMutex
+	revoked *RevocationList
+	ids     map[string]struct{}
+}
+
+// NewVerifier 支持 *rsa.PublicKey、*ecdsa.PublicKey、ed25519.PublicKey、*sm2.PublicKey
+func NewVerifier(key crypto.PublicKey, opts ...VerifierOptFunc) (*Verifier, error) {
+	alg := verifyAlgorithm(key)
+	if alg == algUnknown {
+		return nil, ErrUnsupportedKey
+	}
+	v := &Verifier{
+		key:      key,
+		alg:      alg,
+		legacy:   true,
+		hardware: MachineHardwareIDs,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v, nil
+}
+
+// Verify 验证签名、吊销、有效期、产品和硬件绑定，处于宽限期时License.InGrace为true
+func (v *Verifier) Verify(code string) (*License, error) {
+	var (
+		l   *License
+		err error
+	)
+	if strings.Count(code, ".") == 1 {
+		l, err = v.parseLegacy(code)
+	} else {
+		l, err = v.parse(code)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v.isRevoked(l.ID) {
+		return nil, ErrRevoked
+	}
+	if v.product != "" && l.Product != v.product {
+		return nil, ErrProduct
+	}
+	if l.InGrace, err = l.checkTime(v.now(), v.grace); err != nil {
+		return nil, err
+	}
+	if err = v.checkHardware(l.Hardware); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (v *Verifier) parse(code string) (*License, error) {
+	input, payload, sig, err := splitSigned(prefixLicense, code)
+	if err != nil {
+		return nil, err
+	}
+	if !verify(v.key, []byte(input), sig) {
+		return nil, ErrSignature
+	}
+	l := &License{}
+	if err = json.Unmarshal(payload, l); err != nil {
+		return nil, ErrMalformed
+	}
+	if l.Version != Version2 {
+		return nil, ErrMalformed
+	}
+	// 算法必须和公钥一致，避免使用其他算法伪造
+	if l.Algorithm != v.alg {
+		return nil, ErrAlgorithm
+	}
+	l.Raw = payload
+	return l, nil
+}
+
+// parseLegacy 验证旧格式，授权信息不是json对象时只保存在Raw中
+func (v *Verifier) parseLegacy(code string) (*License, error) {
+	if !v.legacy || (v.alg != AlgRS256 && v.alg != AlgSM2SM3) {
+		return nil, ErrLegacy
+	}
+	input, payload, sig, err := splitSigned("", code)
+	if err != nil {
+		return nil, err
+	}
+	if !verify(v.key, []byte(input), sig) {
+		return nil, ErrSignature
+	}
+	l := &License{}
+	if json.Unmarshal(payload, l) != nil {
+		l = &License{}
+	}
+	l.Version = Version1
+	l.Algorithm = v.alg
+	l.Raw = payload
+	return l, nil
+}
+
+func (v *Verifier) checkHardware(bound []string) error {
+	if len(bound) == 0 {
+		return nil
+	}
+	ids, err := v.hardware()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		for _, b := range bound {
+			if strings.EqualFold(id, b) {
+				return nil
+			}
+		}
+	}
+	return ErrHardware
+}
+
+// LoadRevocationList 验证并加载吊销列表，签发时间早于当前列表时返回ErrRevocationStale
+func (v *Verifier) LoadRevocationList(code string) error {
+	input, payload, sig, err := splitSigned(prefixRevocation, code)
+	if err != nil {
+		return err
+	}
+	if !verify(v.key, []byte(input), sig) {
+		return ErrSignature
+	}
+	rl := &RevocationList{}
+	if err = json.Unmarshal(payload, rl); err != nil {
+		return ErrMalformed
+	}
+	if rl.Algorithm != v.alg {
+		return ErrAlgorithm
+	}
+	ids := make(map[string]struct{}, len(rl.IDs))
+	for _, id := range rl.IDs {
+		ids[id] = struct{}{}
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.revoked != nil && rl.IssuedAt < v.revoked.IssuedAt {
+		return ErrRevocationStale
+	}
+	v.revoked = rl
+	v.ids = ids
+	return nil
+}
+
+func (v *Verifier) isRevoked(id string) bool {
+	if id == "" {
+		return false
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	_, ok := v.ids[id]
+	return ok
+}
@@ -19,6 +19,12 @@ const (
 
 // Log logs at the specified level for the specified sender
 func Log(level LogLevel, sender string, format string, v ...any) {
+	Event(level, sender).Msg(fmt.Sprintf(format, v...))
+}
+
+// Event returns a structured event at the specified level for the specified sender,
+// callers add fields and finish it with Msg or Send
+func Event(level LogLevel, sender string) *zerolog.Event {
 	var ev *zerolog.Event
 	switch level {
 	case LevelDebug:
@@ -32,8 +38,7 @@ func Log(level LogLevel, sender string, format string, v ...any) {
 	default:
 		ev = log.Logger.Error()
 	}
-	ev.Timestamp().Str("sender", sender)
-	ev.Msg(fmt.Sprintf(format, v...))
+	return ev.Timestamp().Str("sender", sender)
 }
 
 func Debugf(format string, v ...any) {
@@ -0,0 +1,108 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorpher/gone/jwtutil"
+)
+
+// RemoteKeySet 缓存远程JWKS，遇到未知kid时重新获取，两次获取至少间隔minRefreshInterval，
+// 获取失败时间隔内直接返回上次的错误
+type RemoteKeySet struct {
+	jwksURI            string
+	client             *http.Client
+	minRefreshInterval time.Duration
+
+	mutex     sync.Mutex
+	keys      *jwtutil.JWKSet
+	lastFetch time.Time
+	lastErr   error
+	inflight  chan struct{} // 正在获取时不为nil，获取完成后关闭
+}
+
+func NewRemoteKeySet(jwksURI string, client *http.Client, minRefreshInterval time.Duration) *RemoteKeySet {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &RemoteKeySet{
+		jwksURI:            jwksURI,
+		client:             client,
+		minRefreshInterval: minRefreshInterval,
+	}
+}
+
+// Key 根据kid获取公钥，本地缓存中没有时刷新JWKS
+func (r *RemoteKeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, *jwtutil.JWK, error) {
+	if jwk, err := r.lookup(kid); err == nil {
+		pub, err := jwk.PublicKey()
+		return pub, jwk, err
+	}
+	if err := r.refresh(ctx, false); err != nil {
+		return nil, nil, err
+	}
+	jwk, err := r.lookup(kid)
+	if err != nil {
+		return nil, nil, err
+	}
+	pub, err := jwk.PublicKey()
+	return pub, jwk, err
+}
+
+// Refresh 强制重新获取JWKS
+func (r *RemoteKeySet) Refresh(ctx context.Context) error {
+	return r.refresh(ctx, true)
+}
+
+func (r *RemoteKeySet) lookup(kid string) (*jwtutil.JWK, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.keys == nil {
+		return nil, jwtutil.ErrJWKNotFound
+	}
+	return r.keys.Lookup(kid)
+}
+
+// refresh 同一时间只有一个请求获取JWKS，其他请求等待结果，获取时不持有锁
+func (r *RemoteKeySet) refresh(ctx context.Context, force bool) error {
+	r.mutex.Lock()
+	if ch := r.inflight; ch != nil {
+		r.mutex.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		return r.lastErr
+	}
+	if !force && !r.lastFetch.IsZero() && time.Since(r.lastFetch) < r.minRefreshInterval {
+		defer r.mutex.Unlock()
+		return r.lastErr
+	}
+	ch := make(chan struct{})
+	r.inflight = ch
+	r.lastFetch = time.Now()
+	r.mutex.Unlock()
+
+	var set jwtutil.JWKSet
+	err := getJSON(ctx, r.client, r.jwksURI, &set)
+	if err == nil && len(set.Keys) == 0 {
+		err = errors.New("oidc: jwks is empty")
+	}
+
+	r.mutex.Lock()
+	if err == nil {
+		r.keys = &set
+	}
+	r.lastErr = err
+	r.inflight = nil
+	r.mutex.Unlock()
+	close(ch)
+	return err
+}
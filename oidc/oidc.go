@@ -0,0 +1,123 @@
+// Package oidc OpenID Connect依赖方（Relying Party）支持：
+// 读取discovery配置、获取并缓存JWKS、验证ID Token并映射为authed.UserSession。
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const discoveryPath = "/.well-known/openid-configuration"
+
+var ErrIssuerMismatch = errors.New("oidc: issuer did not match the issuer returned by provider")
+
+// Discovery OpenID Provider Metadata，参考 OpenID Connect Discovery 1.0 3
+type Discovery struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint,omitempty"`
+	JwksURI                          string   `json:"jwks_uri"`
+	IntrospectionEndpoint            string   `json:"introspection_endpoint,omitempty"`
+	RevocationEndpoint               string   `json:"revocation_endpoint,omitempty"`
+	EndSessionEndpoint               string   `json:"end_session_endpoint,omitempty"`
+	ScopesSupported                  []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported           []string `json:"response_types_supported,omitempty"`
+	SubjectTypesSupported            []string `json:"subject_types_supported,omitempty"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported,omitempty"`
+	ClaimsSupported                  []string `json:"claims_supported,omitempty"`
+}
+
+// Provider OpenID Provider
+type Provider struct {
+	Issuer    string
+	Discovery *Discovery
+	// ===============================
+	client             *http.Client
+	minRefreshInterval time.Duration
+	keySet             *RemoteKeySet
+}
+
+type OptFunc func(p *Provider) *Provider
+
+func WithHTTPClient(client *http.Client) OptFunc {
+	return func(p *Provider) *Provider {
+		p.client = client
+		return p
+	}
+}
+
+// WithMinRefreshInterval 遇到未知kid时两次刷新JWKS的最小间隔
+func WithMinRefreshInterval(d time.Duration) OptFunc {
+	return func(p *Provider) *Provider {
+		p.minRefreshInterval = d
+		return p
+	}
+}
+
+// NewProvider 读取issuer的discovery配置，返回的issuer必须与参数一致
+func NewProvider(ctx context.Context, issuer string, opts ...OptFunc) (*Provider, error) {
+	p := &Provider{
+		Issuer:             issuer,
+		client:             http.DefaultClient,
+		minRefreshInterval: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	wellKnown := strings.TrimSuffix(issuer, "/") + discoveryPath
+	var d Discovery
+	if err := getJSON(ctx, p.client, wellKnown, &d); err != nil {
+		return nil, err
+	}
+	if d.Issuer != issuer {
+		return nil, fmt.Errorf("%w: expected %q got %q", ErrIssuerMismatch, issuer, d.Issuer)
+	}
+	if d.JwksURI == "" {
+		return nil, errors.New("oidc: jwks_uri is missing from discovery document")
+	}
+	p.Discovery = &d
+	p.keySet = NewRemoteKeySet(d.JwksURI, p.client, p.minRefreshInterval)
+	return p, nil
+}
+
+// KeySet 返回provider的远程密钥集合
+func (p *Provider) KeySet() *RemoteKeySet {
+	return p.keySet
+}
+
+// Verifier 创建ID Token验证器，默认算法使用discovery中声明的签名算法
+func (p *Provider) Verifier(clientID string, opts ...VerifierOptFunc) *IDTokenVerifier {
+	v := NewIDTokenVerifier(p.Issuer, clientID, p.keySet, opts...)
+	if !v.algsSet && len(p.Discovery.IDTokenSigningAlgValuesSupported) > 0 {
+		v.SupportedAlgs = p.Discovery.IDTokenSigningAlgValuesSupported
+	}
+	return v
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: get %s: %s", url, resp.Status)
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,254 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorpher/gone/jwtutil"
+)
+
+type testProvider struct {
+	*httptest.Server
+	mutex sync.Mutex
+	keys  []jwtutil.JWK
+	hits  int
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	p := &testProvider{}
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{ // nolint
+			Issuer:                           p.URL,
+			JwksURI:                          p.URL + "/jwks",
+			IDTokenSigningAlgValuesSupported: []string{"RS256", "ES256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		p.hits++
+		json.NewEncoder(w).Encode(jwtutil.JWKSet{Keys: p.keys}) // nolint
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *testProvider) setKeys(keys ...jwtutil.JWK) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.keys = keys
+}
+
+func rsaJWK(t *testing.T, kid string, pub *rsa.PublicKey) jwtutil.JWK {
+	data, err := jwtutil.RsaPublicKeyToJWK(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jwk jwtutil.JWK
+	if err = json.Unmarshal(data, &jwk); err != nil {
+		t.Fatal(err)
+	}
+	jwk.KID = kid
+	return jwk
+}
+
+func ecJWK(t *testing.T, kid string, pub *ecdsa.PublicKey) jwtutil.JWK {
+	data, err := jwtutil.EcdsaPublicKeyToJWK(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jwk jwtutil.JWK
+	if err = json.Unmarshal(data, &jwk); err != nil {
+		t.Fatal(err)
+	}
+	jwk.KID = kid
+	return jwk
+}
+
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	hb, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) // nolint
+	pb, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString(pb)
+	digest := sha256.Sum256([]byte(input))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s interface{ FillBytes([]byte) []byte }
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		if err == nil {
+			sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func claims(iss string, extra map[string]any) map[string]any {
+	now := time.Now()
+	c := map[string]any{
+		"iss":                iss,
+		"sub":                "user-1",
+		"aud":                "client-1",
+		"exp":                now.Add(time.Hour).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              "n-0S6",
+		"email":              "tom@example.com",
+		"preferred_username": "tom",
+		"groups":             []string{"admin"},
+	}
+	for k, v := range extra {
+		c[k] = v
+	}
+	return c
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestProvider(t)
+	server.setKeys(rsaJWK(t, "rsa-1", &rsaKey.PublicKey))
+
+	ctx := context.Background()
+	provider, err := NewProvider(ctx, server.URL, WithMinRefreshInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := provider.Verifier("client-1")
+
+	accessToken := "ya29.access-token"
+	atHash, err := AccessTokenHash("RS256", accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := sign(t, "RS256", "rsa-1", rsaKey, claims(server.URL, map[string]any{"at_hash": atHash}))
+	se, err := verifier.VerifySession(ctx, raw, WithNonce("n-0S6"), WithAccessToken(accessToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if se.Uid != "user-1" || se.Username != "tom" || len(se.Roles) != 1 || se.Extends["email"] != "tom@example.com" {
+		t.Fatalf("unexpected session %+v", se)
+	}
+	if _, err = verifier.Verify(ctx, raw, WithNonce("other")); !errors.Is(err, ErrInvalidNonce) {
+		t.Fatalf("expect nonce error, got %v", err)
+	}
+	if _, err = verifier.Verify(ctx, raw, WithAccessToken("other")); !errors.Is(err, ErrInvalidAtHash) {
+		t.Fatalf("expect at_hash error, got %v", err)
+	}
+
+	// 密钥轮换：未知kid触发JWKS刷新
+	server.setKeys(rsaJWK(t, "rsa-1", &rsaKey.PublicKey), ecJWK(t, "ec-1", &ecKey.PublicKey))
+	raw = sign(t, "ES256", "ec-1", ecKey, claims(server.URL, nil))
+	if _, err = verifier.Verify(ctx, raw); err != nil {
+		t.Fatal(err)
+	}
+	if server.hits != 2 {
+		t.Fatalf("expect 2 jwks fetches, got %d", server.hits)
+	}
+
+	// 算法混淆：使用RSA密钥的kid声明ES256
+	raw = sign(t, "ES256", "rsa-1", ecKey, claims(server.URL, nil))
+	if _, err = verifier.Verify(ctx, raw); err == nil {
+		t.Fatal("algorithm confusion accepted")
+	}
+}
+
+func TestVerifyIDTokenClaims(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestProvider(t)
+	server.setKeys(rsaJWK(t, "k", &rsaKey.PublicKey))
+	ctx := context.Background()
+	provider, err := NewProvider(ctx, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := provider.Verifier("client-1")
+	testCases := []struct {
+		name   string
+		claims map[string]any
+		err    error
+	}{
+		{"expired", claims(server.URL, map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}), ErrTokenExpired},
+		{"issuer", claims("https://evil.example.com", nil), ErrInvalidIssuerClaim},
+		{"audience", claims(server.URL, map[string]any{"aud": "client-2"}), ErrInvalidAudience},
+		{"azp missing", claims(server.URL, map[string]any{"aud": []string{"client-1", "client-2"}}), ErrInvalidAzp},
+		{"azp", claims(server.URL, map[string]any{"azp": "client-2"}), ErrInvalidAzp},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := verifier.Verify(ctx, sign(t, "RS256", "k", rsaKey, tc.claims))
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expect %v, got %v", tc.err, err)
+			}
+		})
+	}
+	if _, err = verifier.Verify(ctx, sign(t, "HS256", "k", rsaKey, claims(server.URL, nil))); !errors.Is(err, ErrUnsupportedAlg) {
+		t.Fatalf("expect unsupported alg, got %v", err)
+	}
+}
+
+func TestRemoteKeySetBackoff(t *testing.T) {
+	server := newTestProvider(t)
+	keys := NewRemoteKeySet(server.URL+"/jwks", nil, time.Minute)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := keys.Key(ctx, "rsa-1"); err == nil {
+				t.Error("empty jwks returned a key")
+			}
+		}()
+	}
+	wg.Wait()
+	// 首次获取失败后，间隔内不再请求
+	if _, _, err := keys.Key(ctx, "rsa-1"); err == nil {
+		t.Fatal("empty jwks returned a key")
+	}
+	if server.hits != 1 {
+		t.Fatalf("expect 1 jwks fetch while provider is down, got %d", server.hits)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.setKeys(rsaJWK(t, "rsa-1", &rsaKey.PublicKey))
+	if err = keys.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = keys.Key(ctx, "rsa-1"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,329 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/gorpher/gone/authed"
+	"github.com/gorpher/gone/codec"
+	"github.com/gorpher/gone/jwtutil"
+)
+
+var (
+	ErrTokenExpired       = errors.New("oidc: token is expired")
+	ErrTokenNotYetValid   = errors.New("oidc: token is not yet valid")
+	ErrInvalidAudience    = errors.New("oidc: invalid audience")
+	ErrInvalidAzp         = errors.New("oidc: invalid authorized party")
+	ErrInvalidNonce       = errors.New("oidc: invalid nonce")
+	ErrInvalidAtHash      = errors.New("oidc: invalid at_hash")
+	ErrUnsupportedAlg     = errors.New("oidc: unsupported signing algorithm")
+	ErrInvalidSignature   = errors.New("oidc: invalid signature")
+	ErrInvalidIssuerClaim = errors.New("oidc: invalid issuer claim")
+)
+
+// KeySet 根据kid获取验签公钥
+type KeySet interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, *jwtutil.JWK, error)
+}
+
+// IDToken OpenID Connect ID Token
+type IDToken struct {
+	codec.Payload
+	Nonce           string `json:"nonce,omitempty"`
+	AuthorizedParty string `json:"azp,omitempty"`
+	AccessTokenHash string `json:"at_hash,omitempty"`
+
+	Header codec.Header `json:"-"`
+	raw    json.RawMessage
+}
+
+// Claims 将原始claims解码到v
+func (t *IDToken) Claims(v any) error {
+	if t.raw == nil {
+		return errors.New("oidc: claims not set")
+	}
+	return json.Unmarshal(t.raw, v)
+}
+
+// SessionMapper 将ID Token映射为用户会话
+type SessionMapper func(t *IDToken) (*authed.UserSession, error)
+
+// standardClaims 常用的用户信息claims
+type standardClaims struct {
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+	Nickname          string   `json:"nickname"`
+	Email             string   `json:"email"`
+	EmailVerified     *bool    `json:"email_verified"`
+	Roles             []string `json:"roles"`
+	Groups            []string `json:"groups"`
+	Scope             string   `json:"scope"`
+}
+
+// DefaultSessionMapper sub映射为Uid，preferred_username/email映射为Username，
+// name映射为Nickname，roles/groups映射为Roles
+func DefaultSessionMapper(t *IDToken) (*authed.UserSession, error) {
+	var c standardClaims
+	if err := t.Claims(&c); err != nil {
+		return nil, err
+	}
+	se := &authed.UserSession{
+		Uid:        t.Subject,
+		ID:         t.JWTID,
+		ClientName: t.AuthorizedParty,
+		Username:   c.PreferredUsername,
+		Nickname:   c.Name,
+		Roles:      append(c.Roles, c.Groups...),
+		Scopes:     strings.Fields(c.Scope),
+		Extends:    map[string]any{"iss": t.Issuer},
+	}
+	if se.Username == "" {
+		se.Username = c.Email
+	}
+	if se.Nickname == "" {
+		se.Nickname = c.Nickname
+	}
+	if se.ClientName == "" && len(t.Audience) > 0 {
+		se.ClientName = t.Audience[0]
+	}
+	if c.Email != "" {
+		se.Extends["email"] = c.Email
+	}
+	if c.EmailVerified != nil {
+		se.Extends["email_verified"] = *c.EmailVerified
+	}
+	if t.ExpirationTime != nil {
+		se.ExpiredAt = t.ExpirationTime.Unix()
+	}
+	return se, nil
+}
+
+// IDTokenVerifier ID Token验证器
+type IDTokenVerifier struct {
+	ClientID      string
+	SupportedAlgs []string
+	Leeway        time.Duration
+	// ===============================
+	issuer  string
+	keySet  KeySet
+	mapper  SessionMapper
+	now     func() time.Time
+	algsSet bool
+}
+
+type VerifierOptFunc func(v *IDTokenVerifier) *IDTokenVerifier
+
+// WithSupportedAlgs 限定允许的签名算法，默认RS256
+func WithSupportedAlgs(algs ...string) VerifierOptFunc {
+	return func(v *IDTokenVerifier) *IDTokenVerifier {
+		v.SupportedAlgs = algs
+		v.algsSet = true
+		return v
+	}
+}
+
+// WithLeeway 时间校验允许的时钟偏差
+func WithLeeway(d time.Duration) VerifierOptFunc {
+	return func(v *IDTokenVerifier) *IDTokenVerifier {
+		v.Leeway = d
+		return v
+	}
+}
+
+func WithSessionMapper(m SessionMapper) VerifierOptFunc {
+	return func(v *IDTokenVerifier) *IDTokenVerifier {
+		v.mapper = m
+		return v
+	}
+}
+
+func WithNow(now func() time.Time) VerifierOptFunc {
+	return func(v *IDTokenVerifier) *IDTokenVerifier {
+		v.now = now
+		return v
+	}
+}
+
+func NewIDTokenVerifier(issuer, clientID string, keySet KeySet, opts ...VerifierOptFunc) *IDTokenVerifier {
+	v := &IDTokenVerifier{
+		ClientID:      clientID,
+		SupportedAlgs: []string{"RS256"},
+		Leeway:        time.Minute,
+		issuer:        issuer,
+		keySet:        keySet,
+		mapper:        DefaultSessionMapper,
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+type verifyOptions struct {
+	nonce       string
+	accessToken string
+}
+
+type VerifyOptFunc func(o *verifyOptions) *verifyOptions
+
+// WithNonce 校验ID Token中的nonce
+func WithNonce(nonce string) VerifyOptFunc {
+	return func(o *verifyOptions) *verifyOptions {
+		o.nonce = nonce
+		return o
+	}
+}
+
+// WithAccessToken 校验ID Token中的at_hash
+func WithAccessToken(accessToken string) VerifyOptFunc {
+	return func(o *verifyOptions) *verifyOptions {
+		o.accessToken = accessToken
+		return o
+	}
+}
+
+// Verify 验证ID Token签名和claims，参考 OpenID Connect Core 1.0 3.1.3.7
+func (v *IDTokenVerifier) Verify(ctx context.Context, rawIDToken string, opts ...VerifyOptFunc) (*IDToken, error) {
+	o := &verifyOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	raw := []byte(rawIDToken)
+	parts := bytes.Split(raw, []byte("."))
+	if len(parts) != 3 {
+		return nil, codec.ErrMalformed
+	}
+	hb, err := base64.RawURLEncoding.DecodeString(string(parts[0]))
+	if err != nil {
+		return nil, codec.ErrMalformed
+	}
+	var header codec.Header
+	if err = json.Unmarshal(hb, &header); err != nil {
+		return nil, codec.ErrMalformed
+	}
+	if !contains(v.SupportedAlgs, header.Algorithm) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, header.Algorithm)
+	}
+	pub, jwk, err := v.keySet.Key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if jwk != nil && (jwk.Algorithm != "" && jwk.Algorithm != header.Algorithm || jwk.Use != "" && jwk.Use != "sig") {
+		return nil, ErrInvalidSignature
+	}
+	body, err := verifySignature(header.Algorithm, pub, raw)
+	if err != nil {
+		return nil, err
+	}
+	token := &IDToken{Header: header, raw: body}
+	if err = json.Unmarshal(body, token); err != nil {
+		return nil, err
+	}
+	if err = v.verifyClaims(token, header.Algorithm, o); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// VerifySession 验证ID Token并映射为用户会话
+func (v *IDTokenVerifier) VerifySession(ctx context.Context, rawIDToken string,
+	opts ...VerifyOptFunc) (*authed.UserSession, error) {
+	token, err := v.Verify(ctx, rawIDToken, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return v.mapper(token)
+}
+
+func (v *IDTokenVerifier) verifyClaims(t *IDToken, alg string, o *verifyOptions) error {
+	if t.Issuer != v.issuer {
+		return ErrInvalidIssuerClaim
+	}
+	if !contains(t.Audience, v.ClientID) {
+		return ErrInvalidAudience
+	}
+	if len(t.Audience) > 1 && t.AuthorizedParty == "" || t.AuthorizedParty != "" && t.AuthorizedParty != v.ClientID {
+		return ErrInvalidAzp
+	}
+	now := v.now()
+	if t.ExpirationTime == nil || now.After(t.ExpirationTime.Add(v.Leeway)) {
+		return ErrTokenExpired
+	}
+	if t.NotBefore != nil && now.Add(v.Leeway).Before(t.NotBefore.Time) {
+		return ErrTokenNotYetValid
+	}
+	if t.IssuedAt != nil && now.Add(v.Leeway).Before(t.IssuedAt.Time) {
+		return ErrTokenNotYetValid
+	}
+	if o.nonce != "" && subtle.ConstantTimeCompare([]byte(o.nonce), []byte(t.Nonce)) != 1 {
+		return ErrInvalidNonce
+	}
+	if o.accessToken != "" && t.AccessTokenHash != "" {
+		atHash, err := AccessTokenHash(alg, o.accessToken)
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare([]byte(atHash), []byte(t.AccessTokenHash)) != 1 {
+			return ErrInvalidAtHash
+		}
+	}
+	return nil
+}
+
+// AccessTokenHash 计算at_hash：按签名算法的hash取左半部分再base64url编码
+func AccessTokenHash(alg, accessToken string) (string, error) {
+	var h hash.Hash
+	switch {
+	case strings.HasSuffix(alg, "256"):
+		h = sha256.New()
+	case strings.HasSuffix(alg, "384"):
+		h = sha512.New384()
+	case strings.HasSuffix(alg, "512"):
+		h = sha512.New()
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedAlg, alg)
+	}
+	h.Write([]byte(accessToken))
+	sum := h.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, raw []byte) (json.RawMessage, error) {
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") && !strings.HasPrefix(alg, "PS") {
+			return nil, ErrInvalidSignature
+		}
+		return jwtutil.VerifyJwtSignByRsa(raw, pub)
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return nil, ErrInvalidSignature
+		}
+		return jwtutil.VerifyJwtSignByEcdsa(raw, pub)
+	default:
+		return nil, ErrInvalidSignature
+	}
+}
+
+func contains(list []string, s string) bool {
+	for i := range list {
+		if list[i] == s {
+			return true
+		}
+	}
+	return false
+}